@@ -0,0 +1,185 @@
+package clipboard
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Formats the clipboard is read and written in. Backends may offer others;
+// Formats lists what the clipboard holds at the moment.
+const (
+	Text = "text/plain"
+	PNG  = "image/png"
+)
+
+// Selections a backend can reach. X11 and Wayland have a primary selection
+// holding the text last highlighted, besides the clipboard.
+const (
+	Clipboard = "clipboard"
+	Primary   = "primary"
+)
+
+// ErrEmpty is returned when the clipboard holds nothing in the format asked
+// for.
+var ErrEmpty = errors.New("clipboard has nothing in that format")
+
+// ErrUnsupported is returned for formats or operations a backend cannot
+// handle.
+var ErrUnsupported = errors.New("not supported by this clipboard backend")
+
+// Backend is a way of reaching the system clipboard.
+type Backend interface {
+	// Name is the name the backend is chosen by.
+	Name() string
+	// Formats lists the MIME types the clipboard offers right now.
+	Formats() ([]string, error)
+	// Read returns the clipboard contents in format, or ErrEmpty.
+	Read(format string) ([]byte, error)
+	// Write replaces the clipboard contents with data in format.
+	Write(format string, data []byte) error
+	// Watch signals when the clipboard may have changed until ctx is done.
+	// Backends that are not told about changes check every interval.
+	Watch(ctx context.Context, interval time.Duration) (<-chan struct{}, error)
+}
+
+// PrimaryBackend is implemented by backends that may reach the primary
+// selection as well. Primary returns ErrUnsupported if this one cannot.
+type PrimaryBackend interface {
+	Primary() (Backend, error)
+}
+
+// TerminalBackend is implemented by backends that copy by writing an
+// escape sequence to the terminal. A program drawing on that terminal
+// should write the sequence itself, between frames, rather than call Write
+// and garble what it drew.
+type TerminalBackend interface {
+	Sequence(format string, data []byte) ([]byte, error)
+}
+
+// opener starts a backend, or tells why it cannot work here.
+type opener func() (Backend, error)
+
+// backends are the backends built for this platform, auto the order they
+// are tried in when none is chosen and primary those that may reach the
+// primary selection when the chosen one cannot. They are filled in by the
+// platform files.
+var (
+	backends = map[string]opener{"native": openNative, "fake": openFake}
+	auto     []string
+	primary  []string
+)
+
+// Names lists the backends that can be chosen on this platform.
+func Names() []string {
+	names := make([]string, 0, len(backends))
+	for name := range backends {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Open starts the backend called name.
+func Open(name string) (Backend, error) {
+	open, ok := backends[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown clipboard backend %q (have %v)", name, Names())
+	}
+	b, err := open()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	return b, nil
+}
+
+// Auto starts the first backend that works here. It also returns why the
+// ones before it did not, and a nil Backend if none does.
+func Auto() (Backend, []error) {
+	var failed []error
+	for _, name := range auto {
+		b, err := Open(name)
+		if err == nil {
+			return b, failed
+		}
+		failed = append(failed, err)
+	}
+	return nil, failed
+}
+
+// OpenPrimary returns a backend for the primary selection: that of b if it
+// has one, or else of the first backend that works here and has one.
+func OpenPrimary(b Backend) (Backend, error) {
+	candidates := []Backend{b}
+	for _, name := range primary {
+		if other, err := Open(name); err == nil {
+			candidates = append(candidates, other)
+		}
+	}
+	for _, c := range candidates {
+		if p, ok := c.(PrimaryBackend); ok {
+			if sel, err := p.Primary(); err == nil {
+				return sel, nil
+			}
+		}
+	}
+	if len(primary) == 0 {
+		return nil, fmt.Errorf("there is no primary selection on this platform")
+	}
+	return nil, fmt.Errorf("%s cannot read the primary selection, and neither can %s", b.Name(), strings.Join(primary, " or "))
+}
+
+// ReadText returns the text on the clipboard.
+func ReadText(b Backend) (string, error) {
+	data, err := b.Read(Text)
+	return string(data), err
+}
+
+// WriteText puts text on the clipboard.
+func WriteText(b Backend, text string) error {
+	return b.Write(Text, []byte(text))
+}
+
+// ReadImage returns the image on the clipboard as PNG.
+func ReadImage(b Backend) ([]byte, error) {
+	return b.Read(PNG)
+}
+
+// poll signals every interval until ctx is done, for backends that are not
+// told about changes.
+func poll(ctx context.Context, interval time.Duration) <-chan struct{} {
+	ch := make(chan struct{}, 1)
+	go func() {
+		defer close(ch)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				notify(ch)
+			}
+		}
+	}()
+	return ch
+}
+
+// ignoreEmpty treats an empty clipboard as no error.
+func ignoreEmpty(err error) error {
+	if errors.Is(err, ErrEmpty) {
+		return nil
+	}
+	return err
+}
+
+// notify signals a change on ch unless one is already waiting.
+func notify(ch chan<- struct{}) {
+	select {
+	case ch <- struct{}{}:
+	default:
+	}
+}
@@ -1,53 +1,204 @@
 //go:build !windows
+
 package clipboard
 
 import (
-	"crypto/md5"
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
+	"os"
 	"os/exec"
 	"runtime"
 	"strings"
+	"time"
 )
 
-var lastHash string
+func init() {
+	backends["xclip"] = openCommand(xclip(Clipboard), true)
+	backends["xsel"] = openCommand(xsel(Clipboard), true)
+	backends["pbpaste"] = openCommand(pbpaste, false)
+	backends["wayland"] = openWayland
+	backends["osc52"] = openOSC52
+	primary = []string{"xclip", "xsel"}
+	switch {
+	case runtime.GOOS == "darwin":
+		auto = []string{"native", "pbpaste", "osc52"}
+	case os.Getenv("WAYLAND_DISPLAY") != "":
+		// X11 backends only see the clipboard of X11 programs running
+		// under XWayland, if there is one at all.
+		auto = []string{"wayland", "native", "xclip", "xsel", "osc52"}
+	default:
+		auto = []string{"native", "xclip", "xsel", "osc52"}
+	}
+}
+
+// command reaches the clipboard through command line tools. read and write
+// give the arguments that read or write a format, or nil if the tool
+// cannot; targets lists the formats on offer, or is nil if the tool cannot
+// tell. A read failing with one of the empty messages found nothing.
+// forSelection makes the same command for another selection, if the tool
+// has them.
+type command struct {
+	name         string
+	selection    string
+	read         func(format string) []string
+	write        func(format string) []string
+	targets      []string
+	empty        []string
+	forSelection func(selection string) command
+}
+
+func xclip(selection string) command {
+	return command{
+		name:      "xclip",
+		selection: selection,
+		read: func(format string) []string {
+			if format == Text {
+				return []string{"xclip", "-selection", selection, "-o"}
+			}
+			return []string{"xclip", "-selection", selection, "-o", "-t", format}
+		},
+		// Left to itself xclip offers text under the usual text targets
+		// (UTF8_STRING, STRING, TEXT) that older programs ask for.
+		write: func(format string) []string {
+			if format == Text {
+				return []string{"xclip", "-selection", selection, "-i"}
+			}
+			return []string{"xclip", "-selection", selection, "-i", "-t", format}
+		},
+		targets: []string{"xclip", "-selection", selection, "-o", "-t", "TARGETS"},
+		// When nothing owns the selection or the owner does not offer
+		// the format.
+		empty:        []string{"not available"},
+		forSelection: xclip,
+	}
+}
 
-func Read() (string, error) {
-	var cmd *exec.Cmd
+func xsel(selection string) command {
+	return command{
+		name:         "xsel",
+		selection:    selection,
+		read:         textOnly("xsel", "--"+selection, "--output"),
+		write:        textOnly("xsel", "--"+selection, "--input"),
+		forSelection: xsel,
+	}
+}
 
-	switch runtime.GOOS {
-	case "darwin":
-		cmd = exec.Command("pbpaste")
-	case "linux":
-		if _, err := exec.LookPath("xclip"); err == nil {
-			cmd = exec.Command("xclip", "-selection", "clipboard", "-o")
-		} else {
-			cmd = exec.Command("xsel", "--clipboard", "--output")
+var pbpaste = command{
+	name:      "pbpaste",
+	selection: Clipboard,
+	read:      textOnly("pbpaste"),
+	write:     textOnly("pbcopy"),
+}
+
+func textOnly(args ...string) func(string) []string {
+	return func(format string) []string {
+		if format != Text {
+			return nil
 		}
-	default:
-		return "", nil
+		return args
 	}
+}
 
-	out, err := cmd.Output()
-	if err != nil {
-		return "", err
+// openCommand checks that the tool of c is installed, and for X11 tools
+// that there is a display to talk to.
+func openCommand(c command, x11 bool) opener {
+	return func() (Backend, error) {
+		if _, err := exec.LookPath(c.read(Text)[0]); err != nil {
+			return nil, err
+		}
+		if x11 && os.Getenv("DISPLAY") == "" {
+			return nil, errors.New("DISPLAY is not set")
+		}
+		return c, nil
 	}
+}
+
+func (c command) Name() string { return c.name }
 
-	return strings.TrimSpace(string(out)), nil
+func (c command) Primary() (Backend, error) {
+	if c.forSelection == nil {
+		return nil, ErrUnsupported
+	}
+	return c.forSelection(Primary), nil
 }
 
-// HasChanged returns true if clipboard changed since last check
-func HasChanged() bool {
-	content, err := Read()
+func (c command) Formats() ([]string, error) {
+	if c.targets == nil {
+		if _, err := c.Read(Text); err != nil {
+			return nil, ignoreEmpty(err)
+		}
+		return []string{Text}, nil
+	}
+	out, err := c.run(c.targets, nil)
 	if err != nil {
-		return false
+		return nil, ignoreEmpty(err)
+	}
+	var formats []string
+	for _, f := range strings.Fields(string(out)) {
+		// X11 targets that are not MIME types, such as TARGETS and
+		// UTF8_STRING, describe the selection rather than its contents.
+		if strings.Contains(f, "/") {
+			formats = append(formats, f)
+		}
+	}
+	return formats, nil
+}
+
+func (c command) Read(format string) ([]byte, error) {
+	args := c.read(format)
+	if args == nil {
+		return nil, ErrUnsupported
+	}
+	out, err := c.run(args, nil)
+	if err != nil {
+		return nil, err
+	}
+	if len(out) == 0 {
+		return nil, ErrEmpty
+	}
+	return out, nil
+}
+
+func (c command) Write(format string, data []byte) error {
+	args := c.write(format)
+	if args == nil {
+		return ErrUnsupported
 	}
-	
-	currentHash := fmt.Sprintf("%x", md5.Sum([]byte(content)))
-	
-	if currentHash != lastHash {
-		lastHash = currentHash
-		return true
+	_, err := c.run(args, data)
+	return err
+}
+
+func (c command) Watch(ctx context.Context, interval time.Duration) (<-chan struct{}, error) {
+	return poll(ctx, interval), nil
+}
+
+// run runs a tool, feeding it input when writing. The output of writes is
+// not collected: xclip stays in the background holding the selection.
+func (c command) run(args []string, input []byte) ([]byte, error) {
+	cmd := exec.Command(args[0], args[1:]...)
+	if input != nil {
+		cmd.Stdin = bytes.NewReader(input)
+		if err := cmd.Run(); err != nil {
+			return nil, fmt.Errorf("%s: %w", c.name, err)
+		}
+		return nil, nil
+	}
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		msg := strings.TrimSpace(stderr.String())
+		for _, empty := range c.empty {
+			if strings.Contains(msg, empty) {
+				return nil, ErrEmpty
+			}
+		}
+		if msg != "" {
+			return nil, fmt.Errorf("%s: %s", c.name, msg)
+		}
+		return nil, fmt.Errorf("%s: %w", c.name, err)
 	}
-	
-	return false
+	return out, nil
 }
@@ -1,41 +1,123 @@
 //go:build windows
+
 package clipboard
 
 import (
+	"context"
+	"errors"
 	"syscall"
+	"time"
 	"unsafe"
 )
 
+func init() {
+	backends["win32"] = func() (Backend, error) { return win32{}, nil }
+	backends["osc52"] = openOSC52
+	auto = []string{"native", "win32", "osc52"}
+}
+
 var (
 	user32           = syscall.NewLazyDLL("user32.dll")
 	kernel32         = syscall.NewLazyDLL("kernel32.dll")
 	openClipboard    = user32.NewProc("OpenClipboard")
 	closeClipboard   = user32.NewProc("CloseClipboard")
+	emptyClipboard   = user32.NewProc("EmptyClipboard")
 	getClipboardData = user32.NewProc("GetClipboardData")
+	setClipboardData = user32.NewProc("SetClipboardData")
+	globalAlloc      = kernel32.NewProc("GlobalAlloc")
+	globalFree       = kernel32.NewProc("GlobalFree")
 	globalLock       = kernel32.NewProc("GlobalLock")
 	globalUnlock     = kernel32.NewProc("GlobalUnlock")
 )
 
-const CF_UNICODETEXT = 13
+const (
+	CF_UNICODETEXT = 13
+	GMEM_MOVEABLE  = 0x0002
+)
+
+var errBusy = errors.New("clipboard is in use by another program")
+
+// win32 calls the clipboard API of Windows directly, for text only.
+type win32 struct{}
+
+func (win32) Name() string { return "win32" }
+
+func (w win32) Formats() ([]string, error) {
+	if _, err := w.Read(Text); err != nil {
+		return nil, ignoreEmpty(err)
+	}
+	return []string{Text}, nil
+}
 
-func Read() (string, error) {
+func (win32) Read(format string) ([]byte, error) {
+	if format != Text {
+		return nil, ErrUnsupported
+	}
 	r, _, _ := openClipboard.Call(0)
 	if r == 0 {
-		return "", nil
+		return nil, errBusy
 	}
 	defer closeClipboard.Call()
 
 	h, _, _ := getClipboardData.Call(CF_UNICODETEXT)
 	if h == 0 {
-		return "", nil
+		return nil, ErrEmpty
 	}
 
 	l, _, _ := globalLock.Call(h)
 	if l == 0 {
-		return "", nil
+		return nil, ErrEmpty
 	}
 	defer globalUnlock.Call(h)
 
-	text := syscall.UTF16ToString((*[1 << 20]uint16)(unsafe.Pointer(l))[:])
-	return text, nil
+	text := syscall.UTF16ToString((*[1 << 20]uint16)(pointer(l))[:])
+	if text == "" {
+		return nil, ErrEmpty
+	}
+	return []byte(text), nil
+}
+
+func (win32) Write(format string, data []byte) error {
+	if format != Text {
+		return ErrUnsupported
+	}
+	text, err := syscall.UTF16FromString(string(data))
+	if err != nil {
+		return err
+	}
+	r, _, _ := openClipboard.Call(0)
+	if r == 0 {
+		return errBusy
+	}
+	defer closeClipboard.Call()
+
+	emptyClipboard.Call()
+	size := uintptr(len(text)) * unsafe.Sizeof(text[0])
+	h, _, err := globalAlloc.Call(GMEM_MOVEABLE, size)
+	if h == 0 {
+		return err
+	}
+	l, _, err := globalLock.Call(h)
+	if l == 0 {
+		globalFree.Call(h)
+		return err
+	}
+	copy(unsafe.Slice((*uint16)(pointer(l)), len(text)), text)
+	globalUnlock.Call(h)
+
+	// The clipboard owns the memory once it has taken it.
+	if r, _, err := setClipboardData.Call(CF_UNICODETEXT, h); r == 0 {
+		globalFree.Call(h)
+		return err
+	}
+	return nil
+}
+
+func (win32) Watch(ctx context.Context, interval time.Duration) (<-chan struct{}, error) {
+	return poll(ctx, interval), nil
+}
+
+// pointer turns an address returned by a system call into a pointer.
+func pointer(addr uintptr) unsafe.Pointer {
+	return *(*unsafe.Pointer)(unsafe.Pointer(&addr))
 }
@@ -0,0 +1,299 @@
+package clipboard
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Fake is a clipboard kept in memory. Tests and replays set its contents
+// directly or play a Script on it; watchers are told about every change.
+type Fake struct {
+	mu       sync.Mutex
+	data     map[string][]byte
+	err      error
+	watchers []chan struct{}
+}
+
+func NewFake() *Fake {
+	return &Fake{data: map[string][]byte{}}
+}
+
+func openFake() (Backend, error) {
+	return NewFake(), nil
+}
+
+func (f *Fake) Name() string { return "fake" }
+
+func (f *Fake) Formats() ([]string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.err != nil {
+		return nil, f.err
+	}
+	formats := make([]string, 0, len(f.data))
+	for format := range f.data {
+		formats = append(formats, format)
+	}
+	sort.Strings(formats)
+	return formats, nil
+}
+
+func (f *Fake) Read(format string) ([]byte, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.err != nil {
+		return nil, f.err
+	}
+	data, ok := f.data[format]
+	if !ok {
+		return nil, ErrEmpty
+	}
+	return append([]byte(nil), data...), nil
+}
+
+// Write replaces the contents with data, as copying does.
+func (f *Fake) Write(format string, data []byte) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.err != nil {
+		return f.err
+	}
+	f.put(format, data)
+	return nil
+}
+
+func (f *Fake) Watch(ctx context.Context, interval time.Duration) (<-chan struct{}, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	// Like wl-paste --watch, start with what is on the clipboard already.
+	ch := make(chan struct{}, 1)
+	ch <- struct{}{}
+	f.watchers = append(f.watchers, ch)
+	go func() {
+		<-ctx.Done()
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		for i, w := range f.watchers {
+			if w == ch {
+				f.watchers = append(f.watchers[:i], f.watchers[i+1:]...)
+				break
+			}
+		}
+		close(ch)
+	}()
+	return ch, nil
+}
+
+// SetText copies text as another program would, even while failing.
+func (f *Fake) SetText(text string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.put(Text, []byte(text))
+}
+
+// SetImage copies a PNG image as another program would, even while
+// failing.
+func (f *Fake) SetImage(png []byte) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.put(PNG, png)
+}
+
+// Clear empties the clipboard.
+func (f *Fake) Clear() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.data = map[string][]byte{}
+	f.changed()
+}
+
+// Fail makes every read and write fail with err until Fail(nil).
+func (f *Fake) Fail(err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.err = err
+	f.changed()
+}
+
+// put replaces the contents. Callers must hold f.mu.
+func (f *Fake) put(format string, data []byte) {
+	f.data = map[string][]byte{format: append([]byte(nil), data...)}
+	f.changed()
+}
+
+// changed tells the watchers. Callers must hold f.mu.
+func (f *Fake) changed() {
+	for _, ch := range f.watchers {
+		notify(ch)
+	}
+}
+
+// Step is one change in a Script. Action is "text" or "image" to copy
+// Data, "clear" to empty the clipboard, "error" to make it fail with Err
+// and "ok" to stop failing. At is the time since the start of the script.
+type Step struct {
+	At     time.Duration
+	Action string
+	Data   []byte
+	Err    error
+}
+
+// Script is a sequence of clipboard changes in the order they happen.
+type Script []Step
+
+// Play carries out the steps of s at their times, calling then after each
+// one if it is not nil. It stops early when ctx is done.
+func (f *Fake) Play(ctx context.Context, s Script, then func(Step)) error {
+	start := time.Now()
+	for _, step := range s {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(time.Until(start.Add(step.At))):
+		}
+		if err := f.apply(step); err != nil {
+			return err
+		}
+		if then != nil {
+			then(step)
+		}
+	}
+	return nil
+}
+
+func (f *Fake) apply(step Step) error {
+	switch step.Action {
+	case "text":
+		f.SetText(string(step.Data))
+	case "image":
+		f.SetImage(step.Data)
+	case "clear":
+		f.Clear()
+	case "error":
+		f.Fail(step.Err)
+	case "ok":
+		f.Fail(nil)
+	default:
+		return fmt.Errorf("unknown action %q", step.Action)
+	}
+	return nil
+}
+
+// LoadScript reads a script file; see ParseScript. Images are looked for
+// next to it.
+func LoadScript(path string) (Script, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ParseScript(f, filepath.Dir(path))
+}
+
+// ParseScript reads a script with one step per line:
+//
+//	# comment
+//	0s     text hello
+//	+500ms text "two\nlines"
+//	2s     image screenshot.png
+//	+1s    clear
+//	+1s    error display went away
+//	+1s    ok
+//
+// Times count from the start, or from the step before with a leading +.
+// Text may be quoted as in Go. Image paths are relative to dir.
+func ParseScript(r io.Reader, dir string) (Script, error) {
+	var s Script
+	var at time.Duration
+	lines := bufio.NewScanner(r)
+	for n := 1; lines.Scan(); n++ {
+		line := strings.TrimSpace(lines.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		step, err := parseStep(line, at, dir)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", n, err)
+		}
+		at = step.At
+		s = append(s, step)
+	}
+	return s, lines.Err()
+}
+
+func parseStep(line string, prev time.Duration, dir string) (Step, error) {
+	when, rest := cutSpace(line)
+	if rest == "" {
+		return Step{}, errors.New("want a time and an action")
+	}
+	var step Step
+	d, err := time.ParseDuration(strings.TrimPrefix(when, "+"))
+	if err != nil {
+		return Step{}, err
+	}
+	step.At = d
+	if strings.HasPrefix(when, "+") {
+		step.At += prev
+	}
+	if step.At < prev {
+		return Step{}, fmt.Errorf("%s is before the step above", when)
+	}
+
+	action, arg := cutSpace(rest)
+	step.Action = action
+	switch action {
+	case "text":
+		if strings.HasPrefix(arg, `"`) {
+			if arg, err = strconv.Unquote(arg); err != nil {
+				return Step{}, fmt.Errorf("text: %w", err)
+			}
+		}
+		step.Data = []byte(arg)
+	case "image":
+		if arg == "" {
+			return Step{}, errors.New("image needs a file")
+		}
+		if !filepath.IsAbs(arg) {
+			arg = filepath.Join(dir, arg)
+		}
+		if step.Data, err = os.ReadFile(arg); err != nil {
+			return Step{}, err
+		}
+	case "error":
+		if arg == "" {
+			arg = "clipboard error"
+		}
+		step.Err = errors.New(arg)
+	case "clear", "ok":
+	default:
+		return Step{}, fmt.Errorf("unknown action %q", action)
+	}
+	return step, nil
+}
+
+// cutSpace splits s at its first run of spaces or tabs.
+func cutSpace(s string) (string, string) {
+	i := strings.IndexAny(s, " \t")
+	if i < 0 {
+		return s, ""
+	}
+	return s[:i], strings.TrimSpace(s[i:])
+}
@@ -0,0 +1,82 @@
+package clipboard
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseScript(t *testing.T) {
+	dir := t.TempDir()
+	png := []byte("\x89PNG\r\n\x1a\nscreenshot")
+	if err := os.WriteFile(filepath.Join(dir, "shot.png"), png, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	script, err := ParseScript(strings.NewReader(`
+# comment
+1s      text hello world
++500ms  text "two\nlines"
+2s	image shot.png
++1s     clear
++1s     error
++0s     error display went away
++1s     ok
+`), dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []struct {
+		at     time.Duration
+		action string
+		data   string
+		err    string
+	}{
+		{time.Second, "text", "hello world", ""},
+		{1500 * time.Millisecond, "text", "two\nlines", ""},
+		{2 * time.Second, "image", string(png), ""},
+		{3 * time.Second, "clear", "", ""},
+		{4 * time.Second, "error", "", "clipboard error"},
+		{4 * time.Second, "error", "", "display went away"},
+		{5 * time.Second, "ok", "", ""},
+	}
+	if len(script) != len(want) {
+		t.Fatalf("got %d steps, want %d", len(script), len(want))
+	}
+	for i, w := range want {
+		s := script[i]
+		msg := ""
+		if s.Err != nil {
+			msg = s.Err.Error()
+		}
+		if s.At != w.at || s.Action != w.action || string(s.Data) != w.data || msg != w.err {
+			t.Errorf("step %d = %v %s %q %q, want %v %s %q %q", i, s.At, s.Action, s.Data, msg, w.at, w.action, w.data, w.err)
+		}
+	}
+}
+
+func TestParseScriptErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		script string
+		err    string
+	}{
+		{"no action", "1s", "line 1: want a time and an action"},
+		{"bad time", "soon text hi", "line 1: time: invalid duration"},
+		{"unknown action", "1s paste", `line 1: unknown action "paste"`},
+		{"time going back", "2s clear\n1s clear", "line 2: 1s is before the step above"},
+		{"bad quoting", `1s text "open`, "line 1: text: invalid syntax"},
+		{"image without a file", "1s image", "line 1: image needs a file"},
+		{"missing image", "1s image gone.png", "line 1: open"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseScript(strings.NewReader(tt.script), t.TempDir())
+			if err == nil || !strings.HasPrefix(err.Error(), tt.err) {
+				t.Errorf("got %v, want %s", err, tt.err)
+			}
+		})
+	}
+}
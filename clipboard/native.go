@@ -0,0 +1,99 @@
+package clipboard
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.design/x/clipboard"
+)
+
+// native uses the platform's clipboard API through golang.design/x/clipboard:
+// X11 on Linux, NSPasteboard on macOS and the win32 clipboard on Windows.
+// It handles text and PNG images only.
+type native struct{}
+
+var initNative = sync.OnceValue(clipboard.Init)
+
+func openNative() (Backend, error) {
+	if err := initNative(); err != nil {
+		// The library follows its error with installation advice.
+		msg, _, _ := strings.Cut(err.Error(), "\n")
+		msg, _, _ = strings.Cut(msg, ", and")
+		return nil, errors.New(msg)
+	}
+	return native{}, nil
+}
+
+func (native) Name() string { return "native" }
+
+func (native) Formats() ([]string, error) {
+	var formats []string
+	if len(clipboard.Read(clipboard.FmtText)) > 0 {
+		formats = append(formats, Text)
+	}
+	if len(clipboard.Read(clipboard.FmtImage)) > 0 {
+		formats = append(formats, PNG)
+	}
+	return formats, nil
+}
+
+func (native) Read(format string) ([]byte, error) {
+	f, err := nativeFormat(format)
+	if err != nil {
+		return nil, err
+	}
+	data := clipboard.Read(f)
+	if len(data) == 0 {
+		return nil, ErrEmpty
+	}
+	return data, nil
+}
+
+func (native) Write(format string, data []byte) error {
+	f, err := nativeFormat(format)
+	if err != nil {
+		return err
+	}
+	clipboard.Write(f, data)
+	return nil
+}
+
+// Watch merges the text and image change events of the library.
+func (native) Watch(ctx context.Context, interval time.Duration) (<-chan struct{}, error) {
+	ch := make(chan struct{}, 1)
+	text := clipboard.Watch(ctx, clipboard.FmtText)
+	img := clipboard.Watch(ctx, clipboard.FmtImage)
+	go func() {
+		defer close(ch)
+		for text != nil || img != nil {
+			var ok bool
+			select {
+			case _, ok = <-text:
+				if !ok {
+					text = nil
+				}
+			case _, ok = <-img:
+				if !ok {
+					img = nil
+				}
+			}
+			if ok {
+				notify(ch)
+			}
+		}
+	}()
+	return ch, nil
+}
+
+func nativeFormat(format string) (clipboard.Format, error) {
+	switch format {
+	case Text:
+		return clipboard.FmtText, nil
+	case PNG:
+		return clipboard.FmtImage, nil
+	}
+	return 0, ErrUnsupported
+}
@@ -0,0 +1,184 @@
+package clipboard
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/aymanbagabas/go-osc52/v2"
+	"github.com/charmbracelet/x/term"
+)
+
+// osc52Backend asks the terminal to set its clipboard with the OSC 52 escape
+// sequence. It reaches the clipboard of the machine the terminal runs on,
+// so it works over SSH and in containers without a display.
+//
+// Reading means asking the terminal too, and its answer comes in with the
+// keys typed into the program; the clipboard is therefore not watched.
+type osc52Backend struct {
+	tty *os.File
+}
+
+// osc52Limit is the longest sequence sent. Many terminals drop longer
+// ones without a word, tmux and xterm among them.
+const osc52Limit = 100_000
+
+// osc52Timeout is how long a terminal gets to answer a query. Those that do
+// not support reading the clipboard never answer.
+const osc52Timeout = time.Second
+
+func openOSC52() (Backend, error) {
+	tty, err := os.OpenFile("/dev/tty", os.O_RDWR, 0)
+	if err != nil {
+		if !term.IsTerminal(os.Stdout.Fd()) {
+			return nil, errors.New("not running in a terminal")
+		}
+		tty = os.Stdout
+	}
+	return osc52Backend{tty: tty}, nil
+}
+
+func (osc52Backend) Name() string { return "osc52" }
+
+func (osc52Backend) Formats() ([]string, error) {
+	return []string{Text}, nil
+}
+
+// Read asks the terminal for its clipboard. It must not be used while
+// anything else reads from the terminal.
+func (o osc52Backend) Read(format string) ([]byte, error) {
+	if format != Text {
+		return nil, ErrUnsupported
+	}
+	if o.tty == os.Stdout {
+		// The answer would go to whatever reads the standard input.
+		return nil, ErrUnsupported
+	}
+	restore, err := rawMode(o.tty)
+	if err != nil {
+		return nil, err
+	}
+	defer restore()
+
+	if _, err := wrap(osc52.Query()).WriteTo(o.tty); err != nil {
+		return nil, err
+	}
+	if err := o.tty.SetReadDeadline(time.Now().Add(osc52Timeout)); err != nil {
+		return nil, err
+	}
+	defer o.tty.SetReadDeadline(time.Time{})
+	answer, err := readAnswer(o.tty)
+	if err != nil {
+		if errors.Is(err, os.ErrDeadlineExceeded) {
+			return nil, fmt.Errorf("the terminal does not answer OSC 52 queries: %w", ErrUnsupported)
+		}
+		return nil, err
+	}
+	data, err := parseAnswer(answer)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) == 0 {
+		return nil, ErrEmpty
+	}
+	return data, nil
+}
+
+func (o osc52Backend) Write(format string, data []byte) error {
+	seq, err := o.Sequence(format, data)
+	if err != nil {
+		return err
+	}
+	_, err = o.tty.Write(seq)
+	return err
+}
+
+// Sequence returns what Write would send to the terminal. Text that would
+// make it longer than terminals take is refused rather than cut short.
+func (osc52Backend) Sequence(format string, data []byte) ([]byte, error) {
+	if format != Text {
+		return nil, ErrUnsupported
+	}
+	if n := base64.StdEncoding.EncodedLen(len(data)); n > osc52Limit {
+		return nil, fmt.Errorf("%d bytes is too much to copy through the terminal, which takes about %d", len(data), osc52Limit/4*3)
+	}
+	return []byte(wrap(osc52.New(string(data))).String()), nil
+}
+
+func (osc52Backend) Watch(ctx context.Context, interval time.Duration) (<-chan struct{}, error) {
+	return nil, fmt.Errorf("osc52 cannot watch the clipboard, copies are not recorded: %w", ErrUnsupported)
+}
+
+// wrap passes seq through the terminal multiplexer the program runs in, so
+// that it reaches the terminal around it. tmux only lets it through with
+// allow-passthrough turned on.
+func wrap(seq osc52.Sequence) osc52.Sequence {
+	switch {
+	case os.Getenv("TMUX") != "":
+		return seq.Tmux()
+	case os.Getenv("STY") != "" || strings.HasPrefix(os.Getenv("TERM"), "screen"):
+		return seq.Screen()
+	}
+	return seq
+}
+
+// rawMode stops the terminal from echoing the answer and holding it back
+// until a line is complete. It leaves tty non-blocking, which File.Fd
+// would undo, so that reads can time out.
+func rawMode(tty *os.File) (restore func(), err error) {
+	conn, err := tty.SyscallConn()
+	if err != nil {
+		return nil, err
+	}
+	var state *term.State
+	cerr := conn.Control(func(fd uintptr) {
+		state, err = term.MakeRaw(fd)
+	})
+	if cerr != nil {
+		return nil, cerr
+	}
+	if err != nil {
+		return nil, err
+	}
+	return func() {
+		conn.Control(func(fd uintptr) { term.Restore(fd, state) })
+	}, nil
+}
+
+// readAnswer reads from the terminal up to the end of an OSC sequence,
+// which is BEL or ESC \.
+func readAnswer(r io.Reader) ([]byte, error) {
+	var answer []byte
+	buf := make([]byte, 4096)
+	for {
+		n, err := r.Read(buf)
+		answer = append(answer, buf[:n]...)
+		if bytes.HasSuffix(answer, []byte("\a")) || bytes.HasSuffix(answer, []byte("\x1b\\")) {
+			return answer, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// parseAnswer decodes the clipboard from an answer such as
+// ESC ] 52 ; c ; aGVsbG8= BEL.
+func parseAnswer(answer []byte) ([]byte, error) {
+	s := strings.TrimSuffix(strings.TrimSuffix(string(answer), "\a"), "\x1b\\")
+	i := strings.Index(s, "\x1b]52;")
+	if i < 0 {
+		return nil, errors.New("unexpected answer to OSC 52 query")
+	}
+	fields := strings.SplitN(s[i+len("\x1b]52;"):], ";", 2)
+	if len(fields) != 2 {
+		return nil, errors.New("unexpected answer to OSC 52 query")
+	}
+	return base64.StdEncoding.DecodeString(fields[1])
+}
@@ -0,0 +1,80 @@
+package clipboard
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/aymanbagabas/go-osc52/v2"
+)
+
+func TestWrap(t *testing.T) {
+	tests := []struct {
+		name, tmux, sty, term string
+		want                  string
+	}{
+		{"plain terminal", "", "", "xterm-256color", "\x1b]52;c;aGk=\a"},
+		{"tmux", "/tmp/tmux-0/default,1,0", "", "screen-256color", "\x1bPtmux;\x1b\x1b]52;c;aGk=\a\x1b\\"},
+		{"screen", "", "1234.pts-0.host", "screen", "\x1bP\x1b]52;c;aGk=\a\x1b\\"},
+		{"screen by TERM", "", "", "screen.xterm-256color", "\x1bP\x1b]52;c;aGk=\a\x1b\\"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("TMUX", tt.tmux)
+			t.Setenv("STY", tt.sty)
+			t.Setenv("TERM", tt.term)
+			if got := wrap(osc52.New("hi")).String(); got != tt.want {
+				t.Errorf("wrap = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseAnswer(t *testing.T) {
+	tests := []struct {
+		name   string
+		answer string
+		want   string
+		err    bool
+	}{
+		{"BEL", "\x1b]52;c;aGVsbG8=\a", "hello", false},
+		{"ESC backslash", "\x1b]52;c;aGVsbG8=\x1b\\", "hello", false},
+		{"keys typed before", "jk\x1b]52;c;aGVsbG8=\a", "hello", false},
+		{"empty clipboard", "\x1b]52;c;\a", "", false},
+		{"other sequence", "\x1b]11;rgb:0000/0000/0000\a", "", true},
+		{"no selection", "\x1b]52;aGVsbG8=\a", "", true},
+		{"bad base64", "\x1b]52;c;not base64!\a", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseAnswer([]byte(tt.answer))
+			if (err != nil) != tt.err {
+				t.Fatalf("err = %v, want error %v", err, tt.err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOSC52Sequence(t *testing.T) {
+	t.Setenv("TMUX", "")
+	t.Setenv("STY", "")
+	t.Setenv("TERM", "xterm")
+	var b osc52Backend
+	if _, err := b.Sequence(PNG, []byte("image")); err != ErrUnsupported {
+		t.Errorf("PNG: %v, want ErrUnsupported", err)
+	}
+	seq, err := b.Sequence(Text, []byte("hi"))
+	if err != nil || string(seq) != "\x1b]52;c;aGk=\a" {
+		t.Errorf("Sequence = %q, %v", seq, err)
+	}
+	fits := bytes.Repeat([]byte("a"), osc52Limit/4*3)
+	if _, err := b.Sequence(Text, fits); err != nil {
+		t.Errorf("%d bytes: %v", len(fits), err)
+	}
+	if _, err := b.Sequence(Text, append(fits, 'a')); err == nil || !strings.Contains(err.Error(), "too much") {
+		t.Errorf("%d bytes: %v, want it refused", len(fits)+1, err)
+	}
+}
@@ -2,38 +2,129 @@ package clipboard
 
 import (
 	"context"
+	"crypto/sha256"
+	"errors"
 	"time"
 )
 
+// Capture is new clipboard contents seen by a Watcher: an image as PNG, or
+// else text, with the selection it is from and the formats it offered.
+type Capture struct {
+	Text      string
+	Image     []byte
+	Selection string
+	Formats   []string
+}
+
 type Watcher struct {
-	lastContent string
-	interval    time.Duration
+	backend   Backend
+	interval  time.Duration
+	lastText  string
+	lastImage [sha256.Size]byte
+	lastErr   string
+	failing   bool
+
+	// Selection is the selection the backend reads, for Capture.
+	Selection string
+	// Settle is how long new text must stay unchanged before it is
+	// reported. It skips the text passed through while a selection is
+	// still being dragged out.
+	Settle time.Duration
+	// OnError is told when the clipboard cannot be read. An error is
+	// reported once until a read succeeds again.
+	OnError func(error)
 }
 
-func NewWatcher(interval time.Duration) *Watcher {
+// NewWatcher watches the clipboard through b, checking every interval if
+// b is not told about changes.
+func NewWatcher(b Backend, interval time.Duration) *Watcher {
 	return &Watcher{
-		interval: interval,
+		backend:   b,
+		interval:  interval,
+		Selection: Clipboard,
+	}
+}
+
+// Start calls onChange with each new text or image copied until ctx is
+// done.
+func (w *Watcher) Start(ctx context.Context, onChange func(Capture)) error {
+	changes, err := w.backend.Watch(ctx, w.interval)
+	if err != nil {
+		return err
 	}
+	for range changes {
+		w.Check(ctx, onChange)
+	}
+	return nil
 }
 
-func (w *Watcher) Start(ctx context.Context, onChange func(string)) {
-	ticker := time.NewTicker(w.interval)
-	defer ticker.Stop()
+// Check reads the clipboard once and calls onChange with what is new.
+func (w *Watcher) Check(ctx context.Context, onChange func(Capture)) {
+	w.failing = false
+	defer func() {
+		if !w.failing {
+			w.lastErr = ""
+		}
+	}()
+
+	formats, err := w.backend.Formats()
+	if w.failed(err) {
+		return
+	}
 
-	for {
+	data, err := w.backend.Read(PNG)
+	if !w.failed(err) && data != nil {
+		if sum := sha256.Sum256(data); sum != w.lastImage {
+			w.lastImage = sum
+			onChange(Capture{Image: data, Selection: w.Selection, Formats: formats})
+		}
+	}
+
+	data, err = w.backend.Read(Text)
+	if w.failed(err) || len(data) == 0 || string(data) == w.lastText {
+		return
+	}
+	text, ok := w.settle(ctx, string(data))
+	if ok && text != w.lastText {
+		w.lastText = text
+		onChange(Capture{Text: text, Selection: w.Selection, Formats: formats})
+	}
+}
+
+// settle reads the text again after Settle until it stops changing, and
+// reports false if it is gone by then.
+func (w *Watcher) settle(ctx context.Context, text string) (string, bool) {
+	for w.Settle > 0 {
 		select {
 		case <-ctx.Done():
-			return
-		case <-ticker.C:
-			current, err := Read()
-			if err != nil {
-				continue
-			}
-
-			if current != w.lastContent && current != "" && len(current) > 0 {
-				w.lastContent = current
-				onChange(current)
-			}
+			return "", false
+		case <-time.After(w.Settle):
+		}
+		again, err := ReadText(w.backend)
+		if w.failed(err) || again == "" {
+			return "", false
 		}
+		if again == text {
+			break
+		}
+		text = again
+	}
+	return text, true
+}
+
+// failed reports whether err stops a read, passing new errors to OnError.
+// An empty clipboard or a format the backend lacks is not reported.
+func (w *Watcher) failed(err error) bool {
+	switch {
+	case err == nil:
+		return false
+	case errors.Is(err, ErrEmpty), errors.Is(err, ErrUnsupported):
+		return true
+	}
+	w.failing = true
+	if err.Error() != w.lastErr && w.OnError != nil {
+		w.OnError(err)
 	}
+	w.lastErr = err.Error()
+	return true
 }
@@ -0,0 +1,95 @@
+//go:build !windows
+
+package clipboard
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"time"
+)
+
+// wayland uses wl-clipboard, which talks to the compositor directly and so
+// works without XWayland.
+type wayland struct {
+	command
+}
+
+func wlClipboard(selection string) command {
+	return command{
+		name:      "wayland",
+		selection: selection,
+		read: func(format string) []string {
+			if format == Text {
+				// "text" lets wl-paste pick whichever text type is offered.
+				format = "text"
+			}
+			return wlArgs("wl-paste", selection, "--no-newline", "--type", format)
+		},
+		// Left to itself wl-copy offers text under the usual text types
+		// (text/plain;charset=utf-8, UTF8_STRING, STRING, TEXT).
+		write: func(format string) []string {
+			if format == Text {
+				return wlArgs("wl-copy", selection)
+			}
+			return wlArgs("wl-copy", selection, "--type", format)
+		},
+		targets: wlArgs("wl-paste", selection, "--list-types"),
+		empty:   []string{"Nothing is copied", "No selection", "No suitable type"},
+	}
+}
+
+func wlArgs(tool, selection string, args ...string) []string {
+	if selection == Primary {
+		args = append([]string{"--primary"}, args...)
+	}
+	return append([]string{tool}, args...)
+}
+
+func openWayland() (Backend, error) {
+	if os.Getenv("WAYLAND_DISPLAY") == "" {
+		return nil, errors.New("WAYLAND_DISPLAY is not set")
+	}
+	for _, tool := range []string{"wl-paste", "wl-copy"} {
+		if _, err := exec.LookPath(tool); err != nil {
+			return nil, err
+		}
+	}
+	return wayland{wlClipboard(Clipboard)}, nil
+}
+
+func (w wayland) Primary() (Backend, error) {
+	return wayland{wlClipboard(Primary)}, nil
+}
+
+// Watch has wl-paste report every change. Compositors without the
+// data-control protocol, such as GNOME's, cannot be watched this way; the
+// clipboard is then checked every interval instead.
+func (w wayland) Watch(ctx context.Context, interval time.Duration) (<-chan struct{}, error) {
+	// The command is given the new contents on its input, which it must
+	// read for wl-paste to carry on.
+	args := wlArgs("wl-paste", w.selection, "--watch", "sh", "-c", "cat >/dev/null; echo")
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	out, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	ch := make(chan struct{}, 1)
+	go func() {
+		defer close(ch)
+		changes := bufio.NewScanner(out)
+		for changes.Scan() {
+			notify(ch)
+		}
+		cmd.Wait()
+		for range poll(ctx, interval) {
+			notify(ch)
+		}
+	}()
+	return ch, nil
+}
@@ -0,0 +1,203 @@
+//go:build !windows
+
+package clipboard
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// startCompositor runs a headless Wayland compositor for the test and points
+// WAYLAND_DISPLAY at it. The test is skipped unless wl-clipboard and sway or
+// weston are installed and the compositor comes up.
+func startCompositor(t *testing.T) {
+	t.Helper()
+	for _, tool := range []string{"wl-paste", "wl-copy"} {
+		if _, err := exec.LookPath(tool); err != nil {
+			t.Skipf("%s is not installed", tool)
+		}
+	}
+
+	runtime := t.TempDir()
+	var cmd *exec.Cmd
+	if _, err := exec.LookPath("sway"); err == nil {
+		cmd = exec.Command("sway", "-c", os.DevNull)
+		cmd.Env = append(os.Environ(), "WLR_BACKENDS=headless", "WLR_LIBINPUT_NO_DEVICES=1", "WLR_RENDERER=pixman")
+	} else if _, err := exec.LookPath("weston"); err == nil {
+		cmd = exec.Command("weston", "--backend=headless", "--socket=wayland-test")
+		cmd.Env = os.Environ()
+	} else {
+		t.Skip("no headless compositor: install sway or weston")
+	}
+	cmd.Env = append(cmd.Env, "XDG_RUNTIME_DIR="+runtime, "WAYLAND_DISPLAY=", "DISPLAY=")
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Start(); err != nil {
+		t.Skipf("%s: %v", cmd.Path, err)
+	}
+	exited := make(chan struct{})
+	go func() {
+		cmd.Wait()
+		close(exited)
+	}()
+	t.Cleanup(func() {
+		cmd.Process.Kill()
+		<-exited
+	})
+
+	deadline := time.After(10 * time.Second)
+	for {
+		sockets, _ := filepath.Glob(filepath.Join(runtime, "wayland-*"))
+		for _, s := range sockets {
+			if !strings.HasSuffix(s, ".lock") {
+				t.Setenv("XDG_RUNTIME_DIR", runtime)
+				t.Setenv("WAYLAND_DISPLAY", filepath.Base(s))
+				return
+			}
+		}
+		select {
+		case <-exited:
+			t.Skipf("%s exited: %s", filepath.Base(cmd.Path), lastLine(stderr.String()))
+		case <-deadline:
+			t.Skipf("%s did not create a socket", filepath.Base(cmd.Path))
+		case <-time.After(50 * time.Millisecond):
+		}
+	}
+}
+
+func lastLine(s string) string {
+	lines := strings.Split(strings.TrimSpace(s), "\n")
+	return lines[len(lines)-1]
+}
+
+// waitChange fails the test unless ch signals within a few seconds.
+func waitChange(t *testing.T, ch <-chan struct{}, after string) {
+	t.Helper()
+	select {
+	case _, ok := <-ch:
+		if !ok {
+			t.Fatalf("watch stopped %s", after)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("no change reported %s", after)
+	}
+}
+
+func TestWayland(t *testing.T) {
+	startCompositor(t)
+	b, err := openWayland()
+	if err != nil {
+		t.Fatal(err)
+	}
+	png := []byte("\x89PNG\r\n\x1a\nnot really an image")
+
+	tests := []struct {
+		name   string
+		format string
+		data   []byte
+		// text is whether the contents can also be read as text.
+		text bool
+	}{
+		{"text", Text, []byte("copied on wayland"), true},
+		{"unicode text", Text, []byte("naïve – ✂️\nsecond line"), true},
+		{"image", PNG, png, false},
+		{"html", "text/html", []byte("<b>bold</b>"), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := b.Write(tt.format, tt.data); err != nil {
+				t.Fatal(err)
+			}
+			got, err := b.Read(tt.format)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, tt.data) {
+				t.Errorf("Read(%s) = %q, want %q", tt.format, got, tt.data)
+			}
+
+			formats, err := b.Formats()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !slices.ContainsFunc(formats, func(f string) bool { return strings.HasPrefix(f, tt.format) }) {
+				t.Errorf("--list-types gave %q, want %s among them", formats, tt.format)
+			}
+			if tt.format == Text && !slices.Contains(formats, "UTF8_STRING") {
+				t.Errorf("--list-types gave %q, want the usual text types", formats)
+			}
+
+			_, err = b.Read(Text)
+			if tt.text && err != nil {
+				t.Errorf("Read(text): %v", err)
+			}
+			if !tt.text && !errors.Is(err, ErrEmpty) {
+				t.Errorf("Read(text) of %s: %v, want ErrEmpty", tt.format, err)
+			}
+		})
+	}
+
+	t.Run("watch", func(t *testing.T) {
+		// Only compositors with the data-control protocol can be watched;
+		// wl-paste gives up right away on the others.
+		probe := exec.Command("wl-paste", "--watch", "true")
+		if err := probe.Start(); err != nil {
+			t.Fatal(err)
+		}
+		done := make(chan error, 1)
+		go func() { done <- probe.Wait() }()
+		select {
+		case err := <-done:
+			t.Skipf("wl-paste --watch is not supported by this compositor: %v", err)
+		case <-time.After(time.Second):
+			probe.Process.Kill()
+			<-done
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		// With an hour between polls, every change seen must come from
+		// wl-paste --watch.
+		ch, err := b.Watch(ctx, time.Hour)
+		if err != nil {
+			t.Fatal(err)
+		}
+		waitChange(t, ch, "for the current contents")
+
+		for _, text := range []string{"first", "second", "third"} {
+			time.Sleep(100 * time.Millisecond)
+			for drained := false; !drained; {
+				select {
+				case <-ch:
+				default:
+					drained = true
+				}
+			}
+			if err := b.Write(Text, []byte(text)); err != nil {
+				t.Fatal(err)
+			}
+			waitChange(t, ch, "after copying "+text)
+		}
+
+		cancel()
+		deadline := time.After(5 * time.Second)
+		for {
+			select {
+			case _, ok := <-ch:
+				if !ok {
+					return
+				}
+			case <-deadline:
+				t.Fatal("watch went on after its context was cancelled")
+			}
+		}
+	})
+}
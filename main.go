@@ -2,32 +2,251 @@ package main
 
 import (
 	"context"
+	"errors"
+	"flag"
 	"fmt"
 	"log"
+	"math"
 	"os"
 	"os/signal"
+	"path/filepath"
+	"strings"
 	"syscall"
 	"time"
 
 	"clipboard_manager/clipboard"
+	"clipboard_manager/paths"
+	"clipboard_manager/profile"
 	"clipboard_manager/storage"
 	"clipboard_manager/ui"
 
 	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/x/term"
 )
 
 func main() {
-	if err := clipboard.Init(); err != nil {
+	backend := flag.String("store", "sqlite", "history backend: sqlite, json or memory")
+	dataDir := flag.String("data-dir", "", "where histories, images and backups are kept (default $XDG_DATA_HOME/"+paths.App+")")
+	configDir := flag.String("config-dir", "", "where profile settings are read from (default $XDG_CONFIG_HOME/"+paths.App+")")
+	cacheDir := flag.String("cache-dir", "", "where the log is written (default $XDG_CACHE_HOME/"+paths.App+")")
+	profileName := flag.String("profile", profile.Default, "the profile to open; a new name creates it")
+	dryRun := flag.Bool("migrate-dry-run", false, "report the migrations the store needs and exit")
+	maxEntries := flag.Int("max-entries", 1000, "keep at most this many unpinned entries (0 for no limit)")
+	maxAge := flag.String("max-age", "", "drop unpinned entries older than this, e.g. 90d or 72h")
+	maxBytes := flag.Int64("max-bytes", 0, "keep text and images below this many bytes (0 for no limit)")
+	categoryLimits := flag.String("category-limits", "", "per-category limits, e.g. url=30d,image=7d/50")
+	trashFor := flag.String("trash-for", "7d", "how long deleted entries can be restored (0 to keep until emptied)")
+	largeText := flag.Int("large-text", storage.DefaultLargeText, "store texts longer than this many bytes compressed outside the history")
+	pruneEvery := flag.Duration("prune-interval", time.Hour, "how often retention limits are applied")
+	encrypt := flag.Bool("encrypt", false, "encrypt the history with a passphrase ("+passphraseEnv+" or prompted)")
+	keyFile := flag.String("keyfile", "", "encrypt the history with the contents of this file")
+	rotateKey := flag.Bool("rotate-key", false, "change the passphrase or key file of an encrypted store and exit")
+	newKeyFile := flag.String("new-keyfile", "", "with -rotate-key, the key file to switch to instead of a new passphrase")
+	backupDir := flag.String("backup-dir", "clipboard_backups", "where snapshots of the history are kept")
+	backupEvery := flag.Duration("backup-interval", 6*time.Hour, "how often a snapshot is taken (0 to turn off)")
+	backupKeep := flag.Int("backup-keep", 10, "keep at most this many snapshots (0 for no limit)")
+	backupMaxAge := flag.String("backup-max-age", "30d", "delete snapshots older than this (0 for no limit)")
+	listBackups := flag.Bool("list-backups", false, "list and verify the snapshots and exit")
+	restoreBackup := flag.String("restore-backup", "", "restore the history from this snapshot and exit")
+	clipboardName := flag.String("clipboard", "auto", "how to reach the clipboard: auto or one of "+strings.Join(clipboard.Names(), ", "))
+	capturePrimary := flag.Bool("primary", false, "also record text highlighted with the mouse (the X11 or Wayland primary selection)")
+	primarySettle := flag.Duration("primary-settle", time.Second, "how long a highlighted text must stay the same before it is recorded")
+	replay := flag.String("replay", "", "play the clipboard changes in this script instead of watching the clipboard, into a scratch history unless -store is given")
+	repl := flag.Bool("repl", false, "use a line-based command prompt instead of the full-screen TUI")
+	replayExit := flag.Bool("replay-exit", false, "with -replay, record the script without the TUI, print the entries it recorded and exit")
+	flag.Parse()
+
+	// Flags given on the command line win over the profile's settings.
+	explicit := map[string]bool{}
+	flag.Visit(func(f *flag.Flag) { explicit[f.Name] = true })
+
+	// A replay records into a scratch history that is thrown away at exit,
+	// unless -store asks for a real one.
+	scratch := *replay != "" && !explicit["store"]
+	if scratch {
+		tmp, err := os.MkdirTemp("", paths.App+"-replay-")
+		if err != nil {
+			log.Fatalf("Failed to create a scratch directory: %v", err)
+		}
+		defer os.RemoveAll(tmp)
+		*dataDir, *backend = tmp, "memory"
+	}
+
+	dirs, err := paths.Resolve(paths.Dirs{Data: *dataDir, Config: *configDir, Cache: *cacheDir})
+	if err != nil {
+		log.Fatalf("Failed to find data directory: %v", err)
+	}
+	if err := dirs.Create(); err != nil {
+		log.Fatalf("Failed to create data directory: %v", err)
+	}
+	// Older versions kept everything in the directory they were started
+	// from. A scratch directory is no place to move them to.
+	if scratch {
+		// Nothing to migrate.
+	} else if m, err := paths.MigrateLegacy(".", dirs); err != nil {
+		log.Printf("⚠️  Old history not migrated: %v", err)
+	} else if m != nil {
+		log.Printf("📦 %s (%s)", m, dirs.Data)
+	}
+	legacy, err := paths.LoadMigration(dirs)
+	if err != nil {
+		log.Fatalf("Failed to read migration record: %v", err)
+	}
+
+	prof, err := profile.Create(dirs, *profileName)
+	if err != nil {
+		log.Fatalf("Failed to open profile: %v", err)
+	}
+
+	retention := storage.RetentionPolicy{MaxEntries: *maxEntries, MaxBytes: *maxBytes}
+	if *maxAge != "" {
+		age, err := storage.ParseAge(*maxAge)
+		if err != nil {
+			log.Fatalf("Invalid -max-age: %v", err)
+		}
+		retention.MaxAge = age
+	}
+	keep, err := storage.ParseAge(*trashFor)
+	if err != nil {
+		log.Fatalf("Invalid -trash-for: %v", err)
+	}
+	retention.TrashFor = keep
+	limits, err := storage.ParseCategoryLimits(*categoryLimits)
+	if err != nil {
+		log.Fatalf("Invalid -category-limits: %v", err)
+	}
+	retention.Categories = limits
+
+	backups := storage.BackupPolicy{Dir: prof.Path(*backupDir), Interval: *backupEvery, Keep: *backupKeep}
+	if backups.MaxAge, err = storage.ParseAge(*backupMaxAge); err != nil {
+		log.Fatalf("Invalid -backup-max-age: %v", err)
+	}
+
+	header := keyHeaderPath(prof, *backend)
+	src, err := keySource(header, *encrypt, *keyFile)
+	if err != nil {
+		log.Fatalf("Failed to read key: %v", err)
+	}
+
+	if *rotateKey {
+		if err := rotate(header, src, *newKeyFile); err != nil {
+			log.Fatalf("Failed to rotate key: %v", err)
+		}
+		fmt.Println("🔑 Key changed for", header)
+		return
+	}
+
+	var opts []storage.Option
+	if src != nil {
+		if header == "" {
+			log.Fatalf("The %s store cannot be encrypted", *backend)
+		}
+		key, err := storage.UnlockKey(header, *src)
+		if err != nil {
+			log.Fatalf("Failed to unlock %s: %v", header, err)
+		}
+		opts = append(opts, storage.WithKey(key))
+	}
+
+	if *listBackups {
+		if err := printBackups(backups.Dir, opts...); err != nil {
+			log.Fatalf("Failed to list backups: %v", err)
+		}
+		return
+	}
+	if *restoreBackup != "" {
+		if err := restoreFromBackup(prof, *backend, backups.Dir, *restoreBackup, legacy, *largeText, opts...); err != nil {
+			log.Fatalf("Failed to restore %s: %v", *restoreBackup, err)
+		}
+		fmt.Println("♻️  Restored history from", *restoreBackup)
+		return
+	}
+
+	if *dryRun {
+		report, err := planMigration(prof, *backend, opts...)
+		if err != nil {
+			log.Fatalf("Failed to check migrations: %v", err)
+		}
+		fmt.Println(report)
+		return
+	}
+
+	var cb clipboard.Backend
+	var fake *clipboard.Fake
+	var script clipboard.Script
+	if *replay != "" {
+		if script, err = clipboard.LoadScript(*replay); err != nil {
+			log.Fatalf("Failed to read %s: %v", *replay, err)
+		}
+		fake = clipboard.NewFake()
+		cb = fake
+	} else if *replayExit {
+		log.Fatalf("-replay-exit needs a script given with -replay")
+	} else if cb, err = openClipboard(*clipboardName); err != nil {
 		log.Fatalf("Failed to initialize clipboard: %v", err)
 	}
+	log.Printf("📋 Clipboard: %s", cb.Name())
+	watchers := []*clipboard.Watcher{clipboard.NewWatcher(cb, 500*time.Millisecond)}
+	if *capturePrimary {
+		sel, err := clipboard.OpenPrimary(cb)
+		if err != nil {
+			log.Fatalf("Failed to open the primary selection: %v", err)
+		}
+		log.Printf("📋 Primary selection: %s", sel.Name())
+		w := clipboard.NewWatcher(sel, 500*time.Millisecond)
+		w.Selection = clipboard.Primary
+		w.Settle = *primarySettle
+		watchers = append(watchers, w)
+	}
 
-	db, err := storage.NewDatabase("clipboard_history.json")
+	// Every profile opened in this session uses the key given at startup;
+	// profiles that are not encrypted yet are encrypted with it.
+	open := func(p profile.Profile, c profile.Config) (*storage.Database, error) {
+		return openProfile(p, c, *backend, src, retention, explicit, legacy, *largeText)
+	}
+	status := make(chan string, 16)
+	start := func(ctx context.Context, p profile.Profile, db *storage.Database) {
+		go db.StartPruner(ctx, *pruneEvery, func(report storage.PruneReport, err error) {
+			if err != nil {
+				status <- "⚠️ Prune failed: " + err.Error()
+			} else if !report.Empty() {
+				status <- "🧹 " + report.String()
+			}
+		})
+		if *backend != "memory" && backups.Interval > 0 {
+			policy := backups
+			if !filepath.IsAbs(*backupDir) {
+				policy.Dir = p.Path(*backupDir)
+			}
+			go db.StartBackups(ctx, policy, func(b storage.Backup, removed []storage.Backup, err error) {
+				if err != nil {
+					status <- "⚠️ Backup failed: " + err.Error()
+				} else {
+					status <- fmt.Sprintf("💾 Backed up %s, rotated out %d", b.Name, len(removed))
+				}
+			})
+		}
+	}
+
+	profiles := profile.NewManager(dirs, open, start)
+	db, err := profiles.Switch(prof.Name)
 	if err != nil {
 		log.Fatalf("Failed to initialize database: %v", err)
 	}
-	defer db.Close()
+	defer profiles.Close()
+	if db.Migration() != nil {
+		log.Println(db.Migration())
+	}
 
-	os.MkdirAll("clipboard_images", 0755)
+	if scratch {
+		log.Printf("🎬 Replaying into a scratch history; add -store to record into profile %s", prof.Name)
+	}
+	if *replayExit {
+		if err := replayHeadless(fake, script, watchers, profiles.Store); err != nil {
+			log.Fatalf("Replay failed: %v", err)
+		}
+		return
+	}
 
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
@@ -35,55 +254,416 @@ func main() {
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
 
-	p := ui.NewProgram(db)
+	// The prompt stays on the profile it was started with; switching
+	// profiles is only offered by the TUI.
+	var prompt *ui.Terminal
+	var p *tea.Program
+	if *repl {
+		prompt = ui.NewTerminal(db, backups.Dir)
+		go func() {
+			for msg := range status {
+				prompt.Notify(msg)
+			}
+		}()
+		go func() {
+			<-sigChan
+			cancel()
+		}()
+	} else {
+		p = ui.NewProgram(db, profiles, cb)
+		go func() {
+			for msg := range status {
+				p.Send(ui.StatusMsg(msg))
+			}
+		}()
+	}
+
+	status <- "📋 Watching the clipboard with " + cb.Name()
+	for _, w := range watchers {
+		w.OnError = func(err error) {
+			status <- fmt.Sprintf("⚠️ Reading the %s: %v", w.Selection, err)
+		}
+	}
+	record := recordCapture(func() storage.Recorder { return profiles.Store() }, func(err error) {
+		status <- "❌ Not recorded: " + err.Error()
+	})
+	if fake == nil {
+		for _, w := range watchers {
+			go startEnhancedWatcher(ctx, w, record, status)
+		}
+	} else {
+		go func() {
+			err := playScript(ctx, fake, script, watchers, record)
+			if err != nil && ctx.Err() == nil {
+				status <- "❌ Replay failed: " + err.Error()
+			} else if err == nil {
+				status <- fmt.Sprintf("🎬 Replayed %d steps from %s", len(script), *replay)
+			}
+			// Entries copied back from the TUI afterwards are recorded as
+			// usual.
+			for _, w := range watchers {
+				go startEnhancedWatcher(ctx, w, record, status)
+			}
+		}()
+	}
 
-	go startEnhancedWatcher(ctx, db, p)
+	if prompt != nil {
+		prompt.Run(ctx)
+		cancel()
+		return
+	}
 
-	if _, err := p.Run(); err != nil {
+	// Anything logged while the TUI is up would garble the screen.
+	if f, err := os.OpenFile(filepath.Join(dirs.Cache, "clipboard_manager.log"), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600); err == nil {
+		log.SetOutput(f)
+		defer f.Close()
+	}
+	_, err = p.Run()
+	log.SetOutput(os.Stderr)
+	if err != nil {
 		log.Printf("UI error: %v", err)
 	}
 
 	cancel()
 }
 
-func startEnhancedWatcher(ctx context.Context, db *storage.Database, p *tea.Program) {
-	ticker := time.NewTicker(500 * time.Millisecond)
-	defer ticker.Stop()
+// openProfile opens the store of a profile with the key given at startup
+// and applies the profile's settings over the flags.
+func openProfile(p profile.Profile, c profile.Config, backend string, src *storage.KeySource, base storage.RetentionPolicy, fixed map[string]bool, legacy *paths.Migration, largeText int) (*storage.Database, error) {
+	retention, err := c.Retention(base, fixed)
+	if err != nil {
+		return nil, err
+	}
 
-	var lastText string
-	var lastImageHash string
+	var opts []storage.Option
+	header := keyHeaderPath(p, backend)
+	if src != nil && header != "" {
+		key, err := storage.UnlockKey(header, *src)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, storage.WithKey(key))
+	} else if header != "" && storage.KeyHeaderExists(header) {
+		return nil, fmt.Errorf("profile is encrypted, restart with -profile %s to unlock it", p.Name)
+	}
 
-	for {
-		select {
-		case <-ctx.Done():
-			return
-		case <-ticker.C:
-			if clipboard.HasImage() {
-				imageHash, _ := clipboard.GetImageAsBase64()
-				if imageHash != lastImageHash && imageHash != "" {
-					lastImageHash = imageHash
-					filename := fmt.Sprintf("clipboard_images/img_%d.png", time.Now().Unix())
-					if err := clipboard.SaveImageToFile(filename); err == nil {
-						db.AddImageEntry(filename)
-						p.Send(ui.StatusMsg("🖼️ Saved image: " + filename))
-					}
+	db, err := openStore(p, backend, opts...)
+	if err != nil {
+		return nil, err
+	}
+	if err := setImageDir(db, p, legacy); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("image directory: %w", err)
+	}
+	if err := db.SetTextDir(p.Path("clipboard_texts"), largeText); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("text directory: %w", err)
+	}
+	if err := db.SetIgnoreRules(c.Ignore); err != nil {
+		db.Close()
+		return nil, err
+	}
+	db.SetRetention(retention)
+	return db, nil
+}
+
+func openStore(p profile.Profile, backend string, opts ...storage.Option) (*storage.Database, error) {
+	switch backend {
+	case "sqlite":
+		return storage.NewSQLiteDatabase(p.Path("clipboard.db"), p.Path("clipboard_history.json"), opts...)
+	case "json":
+		return storage.NewDatabase(p.Path("clipboard_history.json"), opts...)
+	case "memory":
+		return storage.NewMemoryStore(), nil
+	default:
+		return nil, fmt.Errorf("unknown store %q", backend)
+	}
+}
+
+func planMigration(p profile.Profile, backend string, opts ...storage.Option) (*storage.MigrationReport, error) {
+	switch backend {
+	case "sqlite":
+		return storage.PlanSQLiteMigration(p.Path("clipboard.db"))
+	case "json":
+		return storage.PlanMigration(p.Path("clipboard_history.json"), opts...)
+	default:
+		return nil, fmt.Errorf("store %q has nothing to migrate", backend)
+	}
+}
+
+// storeFiles are the files that make up a store on disk.
+func storeFiles(p profile.Profile, backend string) []string {
+	var names []string
+	switch backend {
+	case "sqlite":
+		names = []string{"clipboard.db", "clipboard.db-wal", "clipboard.db-shm"}
+	case "json":
+		names = []string{"clipboard_history.json", "clipboard_history.json.journal", "clipboard_history.json.journal.compact"}
+	}
+	for i, name := range names {
+		names[i] = p.Path(name)
+	}
+	return names
+}
+
+func printBackups(dir string, opts ...storage.Option) error {
+	list, err := storage.ListBackups(dir)
+	if err != nil {
+		return err
+	}
+	if len(list) == 0 {
+		fmt.Println("No backups in", dir)
+		return nil
+	}
+	for _, b := range list {
+		status := "✅"
+		if err := storage.VerifyBackup(b.Path, opts...); err != nil {
+			status = "❌ " + err.Error()
+		}
+		fmt.Printf("%s  %s  %s\n", b, b.Created.Format("2006-01-02 15:04"), status)
+	}
+	return nil
+}
+
+// restoreFromBackup restores a snapshot given by name or path. A store too
+// damaged to open is moved aside first, so the backup is restored into a
+// fresh one. A store that another instance has open is left alone.
+func restoreFromBackup(p profile.Profile, backend, dir, name string, legacy *paths.Migration, largeText int, opts ...storage.Option) error {
+	path := name
+	if _, err := os.Stat(path); err != nil {
+		path = filepath.Join(dir, name)
+	}
+	if err := storage.VerifyBackup(path, opts...); err != nil {
+		return err
+	}
+
+	db, err := openStore(p, backend, opts...)
+	if errors.Is(err, storage.ErrLocked) {
+		return fmt.Errorf("profile %s is in use, quit the running clipboard manager first: %w", p.Name, err)
+	}
+	if err != nil {
+		suffix := ".broken-" + time.Now().Format("20060102-150405")
+		for _, f := range storeFiles(p, backend) {
+			if _, statErr := os.Stat(f); statErr == nil {
+				if err := os.Rename(f, f+suffix); err != nil {
+					return err
 				}
+				log.Printf("Moved unreadable %s to %s", f, f+suffix)
 			}
+		}
+		if db, err = openStore(p, backend, opts...); err != nil {
+			return err
+		}
+	}
+	defer db.Close()
 
-			text, err := clipboard.ReadText()
-			if err != nil {
-				continue
-			}
+	if err := setImageDir(db, p, legacy); err != nil {
+		return err
+	}
+	if err := db.SetTextDir(p.Path("clipboard_texts"), largeText); err != nil {
+		return err
+	}
+	return db.RestoreBackup(path)
+}
 
-			if text != lastText && text != "" {
-				lastText = text
-				db.AddEntry(text)
-				preview := text
-				if len(preview) > 60 {
-					preview = preview[:60] + "..."
-				}
-				p.Send(ui.StatusMsg("✓ Saved: " + preview))
+// setImageDir keeps the profile's images in its data directory. Entries
+// recorded before the files were migrated there still carry paths relative
+// to the directory the manager used to be started from; they are pointed
+// at the new location first.
+func setImageDir(db *storage.Database, p profile.Profile, legacy *paths.Migration) error {
+	dir := p.Path("clipboard_images")
+	if legacy != nil {
+		old := "clipboard_images"
+		if p.Name != profile.Default {
+			old = filepath.Join("profiles", p.Name, old)
+		}
+		for _, from := range []string{old, filepath.Join(legacy.From, old)} {
+			if _, err := db.RelocateImages(from, dir); err != nil {
+				return err
 			}
 		}
 	}
+	return db.SetImageDir(dir)
+}
+
+const passphraseEnv = "CLIPBOARD_PASSPHRASE"
+
+// keyHeaderPath is where the key header of a store lives, or "" for stores
+// that are never written to disk.
+func keyHeaderPath(p profile.Profile, backend string) string {
+	switch backend {
+	case "sqlite":
+		return p.Path("clipboard.db.key")
+	case "json":
+		return p.Path("clipboard_history.json.key")
+	default:
+		return ""
+	}
+}
+
+// keySource works out how to unlock the store. A store that already has a
+// key header always needs one, even without -encrypt.
+func keySource(header string, encrypt bool, keyFile string) (*storage.KeySource, error) {
+	if keyFile != "" {
+		return &storage.KeySource{KeyFile: keyFile}, nil
+	}
+	if !encrypt && (header == "" || !storage.KeyHeaderExists(header)) {
+		return nil, nil
+	}
+	if pass := os.Getenv(passphraseEnv); pass != "" {
+		return &storage.KeySource{Passphrase: pass}, nil
+	}
+	pass, err := readPassphrase("Passphrase: ")
+	if err != nil {
+		return nil, err
+	}
+	if header != "" && !storage.KeyHeaderExists(header) {
+		confirm, err := readPassphrase("Repeat passphrase: ")
+		if err != nil {
+			return nil, err
+		}
+		if confirm != pass {
+			return nil, fmt.Errorf("passphrases do not match")
+		}
+	}
+	return &storage.KeySource{Passphrase: pass}, nil
+}
+
+func rotate(header string, old *storage.KeySource, newKeyFile string) error {
+	if old == nil || header == "" || !storage.KeyHeaderExists(header) {
+		return fmt.Errorf("store is not encrypted")
+	}
+	next := storage.KeySource{KeyFile: newKeyFile}
+	if newKeyFile == "" {
+		pass, err := readPassphrase("New passphrase: ")
+		if err != nil {
+			return err
+		}
+		confirm, err := readPassphrase("Repeat new passphrase: ")
+		if err != nil {
+			return err
+		}
+		if confirm != pass {
+			return fmt.Errorf("passphrases do not match")
+		}
+		next.Passphrase = pass
+	}
+	return storage.RotateKey(header, *old, next)
+}
+
+func readPassphrase(prompt string) (string, error) {
+	fmt.Fprint(os.Stderr, prompt)
+	pass, err := term.ReadPassword(os.Stdin.Fd())
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return "", err
+	}
+	if len(pass) == 0 {
+		return "", fmt.Errorf("empty passphrase")
+	}
+	return string(pass), nil
+}
+
+// openClipboard starts the clipboard backend called name, or with "auto"
+// the first that works here, logging why the others did not.
+func openClipboard(name string) (clipboard.Backend, error) {
+	if name != "auto" {
+		return clipboard.Open(name)
+	}
+	cb, failed := clipboard.Auto()
+	for _, err := range failed {
+		log.Printf("📋 Skipped %v", err)
+	}
+	if cb == nil {
+		return nil, fmt.Errorf("no clipboard backend works here; choose one with -clipboard")
+	}
+	return cb, nil
+}
+
+// startEnhancedWatcher hands the changes w sees to record.
+func startEnhancedWatcher(ctx context.Context, w *clipboard.Watcher, record func(clipboard.Capture), status chan<- string) {
+	if err := w.Start(ctx, record); err != nil {
+		status <- "❌ Clipboard watch failed: " + err.Error()
+	}
+}
+
+// recordCapture adds what a watcher saw to the store returned by store,
+// which changes when another profile is opened. Captures the profile's
+// ignore rules turn away are skipped; any other failure goes to onError.
+func recordCapture(store func() storage.Recorder, onError func(error)) func(clipboard.Capture) {
+	return func(c clipboard.Capture) {
+		db := store()
+		if db == nil {
+			return
+		}
+		src := storage.Source{Selection: c.Selection, MIMETypes: c.Formats}
+		var err error
+		if c.Image != nil {
+			err = db.AddImageFrom(c.Image, src)
+		} else {
+			err = db.AddEntryFrom(c.Text, src)
+		}
+		if err != nil && !errors.Is(err, storage.ErrIgnored) {
+			onError(err)
+		}
+	}
+}
+
+// playScript plays script on fake and reads the clipboard after every
+// step, so that each copy is recorded however quickly the next one follows.
+func playScript(ctx context.Context, fake *clipboard.Fake, script clipboard.Script, watchers []*clipboard.Watcher, record func(clipboard.Capture)) error {
+	return fake.Play(ctx, script, func(clipboard.Step) {
+		for _, w := range watchers {
+			w.Check(ctx, record)
+		}
+	})
+}
+
+// replayHeadless plays a script without the TUI and prints the entries it
+// recorded.
+func replayHeadless(fake *clipboard.Fake, script clipboard.Script, watchers []*clipboard.Watcher, store func() storage.Store) error {
+	for _, w := range watchers {
+		w.OnError = func(err error) {
+			log.Printf("⚠️ Reading the %s: %v", w.Selection, err)
+		}
+	}
+	var recordErr error
+	record := recordCapture(func() storage.Recorder { return store() }, func(err error) {
+		if recordErr == nil {
+			recordErr = err
+		}
+	})
+	start := time.Now()
+	if err := playScript(context.Background(), fake, script, watchers, record); err != nil {
+		return err
+	}
+	if recordErr != nil {
+		return fmt.Errorf("recording the clipboard: %w", recordErr)
+	}
+
+	entries, err := store().GetRecent(math.MaxInt)
+	if err != nil {
+		return err
+	}
+	// The store may be a real profile with a history of its own; only
+	// what the script copied is of interest.
+	var recorded []storage.ClipboardEntry
+	for _, e := range entries {
+		if !e.LastUsed.Before(start) {
+			recorded = append(recorded, e)
+		}
+	}
+	fmt.Printf("🎬 Replayed %d steps, recording %d entries\n", len(script), len(recorded))
+	for _, e := range recorded {
+		if e.IsImage {
+			fmt.Printf("[%d] image %dx%d %s", e.ID, e.Width, e.Height, e.Format)
+		} else {
+			fmt.Printf("[%d] %q", e.ID, e.Text)
+		}
+		if e.CopyCount > 1 {
+			fmt.Printf(" (copied %d times)", e.CopyCount)
+		}
+		fmt.Println()
+	}
+	return nil
 }
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"clipboard_manager/clipboard"
+	"clipboard_manager/storage"
+	"context"
+	"errors"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReplay(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "shot.png"), []byte("\x89PNG\r\n\x1a\nscreenshot"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	// Steps at the same time would all be missed but the last by a
+	// watcher polling the clipboard.
+	script, err := clipboard.ParseScript(strings.NewReader(`
+0s      text hello
++0s     text world
++0s     text hello
++0s     text sk-secret
++10ms   error display went away
++0s     text copied while failing
++10ms   ok
++0s     text "two\nlines"
++0s     image shot.png
+`), dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db := storage.NewMemoryStore()
+	defer db.Close()
+	if err := db.SetIgnoreRules(storage.IgnoreRules{Patterns: []string{"^sk-"}}); err != nil {
+		t.Fatal(err)
+	}
+	var recordErrs []error
+	record := recordCapture(func() storage.Recorder { return db }, func(err error) {
+		recordErrs = append(recordErrs, err)
+	})
+	fake := clipboard.NewFake()
+	w := clipboard.NewWatcher(fake, time.Hour)
+	var readErrs int
+	w.OnError = func(error) { readErrs++ }
+
+	if err := playScript(context.Background(), fake, script, []*clipboard.Watcher{w}, record); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := db.GetRecent(math.MaxInt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []struct {
+		text   string
+		copies int
+	}{
+		{"two\nlines", 1},
+		// Read once the clipboard works again.
+		{"copied while failing", 1},
+		{"hello", 2},
+		{"world", 1},
+	}
+	if len(entries) != len(want) {
+		t.Fatalf("recorded %d entries, want %d", len(entries), len(want))
+	}
+	for i, w := range want {
+		if entries[i].Text != w.text || entries[i].CopyCount != w.copies {
+			t.Errorf("entry %d = %q copied %d times, want %q %d times", i, entries[i].Text, entries[i].CopyCount, w.text, w.copies)
+		}
+	}
+	if readErrs != 1 {
+		t.Errorf("%d read errors reported, want 1", readErrs)
+	}
+	// The image cannot be stored without an image directory; the ignored
+	// text is not an error.
+	if len(recordErrs) != 1 || !errors.Is(recordErrs[0], storage.ErrNoImageDir) {
+		t.Errorf("recording errors %v, want only the image", recordErrs)
+	}
+}
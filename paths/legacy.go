@@ -0,0 +1,232 @@
+package paths
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// MarkerFile records in the data directory that legacy files have been
+// migrated, so it only ever happens once.
+const MarkerFile = "legacy-migration.json"
+
+// legacyStores are the histories older versions wrote to the directory
+// they were started from. Only a directory holding one of them is taken for
+// an old layout, so an unrelated folder that happens to be called profiles
+// or clipboard_backups is left alone.
+var legacyStores = []string{"clipboard.db", "clipboard_history.json"}
+
+// legacyFiles are the store with its journals and backups, and legacyDirs
+// the images and snapshots kept next to it.
+var (
+	legacyFiles = []string{"clipboard.db*", "clipboard_history.json*"}
+	legacyDirs  = []string{"clipboard_images", "clipboard_backups"}
+)
+
+// legacyProfile are the files that make a directory below profiles/ a
+// profile written by an older version.
+var legacyProfile = []string{"profile.json", "clipboard.db", "clipboard_history.json"}
+
+// Migration records a move of legacy files into the data directory.
+type Migration struct {
+	From  string    `json:"from"`
+	At    time.Time `json:"at"`
+	Moved []string  `json:"moved"`
+}
+
+func (m *Migration) String() string {
+	return fmt.Sprintf("Moved %d files from %s to the data directory", len(m.Moved), m.From)
+}
+
+// FindLegacy returns the names of the files older versions left in dir,
+// or none if dir does not hold a history written by one.
+func FindLegacy(dir string) ([]string, error) {
+	found := false
+	for _, name := range legacyStores {
+		if info, err := os.Stat(filepath.Join(dir, name)); err == nil && info.Mode().IsRegular() {
+			found = true
+		}
+	}
+	if !found {
+		return nil, nil
+	}
+
+	var names []string
+	for _, pattern := range legacyFiles {
+		matches, err := filepath.Glob(filepath.Join(dir, pattern))
+		if err != nil {
+			return nil, err
+		}
+		for _, m := range matches {
+			if info, err := os.Stat(m); err == nil && info.Mode().IsRegular() {
+				names = append(names, filepath.Base(m))
+			}
+		}
+	}
+	for _, name := range legacyDirs {
+		if info, err := os.Stat(filepath.Join(dir, name)); err == nil && info.IsDir() {
+			names = append(names, name)
+		}
+	}
+	for _, name := range legacyProfile {
+		matches, err := filepath.Glob(filepath.Join(dir, "profiles", "*", name))
+		if err != nil {
+			return nil, err
+		}
+		if len(matches) > 0 {
+			names = append(names, "profiles")
+			break
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// LoadMigration returns the record of the legacy migration, or nil if
+// nothing has been migrated.
+func LoadMigration(d Dirs) (*Migration, error) {
+	m, err := loadMarker(d)
+	if m == nil || len(m.Moved) == 0 {
+		return nil, err
+	}
+	return m, nil
+}
+
+func loadMarker(d Dirs) (*Migration, error) {
+	data, err := os.ReadFile(filepath.Join(d.Data, MarkerFile))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var m Migration
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("%s: %w", MarkerFile, err)
+	}
+	return &m, nil
+}
+
+// writeMarker records m, so later starts do not look for legacy files
+// again.
+func writeMarker(d Dirs, m *Migration) error {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(d.Data, MarkerFile), data, 0600)
+}
+
+// MigrateLegacy moves the files older versions left in from to the data
+// directory, and profile settings to the config directory. Once it has
+// moved a history it records that it did, and later runs return nil; until
+// then every run looks in from, as the first start after an upgrade may
+// well be from another directory. Files that would overwrite existing ones
+// are left alone and reported as an error.
+func MigrateLegacy(from string, d Dirs) (*Migration, error) {
+	from, err := filepath.Abs(from)
+	if err != nil {
+		return nil, err
+	}
+	if from == d.Data {
+		return nil, nil
+	}
+	if done, err := loadMarker(d); done != nil || err != nil {
+		return nil, err
+	}
+	names, err := FindLegacy(from)
+	if err != nil {
+		return nil, err
+	}
+	if len(names) == 0 {
+		return nil, nil
+	}
+	for _, name := range names {
+		if _, err := os.Lstat(filepath.Join(d.Data, name)); err == nil {
+			return nil, fmt.Errorf("found an old history in %s but %s already exists, move the files over by hand", from, filepath.Join(d.Data, name))
+		}
+	}
+	if err := d.Create(); err != nil {
+		return nil, err
+	}
+
+	// A profile.json is only taken along with the history it belongs to;
+	// FindLegacy found one next to it.
+	m := &Migration{From: from, At: time.Now()}
+	configs, _ := filepath.Glob(filepath.Join(from, "profiles", "*", "profile.json"))
+	configs = append(configs, filepath.Join(from, "profile.json"))
+	for _, src := range configs {
+		rel, _ := filepath.Rel(from, src)
+		if _, err := os.Stat(src); err != nil {
+			continue
+		}
+		dst := filepath.Join(d.Config, rel)
+		if _, err := os.Stat(dst); err == nil {
+			continue
+		}
+		if err := move(src, dst); err != nil {
+			return nil, err
+		}
+		m.Moved = append(m.Moved, rel)
+	}
+	for _, name := range names {
+		if err := move(filepath.Join(from, name), filepath.Join(d.Data, name)); err != nil {
+			return nil, err
+		}
+		m.Moved = append(m.Moved, name)
+	}
+
+	return m, writeMarker(d, m)
+}
+
+// move renames src to dst, copying when they are on different file
+// systems.
+func move(src, dst string) error {
+	if err := os.MkdirAll(filepath.Dir(dst), 0700); err != nil {
+		return err
+	}
+	if err := os.Rename(src, dst); err == nil {
+		return nil
+	}
+	err := filepath.WalkDir(src, func(path string, e fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(src, path)
+		target := filepath.Join(dst, rel)
+		if e.IsDir() {
+			return os.MkdirAll(target, 0700)
+		}
+		return copyFile(path, target)
+	})
+	if err != nil {
+		return err
+	}
+	return os.RemoveAll(src)
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	info, err := in.Stat()
+	if err != nil {
+		return err
+	}
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
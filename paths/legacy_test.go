@@ -0,0 +1,128 @@
+package paths
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// layout creates files, and directories for names ending in a slash,
+// below dir.
+func layout(t *testing.T, dir string, names ...string) {
+	t.Helper()
+	for _, name := range names {
+		path := filepath.Join(dir, name)
+		if name[len(name)-1] == '/' {
+			if err := os.MkdirAll(path, 0700); err != nil {
+				t.Fatal(err)
+			}
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(name), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestMigrateLegacy(t *testing.T) {
+	tests := []struct {
+		name  string
+		files []string
+		moved []string
+		left  []string
+	}{
+		{"nothing", nil, nil, nil},
+		{"bare directories", []string{"profiles/", "clipboard_backups/", "clipboard_images/"}, nil,
+			[]string{"profiles", "clipboard_backups", "clipboard_images"}},
+		{"profiles without a history", []string{"profiles/work/profile.json"}, nil,
+			[]string{"profiles/work/profile.json"}},
+		{"settings without a history", []string{"profile.json"}, nil, []string{"profile.json"}},
+		{"json history", []string{
+			"clipboard_history.json", "clipboard_history.json.journal", "clipboard_images/ab/abc.png",
+			"clipboard_backups/backup-1/history.json", "notes.txt",
+		}, []string{
+			"clipboard_backups", "clipboard_history.json", "clipboard_history.json.journal", "clipboard_images",
+		}, []string{"notes.txt"}},
+		{"sqlite history with profiles", []string{
+			"clipboard.db", "clipboard.db-wal", "profile.json", "profiles/work/profile.json", "profiles/work/clipboard.db",
+		}, []string{
+			filepath.Join("profiles", "work", "profile.json"), "profile.json", "clipboard.db", "clipboard.db-wal", "profiles",
+		}, nil},
+		{"history with unrelated directories named like files", []string{"clipboard.db", "clipboard.db.d/"},
+			[]string{"clipboard.db"}, []string{"clipboard.db.d"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			from := t.TempDir()
+			d := Dirs{Data: filepath.Join(t.TempDir(), "data"), Config: filepath.Join(t.TempDir(), "config"), Cache: t.TempDir()}
+			layout(t, from, tt.files...)
+
+			m, err := MigrateLegacy(from, d)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var moved []string
+			if m != nil {
+				moved = m.Moved
+			}
+			if !reflect.DeepEqual(moved, tt.moved) {
+				t.Errorf("moved %q, want %q", moved, tt.moved)
+			}
+			for _, name := range tt.left {
+				if _, err := os.Stat(filepath.Join(from, name)); err != nil {
+					t.Errorf("%s was not left in place: %v", name, err)
+				}
+			}
+
+			// Once a history has moved, later runs do not look again;
+			// until then they do, as the first start may have been from
+			// another directory.
+			_, err = os.Stat(filepath.Join(d.Data, MarkerFile))
+			if (err == nil) != (len(tt.moved) > 0) {
+				t.Fatalf("marker: %v, want one only when files were moved", err)
+			}
+			layout(t, from, "clipboard_history.json")
+			m, err = MigrateLegacy(from, d)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if (m != nil) == (len(tt.moved) > 0) {
+				t.Errorf("second run = %v", m)
+			}
+			_, err = os.Stat(filepath.Join(from, "clipboard_history.json"))
+			if (err == nil) != (len(tt.moved) > 0) {
+				t.Errorf("history left by the second run: %v", err)
+			}
+
+			loaded, err := LoadMigration(d)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if loaded == nil {
+				t.Errorf("LoadMigration = nil, want a record of the move")
+			}
+		})
+	}
+}
+
+func TestMigrateLegacyConflict(t *testing.T) {
+	from := t.TempDir()
+	d := Dirs{Data: t.TempDir(), Config: t.TempDir(), Cache: t.TempDir()}
+	layout(t, from, "clipboard.db")
+	layout(t, d.Data, "clipboard.db")
+
+	if _, err := MigrateLegacy(from, d); err == nil {
+		t.Fatal("migrated over an existing history")
+	}
+	if _, err := os.Stat(filepath.Join(from, "clipboard.db")); err != nil {
+		t.Errorf("old history was moved: %v", err)
+	}
+	// The conflict is reported again on the next start.
+	if _, err := os.Stat(filepath.Join(d.Data, MarkerFile)); !os.IsNotExist(err) {
+		t.Errorf("marker written despite the conflict: %v", err)
+	}
+}
@@ -0,0 +1,75 @@
+// Package paths works out where the clipboard manager keeps its files,
+// following the XDG base directory specification.
+package paths
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// App is the name of the directory created under each base directory.
+const App = "clipboard_manager"
+
+// Dirs are the directories the clipboard manager uses. Data holds the
+// histories, images and backups, Config the profile settings and Cache
+// what can be thrown away, such as the log.
+type Dirs struct {
+	Data   string
+	Config string
+	Cache  string
+}
+
+// Resolve fills in each directory not set in override from the
+// environment: CLIPBOARD_DATA_DIR, CLIPBOARD_CONFIG_DIR and
+// CLIPBOARD_CACHE_DIR name the directory itself, XDG_DATA_HOME,
+// XDG_CONFIG_HOME and XDG_CACHE_HOME the base it is created under. The
+// XDG defaults below the home directory are used otherwise. The
+// directories are returned as absolute paths but not created.
+func Resolve(override Dirs) (Dirs, error) {
+	home, homeErr := os.UserHomeDir()
+	resolve := func(flag, env, xdg, fallback string) (string, error) {
+		dir := flag
+		if dir == "" {
+			dir = os.Getenv(env)
+		}
+		if dir == "" {
+			// The spec says relative XDG paths are invalid and must be
+			// ignored.
+			if base := os.Getenv(xdg); filepath.IsAbs(base) {
+				dir = filepath.Join(base, App)
+			}
+		}
+		if dir == "" {
+			if homeErr != nil {
+				return "", fmt.Errorf("no %s and no home directory: %w", xdg, homeErr)
+			}
+			dir = filepath.Join(home, fallback, App)
+		}
+		return filepath.Abs(dir)
+	}
+
+	var d Dirs
+	var err error
+	if d.Data, err = resolve(override.Data, "CLIPBOARD_DATA_DIR", "XDG_DATA_HOME", filepath.Join(".local", "share")); err != nil {
+		return d, err
+	}
+	if d.Config, err = resolve(override.Config, "CLIPBOARD_CONFIG_DIR", "XDG_CONFIG_HOME", ".config"); err != nil {
+		return d, err
+	}
+	if d.Cache, err = resolve(override.Cache, "CLIPBOARD_CACHE_DIR", "XDG_CACHE_HOME", ".cache"); err != nil {
+		return d, err
+	}
+	return d, nil
+}
+
+// Create makes the directories that do not exist yet. They may hold
+// clipboard contents, so only the owner can read them.
+func (d Dirs) Create() error {
+	for _, dir := range []string{d.Data, d.Config, d.Cache} {
+		if err := os.MkdirAll(dir, 0700); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,166 @@
+package profile
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"clipboard_manager/paths"
+	"clipboard_manager/storage"
+)
+
+// OpenFunc opens the store of a profile and applies its settings.
+type OpenFunc func(p Profile, c Config) (*storage.Database, error)
+
+// StartFunc starts the background work of an open profile, such as pruning
+// and backups. It should return once ctx is done.
+type StartFunc func(ctx context.Context, p Profile, db *storage.Database)
+
+// Manager keeps one profile open at a time and switches between them.
+type Manager struct {
+	dirs  paths.Dirs
+	open  OpenFunc
+	start StartFunc
+
+	mu     sync.Mutex
+	active Profile
+	db     *storage.Database
+	cancel context.CancelFunc
+}
+
+func NewManager(dirs paths.Dirs, open OpenFunc, start StartFunc) *Manager {
+	return &Manager{dirs: dirs, open: open, start: start}
+}
+
+// Switch closes the open profile, if any, and opens the one called name,
+// creating it if it does not exist yet.
+func (m *Manager) Switch(name string) (*storage.Database, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.db != nil && m.active.Name == name {
+		return m.db, nil
+	}
+	p, err := Create(m.dirs, name)
+	if err != nil {
+		return nil, err
+	}
+	db, err := m.openLocked(p)
+	if err != nil {
+		return nil, fmt.Errorf("profile %s: %w", p.Name, err)
+	}
+
+	m.closeLocked()
+	m.active, m.db = p, db
+	if m.start != nil {
+		ctx, cancel := context.WithCancel(context.Background())
+		m.cancel = cancel
+		go m.start(ctx, p, db)
+	}
+	return db, nil
+}
+
+func (m *Manager) openLocked(p Profile) (*storage.Database, error) {
+	c, err := LoadConfig(p)
+	if err != nil {
+		return nil, err
+	}
+	return m.open(p, c)
+}
+
+// Active returns the open profile and its store.
+func (m *Manager) Active() (Profile, *storage.Database) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.active, m.db
+}
+
+// Store returns the store of the open profile, or nil once the Manager is
+// closed.
+func (m *Manager) Store() storage.Store {
+	_, db := m.Active()
+	if db == nil {
+		return nil
+	}
+	return db
+}
+
+// List returns every profile that exists.
+func (m *Manager) List() ([]Profile, error) {
+	return List(m.dirs)
+}
+
+// Transfer copies the entries with the given IDs from the open profile to
+// the profile called to, or moves them with move, in which case they go to
+// the open profile's trash. It returns how many entries were transferred.
+func (m *Manager) Transfer(ids []int, to string, move bool) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.db == nil {
+		return 0, fmt.Errorf("no profile is open")
+	}
+	if to == m.active.Name {
+		return 0, fmt.Errorf("entries are already in profile %s", to)
+	}
+	p, err := Get(m.dirs, to)
+	if err != nil {
+		return 0, err
+	}
+	if !exists(p) {
+		return 0, fmt.Errorf("%w: %s", ErrNotFound, to)
+	}
+	dst, err := m.openLocked(p)
+	if err != nil {
+		return 0, fmt.Errorf("profile %s: %w", to, err)
+	}
+	defer dst.Close()
+
+	n := 0
+	for _, id := range ids {
+		e, err := m.db.GetEntry(id)
+		if err != nil {
+			return n, err
+		}
+		if e.Text, err = m.db.LoadText(e); err != nil {
+			return n, fmt.Errorf("entry #%d: %w", id, err)
+		}
+		var image []byte
+		if e.IsImage {
+			if image, err = m.db.ReadImage(e); err != nil {
+				return n, fmt.Errorf("entry #%d: %w", id, err)
+			}
+		}
+		if _, err := dst.ImportEntry(e, image); err != nil {
+			return n, fmt.Errorf("entry #%d: %w", id, err)
+		}
+		if move {
+			if err := m.db.DeleteEntry(id); err != nil {
+				return n, err
+			}
+		}
+		n++
+	}
+	return n, nil
+}
+
+// Close stops the background work of the open profile and closes its
+// store.
+func (m *Manager) Close() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.closeLocked()
+}
+
+func (m *Manager) closeLocked() error {
+	if m.cancel != nil {
+		m.cancel()
+		m.cancel = nil
+	}
+	if m.db == nil {
+		return nil
+	}
+	err := m.db.Close()
+	m.db = nil
+	return err
+}
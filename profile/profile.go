@@ -0,0 +1,165 @@
+// Package profile keeps separate clipboard histories side by side. Each
+// profile has its own store, images, backups, retention and ignore rules.
+package profile
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+
+	"clipboard_manager/paths"
+	"clipboard_manager/storage"
+)
+
+// Default is the profile used when none is chosen. It lives directly in
+// the data and config directories, where the history was kept before
+// profiles existed.
+const Default = "default"
+
+// ConfigFile is the name of a profile's settings file inside its config
+// directory.
+const ConfigFile = "profile.json"
+
+var validName = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// ErrNotFound is returned for a profile that has not been created.
+var ErrNotFound = errors.New("profile not found")
+
+// Profile is a named history. Dir holds its store, images and backups,
+// ConfigDir its settings.
+type Profile struct {
+	Name      string
+	Dir       string
+	ConfigDir string
+}
+
+// Path resolves a file name relative to the profile's directory. Absolute
+// paths are returned unchanged.
+func (p Profile) Path(name string) string {
+	if filepath.IsAbs(name) {
+		return name
+	}
+	return filepath.Join(p.Dir, name)
+}
+
+// Config are the settings of a profile. Retention values use the same
+// syntax as the command line flags of the same name; unset ones fall back
+// to the flags.
+type Config struct {
+	MaxEntries     *int                `json:"max_entries,omitempty"`
+	MaxAge         string              `json:"max_age,omitempty"`
+	MaxBytes       *int64              `json:"max_bytes,omitempty"`
+	CategoryLimits string              `json:"category_limits,omitempty"`
+	TrashFor       string              `json:"trash_for,omitempty"`
+	Ignore         storage.IgnoreRules `json:"ignore"`
+}
+
+// Retention applies the profile's limits on top of base. Limits named in
+// fixed, by their flag name, were given on the command line and are kept.
+func (c Config) Retention(base storage.RetentionPolicy, fixed map[string]bool) (storage.RetentionPolicy, error) {
+	p := base
+	if c.MaxEntries != nil && !fixed["max-entries"] {
+		p.MaxEntries = *c.MaxEntries
+	}
+	if c.MaxBytes != nil && !fixed["max-bytes"] {
+		p.MaxBytes = *c.MaxBytes
+	}
+	if c.MaxAge != "" && !fixed["max-age"] {
+		age, err := storage.ParseAge(c.MaxAge)
+		if err != nil {
+			return p, fmt.Errorf("max_age: %w", err)
+		}
+		p.MaxAge = age
+	}
+	if c.TrashFor != "" && !fixed["trash-for"] {
+		keep, err := storage.ParseAge(c.TrashFor)
+		if err != nil {
+			return p, fmt.Errorf("trash_for: %w", err)
+		}
+		p.TrashFor = keep
+	}
+	if c.CategoryLimits != "" && !fixed["category-limits"] {
+		limits, err := storage.ParseCategoryLimits(c.CategoryLimits)
+		if err != nil {
+			return p, fmt.Errorf("category_limits: %w", err)
+		}
+		p.Categories = limits
+	}
+	return p, nil
+}
+
+// Get returns the profile called name without creating it.
+func Get(dirs paths.Dirs, name string) (Profile, error) {
+	if name == "" {
+		name = Default
+	}
+	if !validName.MatchString(name) {
+		return Profile{}, fmt.Errorf("invalid profile name %q: use letters, digits, - and _", name)
+	}
+	if name == Default {
+		return Profile{Name: name, Dir: dirs.Data, ConfigDir: dirs.Config}, nil
+	}
+	return Profile{
+		Name:      name,
+		Dir:       filepath.Join(dirs.Data, "profiles", name),
+		ConfigDir: filepath.Join(dirs.Config, "profiles", name),
+	}, nil
+}
+
+// Create returns the profile called name, making its directory if needed.
+func Create(dirs paths.Dirs, name string) (Profile, error) {
+	p, err := Get(dirs, name)
+	if err != nil {
+		return p, err
+	}
+	return p, os.MkdirAll(p.Dir, 0700)
+}
+
+// List returns the default profile followed by the others by name.
+func List(dirs paths.Dirs) ([]Profile, error) {
+	entries, err := os.ReadDir(filepath.Join(dirs.Data, "profiles"))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+
+	def, _ := Get(dirs, Default)
+	list := []Profile{def}
+	for _, e := range entries {
+		if e.IsDir() && validName.MatchString(e.Name()) && e.Name() != Default {
+			p, _ := Get(dirs, e.Name())
+			list = append(list, p)
+		}
+	}
+	return list, nil
+}
+
+// LoadConfig reads the profile's settings. A profile without a settings
+// file has an empty Config.
+func LoadConfig(p Profile) (Config, error) {
+	var c Config
+	name := filepath.Join(p.ConfigDir, ConfigFile)
+	data, err := os.ReadFile(name)
+	if os.IsNotExist(err) {
+		return c, nil
+	}
+	if err != nil {
+		return c, err
+	}
+	if err := json.Unmarshal(data, &c); err != nil {
+		return c, fmt.Errorf("%s: %w", name, err)
+	}
+	return c, nil
+}
+
+func exists(p Profile) bool {
+	if p.Name == Default {
+		return true
+	}
+	info, err := os.Stat(p.Dir)
+	return err == nil && info.IsDir()
+}
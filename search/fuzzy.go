@@ -59,12 +59,16 @@ func FuzzySearch(entries []storage.ClipboardEntry, query string, threshold int)
 	var results []storage.ClipboardEntry
 
 	for _, entry := range entries {
-		if strings.Contains(strings.ToLower(entry.Text), strings.ToLower(query)) {
+		text := entry.Text
+		if entry.Title != "" || entry.Note != "" || len(entry.Tags) > 0 {
+			text = entry.Title + "\n" + entry.Note + "\n" + strings.Join(entry.Tags, " ") + "\n" + entry.Text
+		}
+		if strings.Contains(strings.ToLower(text), strings.ToLower(query)) {
 			results = append(results, entry)
 			continue
 		}
 
-		words := strings.Fields(entry.Text)
+		words := strings.Fields(text)
 		for _, word := range words {
 			if len(word) < 3 {
 				continue
@@ -0,0 +1,501 @@
+package storage
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	backupManifest = "manifest.json"
+	backupHistory  = "history.json"
+	backupPrefix   = "backup-"
+)
+
+// BackupPolicy says where snapshots go, how often they are taken and how
+// many are kept. Zero values mean no limit; the newest backup is always
+// kept.
+type BackupPolicy struct {
+	Dir      string
+	Interval time.Duration
+	Keep     int
+	MaxAge   time.Duration
+}
+
+// Backup describes one snapshot of the history and its images.
+type Backup struct {
+	Name    string
+	Path    string
+	Created time.Time
+	Entries int
+	Images  int
+	Texts   int
+	Size    int64
+	// Err is set when the manifest could not be read.
+	Err error
+}
+
+func (b Backup) String() string {
+	if b.Err != nil {
+		return fmt.Sprintf("%s: %v", b.Name, b.Err)
+	}
+	s := fmt.Sprintf("%s: %d entries, %d images", b.Name, b.Entries, b.Images)
+	if b.Texts > 0 {
+		s += fmt.Sprintf(", %d large texts", b.Texts)
+	}
+	return s + ", " + FormatBytes(b.Size)
+}
+
+// backupManifestFile lists every file of a backup with its checksum, so a
+// damaged backup is noticed before it is restored.
+type backupManifestFile struct {
+	Version   int          `json:"version"`
+	Created   time.Time    `json:"created"`
+	Entries   int          `json:"entries"`
+	Encrypted bool         `json:"encrypted,omitempty"`
+	ImageDir  string       `json:"image_dir,omitempty"`
+	Files     []backupFile `json:"files"`
+}
+
+type backupFile struct {
+	Path   string `json:"path"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+	// Source is where an image or text blob lived when it was backed up.
+	Source string `json:"source,omitempty"`
+}
+
+// Backup writes a snapshot of the history, trash included, and of every
+// image an entry refers to into a new directory under dir. The directory
+// only appears once it is complete.
+func (d *Database) Backup(dir string) (Backup, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return d.backupLocked(dir)
+}
+
+func (d *Database) backupLocked(dir string) (Backup, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return Backup{}, err
+	}
+
+	now := time.Now()
+	name := backupPrefix + now.Format("20060102-150405")
+	for n := 2; ; n++ {
+		if _, err := os.Stat(filepath.Join(dir, name)); os.IsNotExist(err) {
+			break
+		}
+		name = fmt.Sprintf("%s%s-%d", backupPrefix, now.Format("20060102-150405"), n)
+	}
+
+	tmp, err := os.MkdirTemp(dir, ".tmp-"+name+"-")
+	if err != nil {
+		return Backup{}, err
+	}
+	defer os.RemoveAll(tmp)
+
+	all := append(append([]ClipboardEntry{}, d.entries...), d.trash...)
+	manifest := backupManifestFile{
+		Version:   historyVersion,
+		Created:   now,
+		Entries:   len(all),
+		Encrypted: d.key != nil,
+	}
+	if d.blobs != nil {
+		manifest.ImageDir = d.blobs.Dir()
+	}
+
+	snap := &snapshot{Entries: all, NextID: d.nextID, Collections: d.collections}
+	if err := writeSnapshot(filepath.Join(tmp, backupHistory), snap, d.key); err != nil {
+		return Backup{}, err
+	}
+	f, err := checksum(tmp, backupHistory)
+	if err != nil {
+		return Backup{}, err
+	}
+	manifest.Files = append(manifest.Files, f)
+
+	seen := map[string]bool{}
+	type blobFile struct {
+		path, kind string
+		store      *BlobStore
+	}
+	for _, e := range all {
+		var files []blobFile
+		if e.IsImage {
+			files = append(files, blobFile{e.ImagePath, "images", d.blobs})
+		}
+		for _, path := range textBlobs(e) {
+			files = append(files, blobFile{path, "texts", d.texts})
+		}
+		for j, file := range files {
+			if file.path == "" || seen[file.path] {
+				continue
+			}
+			seen[file.path] = true
+			if _, err := os.Stat(file.path); os.IsNotExist(err) {
+				continue
+			}
+
+			rel := filepath.Join(file.kind, "external", fmt.Sprintf("%d-%d%s", e.ID, j, filepath.Ext(file.path)))
+			if file.store != nil && file.store.Contains(file.path) {
+				inner, err := filepath.Rel(file.store.Dir(), file.path)
+				if err != nil {
+					return Backup{}, err
+				}
+				rel = filepath.Join(file.kind, "blobs", inner)
+			}
+			if err := linkOrCopy(file.path, filepath.Join(tmp, rel)); err != nil {
+				return Backup{}, err
+			}
+			f, err := checksum(tmp, rel)
+			if err != nil {
+				return Backup{}, err
+			}
+			f.Source = file.path
+			manifest.Files = append(manifest.Files, f)
+		}
+	}
+
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return Backup{}, err
+	}
+	if err := writeFileAtomic(filepath.Join(tmp, backupManifest), data, 0644); err != nil {
+		return Backup{}, err
+	}
+
+	path := filepath.Join(dir, name)
+	if err := os.Rename(tmp, path); err != nil {
+		return Backup{}, err
+	}
+	if err := syncDir(dir); err != nil {
+		return Backup{}, err
+	}
+	return readBackup(path), nil
+}
+
+// ListBackups returns the backups in dir, newest first.
+func ListBackups(dir string) ([]Backup, error) {
+	items, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var backups []Backup
+	for _, item := range items {
+		if item.IsDir() && strings.HasPrefix(item.Name(), backupPrefix) {
+			backups = append(backups, readBackup(filepath.Join(dir, item.Name())))
+		}
+	}
+	sort.Slice(backups, func(i, j int) bool {
+		if !backups[i].Created.Equal(backups[j].Created) {
+			return backups[i].Created.After(backups[j].Created)
+		}
+		return backups[i].Name > backups[j].Name
+	})
+	return backups, nil
+}
+
+func readBackup(path string) Backup {
+	b := Backup{Name: filepath.Base(path), Path: path}
+	m, err := readManifest(path)
+	if err != nil {
+		b.Err = err
+		return b
+	}
+	b.Created = m.Created
+	b.Entries = m.Entries
+	for _, f := range m.Files {
+		b.Size += f.Size
+		switch {
+		case strings.HasPrefix(f.Path, "texts"+string(filepath.Separator)):
+			b.Texts++
+		case f.Path != backupHistory:
+			b.Images++
+		}
+	}
+	return b
+}
+
+func readManifest(path string) (*backupManifestFile, error) {
+	data, err := os.ReadFile(filepath.Join(path, backupManifest))
+	if err != nil {
+		return nil, err
+	}
+	var m backupManifestFile
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("corrupt manifest: %w", err)
+	}
+	return &m, nil
+}
+
+// VerifyBackup checks every file of the backup at path against its
+// manifest and makes sure the history in it can be read. An encrypted
+// backup needs the WithKey option for the second part.
+func VerifyBackup(path string, opts ...Option) error {
+	_, _, err := verifyBackup(path, collectOptions(opts).key)
+	return err
+}
+
+// VerifyBackup is VerifyBackup with the key of the Database.
+func (d *Database) VerifyBackup(path string) error {
+	_, _, err := verifyBackup(path, d.key)
+	return err
+}
+
+func verifyBackup(path string, key *Key) (*backupManifestFile, *history, error) {
+	m, err := readManifest(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, want := range m.Files {
+		got, err := checksum(path, want.Path)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%s: %w", want.Path, err)
+		}
+		if got.Size != want.Size || got.SHA256 != want.SHA256 {
+			return nil, nil, fmt.Errorf("%s: checksum mismatch", want.Path)
+		}
+	}
+
+	h, err := readHistory(filepath.Join(path, backupHistory), false, key)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !h.found {
+		return nil, nil, fmt.Errorf("%s is missing", backupHistory)
+	}
+	if got := len(h.snap.Entries); got != m.Entries {
+		return nil, nil, fmt.Errorf("history has %d entries, manifest says %d", got, m.Entries)
+	}
+	return m, h, nil
+}
+
+// RestoreBackup replaces the whole history with the backup at path. The
+// backup is verified first and the current state is backed up next to it.
+// The store stays locked until the restore is done, so clipboard captures
+// wait for it, and the new state is committed as one change.
+func (d *Database) RestoreBackup(path string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	m, h, err := verifyBackup(path, d.key)
+	if err != nil {
+		return fmt.Errorf("verify %s: %w", filepath.Base(path), err)
+	}
+	if _, err := d.backupLocked(filepath.Dir(path)); err != nil {
+		return fmt.Errorf("back up current history: %w", err)
+	}
+
+	moved := map[string]string{}
+	for _, f := range m.Files {
+		if f.Source == "" {
+			continue
+		}
+		dst, err := d.restoreFile(path, f)
+		if err != nil {
+			return fmt.Errorf("restore %s: %w", f.Path, err)
+		}
+		moved[f.Source] = dst
+	}
+
+	d.entries = []ClipboardEntry{}
+	d.trash = nil
+	for _, e := range h.snap.Entries {
+		if dst, ok := moved[e.ImagePath]; ok {
+			e.ImagePath = dst
+		}
+		if dst, ok := moved[e.TextBlob]; ok {
+			e.TextBlob = dst
+		}
+		if len(e.Revisions) > 0 {
+			e.Revisions = append([]Revision(nil), e.Revisions...)
+			for i, r := range e.Revisions {
+				if dst, ok := moved[r.TextBlob]; ok {
+					e.Revisions[i].TextBlob = dst
+				}
+			}
+		}
+		if e.DeletedAt.IsZero() {
+			d.entries = append(d.entries, e)
+		} else {
+			d.trash = append(d.trash, e)
+		}
+	}
+	sortEntries(d.entries)
+	sortTrash(d.trash)
+	if h.snap.NextID > d.nextID {
+		d.nextID = h.snap.NextID
+	}
+	d.reindex()
+	d.countRefs()
+	d.collections = append([]Collection{}, h.snap.Collections...)
+
+	ch := change{cleared: true, collections: d.collections}
+	ch.put = append(append(ch.put, d.entries...), d.trash...)
+	if err := d.commit(ch, Event{Type: EventReset}); err != nil {
+		return err
+	}
+	// A backup taken before encryption was turned on brings plain images
+	// and texts.
+	if d.texts != nil {
+		if err := d.offloadAll(); err != nil {
+			return err
+		}
+	}
+	if d.blobs != nil {
+		return d.sealImages()
+	}
+	return nil
+}
+
+// restoreFile puts an image or text file of a backup back in place and
+// returns where it now lives. Blobs go into the current image or text
+// directory, which may differ from the one the backup was taken from.
+// Callers must hold d.mu.
+func (d *Database) restoreFile(path string, f backupFile) (string, error) {
+	src := filepath.Join(path, f.Path)
+	dst := f.Source
+	store, noStore, ext := d.blobs, ErrNoImageDir, filepath.Ext(f.Source)
+	if strings.HasPrefix(f.Path, "texts"+string(filepath.Separator)) {
+		store, noStore, ext = d.texts, ErrNoTextDir, textExt
+	}
+	_, inner, _ := strings.Cut(f.Path, string(filepath.Separator))
+	if inner, ok := strings.CutPrefix(inner, "blobs"+string(filepath.Separator)); ok {
+		if store == nil {
+			return "", noStore
+		}
+		dst = filepath.Join(store.Dir(), inner)
+	} else if store != nil {
+		data, err := readSealed(src, d.key)
+		if err != nil {
+			return "", err
+		}
+		dst, _, err = store.Put(data, ext)
+		return dst, err
+	}
+
+	if _, err := os.Stat(dst); err == nil {
+		return dst, nil
+	}
+	data, err := os.ReadFile(src)
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return "", err
+	}
+	return dst, writeFileAtomic(dst, data, 0644)
+}
+
+// RotateBackups deletes the backups in dir beyond the newest keep ones and
+// those older than maxAge, and returns what it deleted. The newest backup
+// is never deleted.
+func RotateBackups(dir string, keep int, maxAge time.Duration) ([]Backup, error) {
+	backups, err := ListBackups(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var removed []Backup
+	now := time.Now()
+	for i, b := range backups {
+		if i == 0 || b.Err != nil {
+			continue
+		}
+		tooMany := keep > 0 && i >= keep
+		tooOld := maxAge > 0 && now.Sub(b.Created) > maxAge
+		if !tooMany && !tooOld {
+			continue
+		}
+		if err := os.RemoveAll(b.Path); err != nil {
+			return removed, err
+		}
+		removed = append(removed, b)
+	}
+	return removed, nil
+}
+
+// StartBackups takes a backup every p.Interval until ctx is done and
+// rotates old ones, handing each result to onBackup. A backup is taken
+// right away if the newest one is older than the interval, and skipped
+// when nothing changed since the last one.
+func (d *Database) StartBackups(ctx context.Context, p BackupPolicy, onBackup func(Backup, []Backup, error)) {
+	run := func() {
+		d.mu.Lock()
+		if d.changes == d.backedUp {
+			d.mu.Unlock()
+			return
+		}
+		b, err := d.backupLocked(p.Dir)
+		if err == nil {
+			d.backedUp = d.changes
+		}
+		d.mu.Unlock()
+
+		var removed []Backup
+		if err == nil {
+			removed, err = RotateBackups(p.Dir, p.Keep, p.MaxAge)
+		}
+		if onBackup != nil {
+			onBackup(b, removed, err)
+		}
+	}
+
+	if backups, err := ListBackups(p.Dir); err == nil &&
+		(len(backups) == 0 || time.Since(backups[0].Created) > p.Interval) {
+		run()
+	}
+
+	ticker := time.NewTicker(p.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			run()
+		}
+	}
+}
+
+func checksum(dir, rel string) (backupFile, error) {
+	f, err := os.Open(filepath.Join(dir, rel))
+	if err != nil {
+		return backupFile{}, err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	n, err := io.Copy(h, f)
+	if err != nil {
+		return backupFile{}, err
+	}
+	return backupFile{Path: rel, Size: n, SHA256: hex.EncodeToString(h.Sum(nil))}, nil
+}
+
+// linkOrCopy hard links src to dst, or copies it where links are not
+// possible. Image blobs never change once written, so sharing them is safe.
+func linkOrCopy(src, dst string) error {
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+	if err := os.Link(src, dst); err == nil {
+		return nil
+	}
+	return copyFile(src, dst)
+}
@@ -0,0 +1,468 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+var ErrNoImageDir = errors.New("no image directory configured")
+
+// BlobStore keeps files under the hash of their contents, so the same image
+// copied twice is stored once. It counts how many entries refer to each
+// file and removes a file when the last reference goes away.
+//
+// Layout: <dir>/<first two hex digits>/<sha256><ext>
+//
+// With a key every blob is encrypted and named by a keyed hash of its
+// contents instead, with an extra .enc extension.
+type BlobStore struct {
+	dir string
+	key *Key
+
+	mu   sync.Mutex
+	refs map[string]int
+}
+
+func NewBlobStore(dir string) (*BlobStore, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &BlobStore{dir: dir, refs: map[string]int{}}, nil
+}
+
+func (b *BlobStore) Dir() string {
+	return b.dir
+}
+
+// Path is where the blob with the given hash and extension lives.
+func (b *BlobStore) Path(hash, ext string) string {
+	return filepath.Join(b.dir, hash[:2], hash+ext)
+}
+
+// Contains reports whether path lies inside the store.
+func (b *BlobStore) Contains(path string) bool {
+	rel, err := filepath.Rel(b.dir, path)
+	return err == nil && rel != "." && !strings.HasPrefix(rel, "..")
+}
+
+// Put stores data unless a blob with the same contents already exists and
+// returns its path and hash. It does not take a reference.
+func (b *BlobStore) Put(data []byte, ext string) (string, string, error) {
+	hash := hashBytes(data)
+	path := b.Path(hash, ext)
+	if b.key != nil {
+		path = b.Path(b.key.blobName(data), ext+encExt)
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if _, err := os.Stat(path); err == nil {
+		return path, hash, nil
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return "", "", err
+	}
+	if b.key != nil {
+		sealed, err := b.key.Seal(data)
+		if err != nil {
+			return "", "", err
+		}
+		data = sealed
+	}
+	if err := writeFileAtomic(path, data, 0644); err != nil {
+		return "", "", err
+	}
+	return path, hash, nil
+}
+
+// encExt is appended to the name of encrypted blobs.
+const encExt = ".enc"
+
+// Read returns the contents of the blob at path, decrypted if need be.
+func (b *BlobStore) Read(path string) ([]byte, error) {
+	return readSealed(path, b.key)
+}
+
+// readSealed reads a file that may have been encrypted with key.
+func readSealed(path string, key *Key) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return openFile(path, data, key)
+}
+
+// Acquire records one more reference to path.
+func (b *BlobStore) Acquire(path string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.refs[filepath.Clean(path)]++
+}
+
+// Release drops a reference to path and deletes the file once nothing
+// refers to it any more. It reports whether the file was deleted.
+func (b *BlobStore) Release(path string) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	path = filepath.Clean(path)
+	if b.refs[path] > 1 {
+		b.refs[path]--
+		return false
+	}
+	delete(b.refs, path)
+	return os.Remove(path) == nil
+}
+
+// Refs returns the number of references to path.
+func (b *BlobStore) Refs(path string) int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.refs[filepath.Clean(path)]
+}
+
+// resetRefs replaces every reference count, as counted from the entries
+// that are loaded.
+func (b *BlobStore) resetRefs(paths []string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.refs = map[string]int{}
+	for _, p := range paths {
+		b.refs[filepath.Clean(p)]++
+	}
+}
+
+// GCReport lists what a garbage collection pass found.
+type GCReport struct {
+	// Removed are files nothing referred to.
+	Removed []string
+	Freed   int64
+	// Missing are the IDs of entries whose file no longer exists.
+	Missing []int
+}
+
+func (r GCReport) String() string {
+	s := fmt.Sprintf("removed %d unreferenced files (%s)", len(r.Removed), FormatBytes(r.Freed))
+	if len(r.Missing) > 0 {
+		s += fmt.Sprintf(", %d entries have lost their image", len(r.Missing))
+	}
+	return s
+}
+
+// sweep deletes files under the store that are not in referenced. Files
+// younger than a minute are kept, since a blob is written before the entry
+// that refers to it is added.
+func (b *BlobStore) sweep(referenced map[string]bool) (GCReport, error) {
+	var report GCReport
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	err := filepath.WalkDir(b.dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if entry.IsDir() {
+			return nil
+		}
+		path = filepath.Clean(path)
+		if referenced[path] || b.refs[path] > 0 {
+			return nil
+		}
+		info, err := entry.Info()
+		if err != nil || time.Since(info.ModTime()) < time.Minute {
+			return nil
+		}
+		if err := os.Remove(path); err != nil {
+			return err
+		}
+		report.Removed = append(report.Removed, path)
+		report.Freed += info.Size()
+		return nil
+	})
+	return report, err
+}
+
+// SetImageDir stores images in a BlobStore rooted at dir. Images added with
+// AddImage land there, and GC and Prune clean it up. If the Database has a
+// key, images stored there before encryption was turned on are encrypted.
+func (d *Database) SetImageDir(dir string) error {
+	blobs, err := NewBlobStore(dir)
+	if err != nil {
+		return err
+	}
+	blobs.key = d.key
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.blobs = blobs
+	d.countRefs()
+	return d.sealImages()
+}
+
+// ReadImage returns the contents of an image entry's file, decrypting it
+// if the store is encrypted.
+func (d *Database) ReadImage(e ClipboardEntry) ([]byte, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return d.readImage(e.ImagePath)
+}
+
+func (d *Database) readImage(path string) ([]byte, error) {
+	if d.blobs != nil {
+		return d.blobs.Read(path)
+	}
+	return readSealed(path, d.key)
+}
+
+// sealImages moves the plain blobs of every entry, trashed ones included,
+// to encrypted ones.
+// Callers must hold d.mu.
+func (d *Database) sealImages() error {
+	if d.key == nil {
+		return nil
+	}
+
+	var ch change
+	var events []Event
+	for _, list := range [][]ClipboardEntry{d.entries, d.trash} {
+		for i, e := range list {
+			if !e.IsImage || !d.blobs.Contains(e.ImagePath) || strings.HasSuffix(e.ImagePath, encExt) {
+				continue
+			}
+			data, err := os.ReadFile(e.ImagePath)
+			if os.IsNotExist(err) {
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			path, _, err := d.blobs.Put(data, filepath.Ext(e.ImagePath))
+			if err != nil {
+				return err
+			}
+			old := e.ImagePath
+			e.ImagePath = path
+			list[i] = e
+			ch.put = append(ch.put, e)
+			if e.DeletedAt.IsZero() {
+				events = append(events, Event{Type: EventUpdated, Entry: e})
+			}
+			d.blobs.Acquire(path)
+			d.blobs.Release(old)
+		}
+	}
+	if len(ch.put) == 0 {
+		return nil
+	}
+	return d.commit(ch, events...)
+}
+
+// RelocateImages points image entries whose files were under the directory
+// from at the same files under to, after the directory has been moved. Paths
+// are compared as stored, so a relative from matches relative paths. It
+// returns how many entries changed.
+func (d *Database) RelocateImages(from, to string) (int, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	var ch change
+	var events []Event
+	for _, list := range [][]ClipboardEntry{d.entries, d.trash} {
+		for i, e := range list {
+			if !e.IsImage || e.ImagePath == "" {
+				continue
+			}
+			rel, err := filepath.Rel(from, e.ImagePath)
+			if err != nil || rel == "." || strings.HasPrefix(rel, "..") {
+				continue
+			}
+			e.ImagePath = filepath.Join(to, rel)
+			list[i] = e
+			ch.put = append(ch.put, e)
+			if e.DeletedAt.IsZero() {
+				events = append(events, Event{Type: EventUpdated, Entry: e})
+			}
+		}
+	}
+	if len(ch.put) == 0 {
+		return 0, nil
+	}
+	d.countRefs()
+	return len(ch.put), d.commit(ch, events...)
+}
+
+// countRefs recounts image and text blob references from the entries.
+// Callers must hold d.mu.
+func (d *Database) countRefs() {
+	var images, texts []string
+	for _, e := range append(d.entries[:len(d.entries):len(d.entries)], d.trash...) {
+		if d.blobs != nil && e.ImagePath != "" && d.blobs.Contains(e.ImagePath) {
+			images = append(images, e.ImagePath)
+		}
+		for _, path := range textBlobs(e) {
+			if d.texts != nil && d.texts.Contains(path) {
+				texts = append(texts, path)
+			}
+		}
+	}
+	if d.blobs != nil {
+		d.blobs.resetRefs(images)
+	}
+	if d.texts != nil {
+		d.texts.resetRefs(texts)
+	}
+}
+
+// AddImage records an image from its encoded PNG bytes. Identical images
+// share one file and one entry.
+func (d *Database) AddImage(data []byte) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return d.addImageLocked(data, Source{})
+}
+
+func (d *Database) addImageLocked(data []byte, src Source) error {
+	if d.blobs == nil {
+		return ErrNoImageDir
+	}
+	if d.ignoresImages() {
+		return ErrIgnored
+	}
+
+	hash := hashBytes(data)
+	d.restoreMissing(hash, data)
+	if found, err := d.bump(hash, src); found {
+		return err
+	}
+
+	path, _, err := d.blobs.Put(data, ".png")
+	if err != nil {
+		return err
+	}
+	return d.insertImage(path, hash, data, src)
+}
+
+// restoreMissing writes data back for an entry with that hash whose blob
+// had gone missing, so copying the image again repairs the entry. Callers
+// must hold d.mu.
+func (d *Database) restoreMissing(hash string, data []byte) {
+	id, ok := d.byHash[hash]
+	if !ok {
+		return
+	}
+	for i, e := range d.entries {
+		if e.ID != id || !e.IsImage || !d.blobs.Contains(e.ImagePath) {
+			continue
+		}
+		if _, err := os.Stat(e.ImagePath); os.IsNotExist(err) {
+			ext := filepath.Ext(strings.TrimSuffix(e.ImagePath, encExt))
+			if path, _, err := d.blobs.Put(data, ext); err == nil {
+				if path != e.ImagePath {
+					d.blobs.Acquire(path)
+					d.blobs.Release(e.ImagePath)
+				}
+				d.entries[i].ImagePath = path
+				d.entries[i].Missing = false
+			}
+		}
+		return
+	}
+}
+
+// releaseFiles drops the entry's references to its text blobs and image
+// file. Images outside the blob store belonged to that entry alone and are
+// deleted outright. Callers must hold d.mu.
+func (d *Database) releaseFiles(e ClipboardEntry) {
+	for _, path := range textBlobs(e) {
+		if d.texts != nil && d.texts.Contains(path) {
+			d.texts.Release(path)
+		}
+	}
+	if !e.IsImage || e.ImagePath == "" {
+		return
+	}
+	if d.blobs != nil && d.blobs.Contains(e.ImagePath) {
+		d.blobs.Release(e.ImagePath)
+		return
+	}
+	os.Remove(e.ImagePath)
+}
+
+// GC removes image and text files that no entry refers to and flags
+// entries whose image file has gone missing.
+func (d *Database) GC() (GCReport, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return d.gcLocked()
+}
+
+func (d *Database) gcLocked() (GCReport, error) {
+	if d.blobs == nil {
+		return GCReport{}, ErrNoImageDir
+	}
+
+	referenced := map[string]bool{}
+	for _, e := range d.trash {
+		if e.IsImage && e.ImagePath != "" {
+			referenced[filepath.Clean(e.ImagePath)] = true
+		}
+	}
+	var ch change
+	var events []Event
+	for i, e := range d.entries {
+		if !e.IsImage || e.ImagePath == "" {
+			continue
+		}
+		referenced[filepath.Clean(e.ImagePath)] = true
+
+		_, err := os.Stat(e.ImagePath)
+		missing := os.IsNotExist(err)
+		if missing != e.Missing {
+			e.Missing = missing
+			d.entries[i] = e
+			ch.put = append(ch.put, e)
+			events = append(events, Event{Type: EventUpdated, Entry: e})
+		}
+	}
+	d.countRefs()
+
+	report, err := d.blobs.sweep(referenced)
+	if d.texts != nil && err == nil {
+		texts := map[string]bool{}
+		for _, e := range append(d.entries[:len(d.entries):len(d.entries)], d.trash...) {
+			for _, path := range textBlobs(e) {
+				texts[filepath.Clean(path)] = true
+			}
+		}
+		var swept GCReport
+		swept, err = d.texts.sweep(texts)
+		report.Removed = append(report.Removed, swept.Removed...)
+		report.Freed += swept.Freed
+	}
+	for _, e := range d.entries {
+		if e.Missing {
+			report.Missing = append(report.Missing, e.ID)
+		}
+	}
+
+	if len(ch.put) > 0 {
+		if commitErr := d.commit(ch, events...); err == nil {
+			err = commitErr
+		}
+	}
+	return report, err
+}
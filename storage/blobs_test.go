@@ -0,0 +1,117 @@
+package storage
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGC(t *testing.T) {
+	tests := []struct {
+		name string
+		// setup adds entries and files and returns the files GC should
+		// remove and keep.
+		setup   func(t *testing.T, db *Database) (removed, kept []string)
+		missing int
+	}{
+		{"orphan image", func(t *testing.T, db *Database) ([]string, []string) {
+			return []string{orphan(t, db.blobs.Dir(), "ab/orphan.png")}, nil
+		}, 0},
+		{"image in the history", func(t *testing.T, db *Database) ([]string, []string) {
+			return nil, []string{addImage(t, db, "in the history")}
+		}, 0},
+		{"image in the trash", func(t *testing.T, db *Database) ([]string, []string) {
+			path := addImage(t, db, "in the trash")
+			entries, _ := db.GetRecent(1)
+			db.DeleteEntry(entries[0].ID)
+			return nil, []string{path}
+		}, 0},
+		{"image file gone", func(t *testing.T, db *Database) ([]string, []string) {
+			os.Remove(addImage(t, db, "gone"))
+			return nil, nil
+		}, 1},
+		{"text blob in the history", func(t *testing.T, db *Database) ([]string, []string) {
+			db.AddEntry(strings.Repeat("long text ", 10))
+			entries, _ := db.GetRecent(1)
+			return nil, []string{entries[0].TextBlob}
+		}, 0},
+		{"orphan text blob", func(t *testing.T, db *Database) ([]string, []string) {
+			return []string{orphan(t, db.texts.Dir(), "cd/orphan.txt.gz")}, nil
+		}, 0},
+		{"new orphan", func(t *testing.T, db *Database) ([]string, []string) {
+			path := filepath.Join(db.blobs.Dir(), "ef", "written.png")
+			os.MkdirAll(filepath.Dir(path), 0o755)
+			os.WriteFile(path, []byte("not added yet"), 0o644)
+			return nil, []string{path}
+		}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			db := NewMemoryStore()
+			defer db.Close()
+			if err := db.SetImageDir(filepath.Join(dir, "images")); err != nil {
+				t.Fatal(err)
+			}
+			if err := db.SetTextDir(filepath.Join(dir, "texts"), 32); err != nil {
+				t.Fatal(err)
+			}
+			removed, kept := tt.setup(t, db)
+
+			report, err := db.GC()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(report.Removed) != len(removed) {
+				t.Errorf("removed %q, want %q", report.Removed, removed)
+			}
+			for _, path := range removed {
+				if _, err := os.Stat(path); !os.IsNotExist(err) {
+					t.Errorf("%s was not removed", path)
+				}
+			}
+			for _, path := range kept {
+				if _, err := os.Stat(path); err != nil {
+					t.Errorf("%s was removed", path)
+				}
+			}
+			if len(report.Missing) != tt.missing {
+				t.Errorf("%d entries flagged missing, want %d", len(report.Missing), tt.missing)
+			}
+			entries, _ := db.GetRecent(math.MaxInt)
+			for _, e := range entries {
+				if e.Missing != (tt.missing > 0) {
+					t.Errorf("#%d missing is %v", e.ID, e.Missing)
+				}
+			}
+		})
+	}
+}
+
+// addImage adds an image entry and returns the path of its file.
+func addImage(t *testing.T, db *Database, contents string) string {
+	t.Helper()
+	if err := db.AddImage([]byte("\x89PNG\r\n\x1a\n" + contents)); err != nil {
+		t.Fatal(err)
+	}
+	entries, _ := db.GetRecent(1)
+	return entries[0].ImagePath
+}
+
+// orphan writes a file under dir that is old enough for GC to remove.
+func orphan(t *testing.T, dir, name string) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte("orphan"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	old := time.Now().Add(-time.Hour)
+	os.Chtimes(path, old, old)
+	return path
+}
@@ -0,0 +1,89 @@
+package storage
+
+import (
+	"bytes"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"os"
+	"strings"
+)
+
+// Selections a capture can come from. X11 and Wayland have a primary
+// selection holding the last selected text besides the clipboard.
+const (
+	SelectionClipboard = "clipboard"
+	SelectionPrimary   = "primary"
+)
+
+// Source tells where a capture came from. The zero Source is the clipboard
+// with unknown MIME types.
+type Source struct {
+	Selection string
+	MIMETypes []string
+}
+
+// AddEntryFrom records text like AddEntry, along with where it came from.
+func (d *Database) AddEntryFrom(text string, src Source) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return d.addTextLocked(text, src)
+}
+
+// AddImageFrom records an image like AddImage, along with where it came
+// from.
+func (d *Database) AddImageFrom(data []byte, src Source) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return d.addImageLocked(data, src)
+}
+
+// describeText fills in the capture metadata of a new text entry.
+func (d *Database) describeText(e *ClipboardEntry, src Source) {
+	e.Size = len(e.Text)
+	e.Lines = lineCount(e.Text)
+	d.describe(e, src)
+}
+
+// describeImage fills in the capture metadata of a new image entry from
+// its file's contents.
+func (d *Database) describeImage(e *ClipboardEntry, data []byte, src Source) {
+	e.Size = len(data)
+	if cfg, format, err := image.DecodeConfig(bytes.NewReader(data)); err == nil {
+		e.Width, e.Height, e.Format = cfg.Width, cfg.Height, format
+		if len(src.MIMETypes) == 0 {
+			src.MIMETypes = []string{"image/" + format}
+		}
+	}
+	d.describe(e, src)
+}
+
+func (d *Database) describe(e *ClipboardEntry, src Source) {
+	e.Selection = src.Selection
+	if e.Selection == "" {
+		e.Selection = SelectionClipboard
+	}
+	e.MIMETypes = src.MIMETypes
+	e.Host = d.host
+}
+
+// lineCount counts the lines of text; a final line break does not start
+// another one.
+func lineCount(text string) int {
+	if text == "" {
+		return 0
+	}
+	return strings.Count(strings.TrimSuffix(text, "\n"), "\n") + 1
+}
+
+// hostname names the machine captures are made on.
+func hostname() string {
+	name, err := os.Hostname()
+	if err != nil {
+		return ""
+	}
+	return name
+}
@@ -0,0 +1,286 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ErrCollectionExists is returned when a collection is created or renamed
+// to a name already in use.
+var ErrCollectionExists = errors.New("a collection with that name already exists")
+
+// ErrNoCollection is returned for an unknown collection ID.
+var ErrNoCollection = errors.New("collection not found")
+
+// Collection is a named, ordered group of entries, kept apart from the
+// history order. An entry can be in any number of collections, and entries
+// in one are never removed by retention.
+type Collection struct {
+	ID      int       `json:"id"`
+	Name    string    `json:"name"`
+	Entries []int     `json:"entries"`
+	Created time.Time `json:"created"`
+}
+
+// Collections returns every collection in the order they were arranged.
+func (d *Database) Collections() ([]Collection, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	return append([]Collection(nil), d.collections...), nil
+}
+
+// CollectionEntries returns the entries of a collection in its order.
+// Entries that are in the trash are left out until they are restored.
+func (d *Database) CollectionEntries(id int) ([]ClipboardEntry, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	i := d.collectionIndex(id)
+	if i < 0 {
+		return nil, ErrNoCollection
+	}
+	var entries []ClipboardEntry
+	for _, entryID := range d.collections[i].Entries {
+		if j := d.entryIndex(entryID); j >= 0 {
+			entries = append(entries, d.entries[j])
+		}
+	}
+	return entries, nil
+}
+
+// CreateCollection adds an empty collection at the end.
+func (d *Database) CreateCollection(name string) (Collection, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	name, err := d.collectionName(name, 0)
+	if err != nil {
+		return Collection{}, err
+	}
+	c := Collection{ID: 1, Name: name, Entries: []int{}, Created: time.Now()}
+	for _, other := range d.collections {
+		c.ID = max(c.ID, other.ID+1)
+	}
+	cs := append(d.cloneCollections(), c)
+	return c, d.setCollections(cs)
+}
+
+func (d *Database) RenameCollection(id int, name string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	i := d.collectionIndex(id)
+	if i < 0 {
+		return ErrNoCollection
+	}
+	name, err := d.collectionName(name, id)
+	if err != nil {
+		return err
+	}
+	cs := d.cloneCollections()
+	cs[i].Name = name
+	return d.setCollections(cs)
+}
+
+// DeleteCollection removes a collection. Its entries stay in the history.
+func (d *Database) DeleteCollection(id int) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	i := d.collectionIndex(id)
+	if i < 0 {
+		return ErrNoCollection
+	}
+	cs := d.cloneCollections()
+	return d.setCollections(append(cs[:i], cs[i+1:]...))
+}
+
+// MoveCollection puts a collection at index among the others, counting
+// from 0.
+func (d *Database) MoveCollection(id, index int) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	i := d.collectionIndex(id)
+	if i < 0 {
+		return ErrNoCollection
+	}
+	return d.setCollections(move(d.cloneCollections(), i, index))
+}
+
+// AddToCollection appends an entry to a collection. Adding an entry that is
+// already in it does nothing.
+func (d *Database) AddToCollection(id, entryID int) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	i := d.collectionIndex(id)
+	if i < 0 {
+		return ErrNoCollection
+	}
+	if d.entryIndex(entryID) < 0 {
+		return ErrNotFound
+	}
+	if indexOf(d.collections[i].Entries, entryID) >= 0 {
+		return nil
+	}
+	cs := d.cloneCollections()
+	cs[i].Entries = append(cs[i].Entries, entryID)
+	return d.setCollections(cs)
+}
+
+func (d *Database) RemoveFromCollection(id, entryID int) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	i := d.collectionIndex(id)
+	if i < 0 {
+		return ErrNoCollection
+	}
+	j := indexOf(d.collections[i].Entries, entryID)
+	if j < 0 {
+		return ErrNotFound
+	}
+	cs := d.cloneCollections()
+	cs[i].Entries = append(cs[i].Entries[:j], cs[i].Entries[j+1:]...)
+	return d.setCollections(cs)
+}
+
+// MoveInCollection puts an entry at index within a collection, counting
+// from 0.
+func (d *Database) MoveInCollection(id, entryID, index int) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	i := d.collectionIndex(id)
+	if i < 0 {
+		return ErrNoCollection
+	}
+	j := indexOf(d.collections[i].Entries, entryID)
+	if j < 0 {
+		return ErrNotFound
+	}
+	cs := d.cloneCollections()
+	cs[i].Entries = move(cs[i].Entries, j, index)
+	return d.setCollections(cs)
+}
+
+// collectionName checks a new name for the collection id, 0 for a new one.
+func (d *Database) collectionName(name string, id int) (string, error) {
+	name = strings.Join(strings.Fields(name), " ")
+	if name == "" {
+		return "", errors.New("collection name is empty")
+	}
+	for _, c := range d.collections {
+		if c.ID != id && strings.EqualFold(c.Name, name) {
+			return "", fmt.Errorf("%w: %s", ErrCollectionExists, c.Name)
+		}
+	}
+	return name, nil
+}
+
+func (d *Database) collectionIndex(id int) int {
+	for i, c := range d.collections {
+		if c.ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// collected reports whether an entry is in any collection.
+func (d *Database) collected(entryID int) bool {
+	for _, c := range d.collections {
+		if indexOf(c.Entries, entryID) >= 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// cloneCollections copies d.collections for a change. Committed slices are
+// shared with the engines and never modified in place.
+func (d *Database) cloneCollections() []Collection {
+	cs := make([]Collection, len(d.collections))
+	for i, c := range d.collections {
+		c.Entries = append([]int{}, c.Entries...)
+		cs[i] = c
+	}
+	return cs
+}
+
+// setCollections replaces and commits the collections. Callers must hold
+// d.mu.
+func (d *Database) setCollections(cs []Collection) error {
+	d.collections = cs
+	return d.commit(change{collections: cs}, Event{Type: EventCollections})
+}
+
+// replaceMember puts entry to in the place of from, which was merged into
+// it, and returns whether any collection changed. Callers must hold d.mu.
+func (d *Database) replaceMember(from, to int) bool {
+	if !d.collected(from) {
+		return false
+	}
+	cs := d.cloneCollections()
+	for i := range cs {
+		j := indexOf(cs[i].Entries, from)
+		if j < 0 {
+			continue
+		}
+		if indexOf(cs[i].Entries, to) >= 0 {
+			cs[i].Entries = append(cs[i].Entries[:j], cs[i].Entries[j+1:]...)
+		} else {
+			cs[i].Entries[j] = to
+		}
+	}
+	d.collections = cs
+	return true
+}
+
+// dropMembers takes entries deleted for good out of every collection and
+// returns whether any collection changed. Callers must hold d.mu.
+func (d *Database) dropMembers(ids []int) bool {
+	gone := map[int]bool{}
+	for _, id := range ids {
+		if d.collected(id) {
+			gone[id] = true
+		}
+	}
+	if len(gone) == 0 {
+		return false
+	}
+	cs := d.cloneCollections()
+	for i := range cs {
+		kept := cs[i].Entries[:0]
+		for _, id := range cs[i].Entries {
+			if !gone[id] {
+				kept = append(kept, id)
+			}
+		}
+		cs[i].Entries = kept
+	}
+	d.collections = cs
+	return true
+}
+
+func indexOf(ids []int, id int) int {
+	for i, v := range ids {
+		if v == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// move returns s with the element at from moved to index to, clamped to
+// the bounds of s.
+func move[T any](s []T, from, to int) []T {
+	to = max(0, min(to, len(s)-1))
+	v := s[from]
+	s = append(s[:from], s[from+1:]...)
+	return append(s[:to], append([]T{v}, s[to:]...)...)
+}
@@ -0,0 +1,324 @@
+package storage
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hkdf"
+	"crypto/hmac"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+var (
+	// ErrWrongKey is returned when a passphrase or key file does not
+	// unlock the key header of a store.
+	ErrWrongKey = errors.New("wrong passphrase or key file")
+	// ErrEncrypted is returned when an encrypted store is opened without
+	// a key.
+	ErrEncrypted = errors.New("store is encrypted, a passphrase or key file is required")
+)
+
+// sealedMagic starts every encrypted file so it can be told apart from the
+// plain files written before encryption was turned on.
+var sealedMagic = []byte("CMENC1\n")
+
+const (
+	pbkdf2Iterations = 600000
+	dataKeyLen       = 32
+)
+
+// KeySource is what unlocks a store: a passphrase or the path of a key
+// file, whose whole contents are the secret.
+type KeySource struct {
+	Passphrase string
+	KeyFile    string
+}
+
+func (s KeySource) secret() ([]byte, string, error) {
+	switch {
+	case s.KeyFile != "":
+		data, err := os.ReadFile(s.KeyFile)
+		if err != nil {
+			return nil, "", err
+		}
+		if len(bytes.TrimSpace(data)) == 0 {
+			return nil, "", fmt.Errorf("key file %s is empty", s.KeyFile)
+		}
+		return data, "keyfile-hkdf-sha256", nil
+	case s.Passphrase != "":
+		return []byte(s.Passphrase), "pbkdf2-sha256", nil
+	default:
+		return nil, "", errors.New("no passphrase or key file given")
+	}
+}
+
+// keyHeader is stored next to an encrypted store. The data key that
+// actually encrypts the history is random; the header keeps it wrapped
+// under a key derived from the passphrase or key file, so changing the
+// passphrase only rewrites the header.
+type keyHeader struct {
+	Version    int    `json:"version"`
+	KDF        string `json:"kdf"`
+	Iterations int    `json:"iterations,omitempty"`
+	Salt       []byte `json:"salt"`
+	WrappedKey []byte `json:"wrapped_key"`
+}
+
+// Key encrypts and authenticates store contents with AES-256-GCM.
+type Key struct {
+	aead    cipher.AEAD
+	nameKey []byte
+}
+
+// UnlockKey unwraps the data key described by the header in headerPath.
+// If there is no header yet a new random data key is created and wrapped
+// with src.
+func UnlockKey(headerPath string, src KeySource) (*Key, error) {
+	data, err := os.ReadFile(headerPath)
+	if os.IsNotExist(err) {
+		dataKey := make([]byte, dataKeyLen)
+		if _, err := rand.Read(dataKey); err != nil {
+			return nil, err
+		}
+		if err := writeKeyHeader(headerPath, dataKey, src); err != nil {
+			return nil, err
+		}
+		return newKey(dataKey)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var h keyHeader
+	if err := json.Unmarshal(data, &h); err != nil {
+		return nil, fmt.Errorf("read key header %s: %w", headerPath, err)
+	}
+	dataKey, err := h.unwrap(src)
+	if err != nil {
+		return nil, err
+	}
+	return newKey(dataKey)
+}
+
+// RotateKey re-wraps the data key of the store with a new passphrase or
+// key file. The old one stops working; the history itself does not have
+// to be re-encrypted.
+func RotateKey(headerPath string, old, next KeySource) error {
+	data, err := os.ReadFile(headerPath)
+	if err != nil {
+		return err
+	}
+	var h keyHeader
+	if err := json.Unmarshal(data, &h); err != nil {
+		return fmt.Errorf("read key header %s: %w", headerPath, err)
+	}
+	dataKey, err := h.unwrap(old)
+	if err != nil {
+		return err
+	}
+	return writeKeyHeader(headerPath, dataKey, next)
+}
+
+// KeyHeaderExists reports whether the store has been encrypted.
+func KeyHeaderExists(headerPath string) bool {
+	_, err := os.Stat(headerPath)
+	return err == nil
+}
+
+func writeKeyHeader(path string, dataKey []byte, src KeySource) error {
+	secret, kdf, err := src.secret()
+	if err != nil {
+		return err
+	}
+	h := keyHeader{Version: 1, KDF: kdf, Salt: make([]byte, 16)}
+	if _, err := rand.Read(h.Salt); err != nil {
+		return err
+	}
+	if kdf == "pbkdf2-sha256" {
+		h.Iterations = pbkdf2Iterations
+	}
+
+	wrapping, err := h.derive(secret)
+	if err != nil {
+		return err
+	}
+	if h.WrappedKey, err = sealAEAD(wrapping, dataKey); err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(h, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(path, data, 0600)
+}
+
+func (h keyHeader) derive(secret []byte) (cipher.AEAD, error) {
+	var kek []byte
+	var err error
+	switch h.KDF {
+	case "pbkdf2-sha256":
+		kek, err = pbkdf2.Key(sha256.New, string(secret), h.Salt, h.Iterations, dataKeyLen)
+	case "keyfile-hkdf-sha256":
+		kek, err = hkdf.Key(sha256.New, secret, h.Salt, "clipboard_manager key file", dataKeyLen)
+	default:
+		return nil, fmt.Errorf("unknown key derivation %q", h.KDF)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return newAEAD(kek)
+}
+
+func (h keyHeader) unwrap(src KeySource) ([]byte, error) {
+	secret, kdf, err := src.secret()
+	if err != nil {
+		return nil, err
+	}
+	if kdf != h.KDF {
+		return nil, fmt.Errorf("store is locked with a %s, not a %s: %w", kdfName(h.KDF), kdfName(kdf), ErrWrongKey)
+	}
+	wrapping, err := h.derive(secret)
+	if err != nil {
+		return nil, err
+	}
+	dataKey, err := openAEAD(wrapping, h.WrappedKey)
+	if err != nil {
+		return nil, ErrWrongKey
+	}
+	return dataKey, nil
+}
+
+func kdfName(kdf string) string {
+	if strings.HasPrefix(kdf, "keyfile") {
+		return "key file"
+	}
+	return "passphrase"
+}
+
+func newKey(dataKey []byte) (*Key, error) {
+	encKey, err := hkdf.Key(sha256.New, dataKey, nil, "clipboard_manager encryption", dataKeyLen)
+	if err != nil {
+		return nil, err
+	}
+	nameKey, err := hkdf.Key(sha256.New, dataKey, nil, "clipboard_manager blob names", dataKeyLen)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := newAEAD(encKey)
+	if err != nil {
+		return nil, err
+	}
+	return &Key{aead: aead, nameKey: nameKey}, nil
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func sealAEAD(aead cipher.AEAD, plaintext []byte) ([]byte, error) {
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, plaintext, nil), nil
+}
+
+func openAEAD(aead cipher.AEAD, sealed []byte) ([]byte, error) {
+	if len(sealed) < aead.NonceSize() {
+		return nil, errors.New("ciphertext too short")
+	}
+	nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+	return aead.Open(nil, nonce, ciphertext, nil)
+}
+
+// Seal encrypts a whole file's worth of data.
+func (k *Key) Seal(plaintext []byte) ([]byte, error) {
+	sealed, err := sealAEAD(k.aead, plaintext)
+	if err != nil {
+		return nil, err
+	}
+	return append(append([]byte(nil), sealedMagic...), sealed...), nil
+}
+
+// Open decrypts data produced by Seal.
+func (k *Key) Open(data []byte) ([]byte, error) {
+	if !IsSealed(data) {
+		return nil, errors.New("data is not encrypted")
+	}
+	plaintext, err := openAEAD(k.aead, data[len(sealedMagic):])
+	if err != nil {
+		return nil, fmt.Errorf("decrypt: %w", ErrWrongKey)
+	}
+	return plaintext, nil
+}
+
+// openFile decrypts the contents of the file called name if they are
+// encrypted and returns them unchanged otherwise.
+func openFile(name string, data []byte, key *Key) ([]byte, error) {
+	if !IsSealed(data) {
+		return data, nil
+	}
+	if key == nil {
+		return nil, fmt.Errorf("%s: %w", name, ErrEncrypted)
+	}
+	plaintext, err := key.Open(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	return plaintext, nil
+}
+
+// IsSealed reports whether data was produced by Key.Seal.
+func IsSealed(data []byte) bool {
+	return bytes.HasPrefix(data, sealedMagic)
+}
+
+// sealString encrypts a short value, such as one journal line or one
+// column, into printable text.
+func (k *Key) sealString(plaintext []byte) (string, error) {
+	sealed, err := sealAEAD(k.aead, plaintext)
+	if err != nil {
+		return "", err
+	}
+	return sealedPrefix + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+func (k *Key) openString(s string) ([]byte, error) {
+	raw, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(s, sealedPrefix))
+	if err != nil {
+		return nil, err
+	}
+	plaintext, err := openAEAD(k.aead, raw)
+	if err != nil {
+		return nil, fmt.Errorf("decrypt: %w", ErrWrongKey)
+	}
+	return plaintext, nil
+}
+
+const sealedPrefix = "enc:"
+
+func isSealedString(s string) bool {
+	return strings.HasPrefix(s, sealedPrefix)
+}
+
+// blobName is the file name an encrypted blob is stored under. It is keyed
+// so that the name does not reveal the hash of the plain contents.
+func (k *Key) blobName(data []byte) string {
+	mac := hmac.New(sha256.New, k.nameKey)
+	mac.Write(data)
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,351 @@
+package storage
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// unlock creates or unlocks the key header in dir with src.
+func unlock(t *testing.T, dir string, src KeySource) *Key {
+	t.Helper()
+	key, err := UnlockKey(filepath.Join(dir, "key.json"), src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func keyFile(t *testing.T, dir, name, secret string) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte(secret), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestSealOpen(t *testing.T) {
+	key := unlock(t, t.TempDir(), KeySource{Passphrase: "correct horse"})
+	other := unlock(t, t.TempDir(), KeySource{Passphrase: "correct horse"})
+
+	tests := []struct {
+		name      string
+		plaintext []byte
+	}{
+		{"empty", []byte{}},
+		{"text", []byte("hello, clipboard")},
+		{"binary", bytes.Repeat([]byte{0, 1, 2, 0xff}, 4096)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sealed, err := key.Seal(tt.plaintext)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !IsSealed(sealed) {
+				t.Fatal("sealed data is not marked as sealed")
+			}
+			if len(tt.plaintext) > 0 && bytes.Contains(sealed, tt.plaintext) {
+				t.Fatal("sealed data contains the plaintext")
+			}
+			got, err := key.Open(sealed)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, tt.plaintext) {
+				t.Errorf("Open = %q, want %q", got, tt.plaintext)
+			}
+
+			// A different data key, even behind the same passphrase, and
+			// any tampering are both refused.
+			if _, err := other.Open(sealed); !errors.Is(err, ErrWrongKey) {
+				t.Errorf("Open with another key: %v, want ErrWrongKey", err)
+			}
+			tampered := append([]byte(nil), sealed...)
+			tampered[len(tampered)-1] ^= 1
+			if _, err := key.Open(tampered); !errors.Is(err, ErrWrongKey) {
+				t.Errorf("Open tampered data: %v, want ErrWrongKey", err)
+			}
+
+			line, err := key.sealString(tt.plaintext)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !isSealedString(line) || strings.ContainsAny(line, "\n") {
+				t.Fatalf("sealString = %q, want one enc: line", line)
+			}
+			if got, err := key.openString(line); err != nil || !bytes.Equal(got, tt.plaintext) {
+				t.Errorf("openString = %q, %v, want %q", got, err, tt.plaintext)
+			}
+		})
+	}
+
+	if _, err := key.Open([]byte("plain text")); err == nil {
+		t.Error("Open accepted data that was never sealed")
+	}
+}
+
+func TestUnlockKey(t *testing.T) {
+	dir := t.TempDir()
+	right := keyFile(t, dir, "right.key", "first secret")
+	wrong := keyFile(t, dir, "wrong.key", "second secret")
+	empty := keyFile(t, dir, "empty.key", " \n")
+
+	tests := []struct {
+		name   string
+		locked KeySource
+		src    KeySource
+		err    error
+	}{
+		{"same passphrase", KeySource{Passphrase: "hunter2"}, KeySource{Passphrase: "hunter2"}, nil},
+		{"wrong passphrase", KeySource{Passphrase: "hunter2"}, KeySource{Passphrase: "hunter3"}, ErrWrongKey},
+		{"same key file", KeySource{KeyFile: right}, KeySource{KeyFile: right}, nil},
+		{"wrong key file", KeySource{KeyFile: right}, KeySource{KeyFile: wrong}, ErrWrongKey},
+		{"key file for a passphrase", KeySource{Passphrase: "hunter2"}, KeySource{KeyFile: right}, ErrWrongKey},
+		{"passphrase for a key file", KeySource{KeyFile: right}, KeySource{Passphrase: "first secret"}, ErrWrongKey},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			key := unlock(t, dir, tt.locked)
+			sealed, err := key.Seal([]byte("secret"))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			again, err := UnlockKey(filepath.Join(dir, "key.json"), tt.src)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("UnlockKey: %v, want %v", err, tt.err)
+			}
+			if err != nil {
+				return
+			}
+			if got, err := again.Open(sealed); err != nil || string(got) != "secret" {
+				t.Errorf("unlocked key opens %q, %v", got, err)
+			}
+		})
+	}
+
+	for _, src := range []KeySource{{}, {KeyFile: empty}, {KeyFile: filepath.Join(dir, "missing.key")}} {
+		if _, err := UnlockKey(filepath.Join(t.TempDir(), "key.json"), src); err == nil {
+			t.Errorf("UnlockKey(%+v) created a key", src)
+		}
+	}
+}
+
+func TestRotateKey(t *testing.T) {
+	dir := t.TempDir()
+	header := filepath.Join(dir, "key.json")
+	keyPath := keyFile(t, dir, "new.key", "rotated secret")
+	old := KeySource{Passphrase: "old passphrase"}
+
+	tests := []struct {
+		name string
+		next KeySource
+	}{
+		{"passphrase", KeySource{Passphrase: "new passphrase"}},
+		{"key file", KeySource{KeyFile: keyPath}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			os.Remove(header)
+			key := unlock(t, dir, old)
+			sealed, err := key.Seal([]byte("kept across rotation"))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if err := RotateKey(header, KeySource{Passphrase: "not it"}, tt.next); !errors.Is(err, ErrWrongKey) {
+				t.Fatalf("rotate with a wrong key: %v, want ErrWrongKey", err)
+			}
+			if err := RotateKey(header, old, tt.next); err != nil {
+				t.Fatal(err)
+			}
+
+			if _, err := UnlockKey(header, old); !errors.Is(err, ErrWrongKey) {
+				t.Errorf("old key still unlocks: %v", err)
+			}
+			rotated, err := UnlockKey(header, tt.next)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// Only the header changes; data sealed before still opens.
+			if got, err := rotated.Open(sealed); err != nil || string(got) != "kept across rotation" {
+				t.Errorf("Open after rotation = %q, %v", got, err)
+			}
+		})
+	}
+}
+
+func TestEncryptedStore(t *testing.T) {
+	tests := []struct {
+		name string
+		open func(dir string, opts ...Option) (*Database, error)
+		file string
+	}{
+		{"json", func(dir string, opts ...Option) (*Database, error) {
+			return NewDatabase(filepath.Join(dir, "history.json"), opts...)
+		}, "history.json"},
+		{"sqlite", func(dir string, opts ...Option) (*Database, error) {
+			return NewSQLiteDatabase(filepath.Join(dir, "history.db"), "", opts...)
+		}, "history.db"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			src := KeySource{Passphrase: "store passphrase"}
+			key := unlock(t, dir, src)
+
+			db, err := tt.open(dir, WithKey(key))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := db.AddEntry("top secret clipboard text"); err != nil {
+				t.Fatal(err)
+			}
+			if err := db.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			files, err := filepath.Glob(filepath.Join(dir, tt.file+"*"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, name := range files {
+				data, err := os.ReadFile(name)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if bytes.Contains(data, []byte("top secret")) {
+					t.Errorf("%s holds the text in the clear", filepath.Base(name))
+				}
+			}
+
+			if db, err := tt.open(dir); !errors.Is(err, ErrEncrypted) {
+				if err == nil {
+					db.Close()
+				}
+				t.Errorf("open without a key: %v, want ErrEncrypted", err)
+			}
+			if db, err := tt.open(dir, WithKey(unlock(t, t.TempDir(), src))); err == nil {
+				db.Close()
+				t.Error("opened with another data key")
+			}
+
+			db, err = tt.open(dir, WithKey(unlock(t, dir, src)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer db.Close()
+			if got := texts(t, db); !equalStrings(got, []string{"top secret clipboard text"}) {
+				t.Errorf("entries = %q", got)
+			}
+		})
+	}
+}
+
+func TestEncryptedImages(t *testing.T) {
+	png := append([]byte("\x89PNG\r\n\x1a\n"), bytes.Repeat([]byte("pixel"), 100)...)
+
+	tests := []struct {
+		name string
+		key  bool
+		ext  string
+	}{
+		{"plain", false, ".png"},
+		{"encrypted", true, ".png" + encExt},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			var opts []Option
+			if tt.key {
+				opts = append(opts, WithKey(unlock(t, dir, KeySource{Passphrase: "images"})))
+			}
+			db, err := NewDatabase(filepath.Join(dir, "history.json"), opts...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer db.Close()
+			if err := db.SetImageDir(filepath.Join(dir, "images")); err != nil {
+				t.Fatal(err)
+			}
+			if err := db.AddImage(png); err != nil {
+				t.Fatal(err)
+			}
+
+			entries, _ := db.GetRecent(1)
+			if len(entries) != 1 || !entries[0].IsImage {
+				t.Fatalf("entries = %+v, want one image", entries)
+			}
+			path := entries[0].ImagePath
+			if !strings.HasSuffix(path, tt.ext) {
+				t.Errorf("image stored as %s, want a %s file", filepath.Base(path), tt.ext)
+			}
+			stored, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if IsSealed(stored) != tt.key {
+				t.Errorf("stored file sealed = %v, want %v", IsSealed(stored), tt.key)
+			}
+			// The name must not give away the hash of the plain image.
+			if tt.key && strings.Contains(path, hashBytes(png)) {
+				t.Error("encrypted image is named after its plain hash")
+			}
+
+			got, err := db.ReadImage(entries[0])
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, png) {
+				t.Error("ReadImage does not return the original image")
+			}
+		})
+	}
+}
+
+func TestSealImages(t *testing.T) {
+	dir := t.TempDir()
+	name := filepath.Join(dir, "history.json")
+	images := filepath.Join(dir, "images")
+	png := []byte("\x89PNG\r\n\x1a\nplain before encryption")
+
+	db, err := NewDatabase(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.SetImageDir(images); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AddImage(png); err != nil {
+		t.Fatal(err)
+	}
+	entries, _ := db.GetRecent(1)
+	plain := entries[0].ImagePath
+	db.Close()
+
+	// Turning encryption on seals the images already stored.
+	db, err = NewDatabase(name, WithKey(unlock(t, dir, KeySource{Passphrase: "later"})))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if err := db.SetImageDir(images); err != nil {
+		t.Fatal(err)
+	}
+	entries, _ = db.GetRecent(1)
+	if !strings.HasSuffix(entries[0].ImagePath, encExt) {
+		t.Fatalf("image left at %s", entries[0].ImagePath)
+	}
+	if _, err := os.Stat(plain); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("plain image left behind: %v", err)
+	}
+	if got, err := db.ReadImage(entries[0]); err != nil || !bytes.Equal(got, png) {
+		t.Errorf("ReadImage = %q, %v", got, err)
+	}
+}
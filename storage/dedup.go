@@ -0,0 +1,126 @@
+package storage
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"time"
+)
+
+func hashBytes(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// entryHash is the content hash used to find copies of the same content:
+// the whole text, or the bytes of the image file.
+func (d *Database) entryHash(e ClipboardEntry) string {
+	if e.IsImage && e.ImagePath != "" {
+		if data, err := d.readImage(e.ImagePath); err == nil {
+			return hashBytes(data)
+		}
+		return hashBytes([]byte(e.ImagePath))
+	}
+	if e.Offloaded() {
+		if text, err := d.loadText(e); err == nil {
+			return hashBytes([]byte(text))
+		}
+	}
+	return hashBytes([]byte(e.Text))
+}
+
+// lastUsed is when the entry was last copied, for entries stored before
+// copies were counted it is when it was first copied.
+func lastUsed(e ClipboardEntry) time.Time {
+	if e.LastUsed.IsZero() {
+		return e.Timestamp
+	}
+	return e.LastUsed
+}
+
+// reindex fills in hashes and copy counts missing from older stores and
+// rebuilds the hash index. It returns the entries it had to fix so they can
+// be written back. Callers must hold d.mu.
+func (d *Database) reindex() []ClipboardEntry {
+	var fixed []ClipboardEntry
+	d.byHash = make(map[string]int, len(d.entries))
+	for i := range d.entries {
+		e := &d.entries[i]
+		changed := false
+		if e.Hash == "" {
+			e.Hash = d.entryHash(*e)
+			changed = true
+		}
+		if e.CopyCount == 0 {
+			e.CopyCount = 1
+			changed = true
+		}
+		if e.LastUsed.IsZero() {
+			e.LastUsed = e.Timestamp
+			changed = true
+		}
+		if changed {
+			fixed = append(fixed, *e)
+		}
+		if _, dup := d.byHash[e.Hash]; !dup {
+			d.byHash[e.Hash] = e.ID
+		}
+	}
+	return fixed
+}
+
+// bump moves the entry with the given content hash to the top of the
+// history as if it had just been copied from src. It reports false when no
+// entry has that content. Callers must hold d.mu.
+func (d *Database) bump(hash string, src Source) (bool, error) {
+	id, ok := d.byHash[hash]
+	if !ok {
+		return false, nil
+	}
+
+	for i, entry := range d.entries {
+		if entry.ID != id {
+			continue
+		}
+		sel := src.Selection
+		if sel == "" {
+			sel = SelectionClipboard
+		}
+		if i == 0 && selection(entry) != sel {
+			// Highlighting text and then copying it records it from both
+			// selections; that is a single copy. An entry copied to the
+			// clipboard is marked so either way.
+			if sel != SelectionClipboard {
+				return true, nil
+			}
+			entry.Selection = sel
+			d.entries[0] = entry
+			return true, d.commit(change{put: []ClipboardEntry{entry}}, Event{Type: EventUpdated, Entry: entry})
+		}
+		if sel == SelectionClipboard {
+			entry.Selection = sel
+		}
+		entry.CopyCount++
+		entry.LastUsed = time.Now()
+
+		entries := make([]ClipboardEntry, 0, len(d.entries))
+		entries = append(entries, entry)
+		entries = append(entries, d.entries[:i]...)
+		entries = append(entries, d.entries[i+1:]...)
+		d.entries = entries
+
+		return true, d.commit(change{put: []ClipboardEntry{entry}}, Event{Type: EventUpdated, Entry: entry})
+	}
+
+	// The index pointed at an entry that is gone.
+	delete(d.byHash, hash)
+	return false, nil
+}
+
+// unindex drops removed entries from the hash index. Callers must hold d.mu.
+func (d *Database) unindex(removed ...ClipboardEntry) {
+	for _, e := range removed {
+		if d.byHash[e.Hash] == e.ID {
+			delete(d.byHash, e.Hash)
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package storage
+
+import (
+	"math"
+	"path/filepath"
+	"testing"
+)
+
+func TestDuplicates(t *testing.T) {
+	type copy struct {
+		text      string
+		selection string
+	}
+	type want struct {
+		text      string
+		copies    int
+		selection string
+	}
+	tests := []struct {
+		name   string
+		copies []copy
+		want   []want
+	}{
+		{"different texts", []copy{{"a", ""}, {"b", ""}},
+			[]want{{"b", 1, SelectionClipboard}, {"a", 1, SelectionClipboard}}},
+		{"same text twice", []copy{{"a", ""}, {"a", ""}},
+			[]want{{"a", 2, SelectionClipboard}}},
+		{"copied again later", []copy{{"a", ""}, {"b", ""}, {"c", ""}, {"a", ""}},
+			[]want{{"a", 2, SelectionClipboard}, {"c", 1, SelectionClipboard}, {"b", 1, SelectionClipboard}}},
+		{"only the bytes count", []copy{{"a", ""}, {"a ", ""}, {"A", ""}},
+			[]want{{"A", 1, SelectionClipboard}, {"a ", 1, SelectionClipboard}, {"a", 1, SelectionClipboard}}},
+		{"highlighted then copied", []copy{{"a", SelectionPrimary}, {"a", SelectionClipboard}},
+			[]want{{"a", 1, SelectionClipboard}}},
+		{"copied then highlighted", []copy{{"a", SelectionClipboard}, {"a", SelectionPrimary}},
+			[]want{{"a", 1, SelectionClipboard}}},
+		{"highlighted again later", []copy{{"a", SelectionPrimary}, {"b", SelectionPrimary}, {"a", SelectionPrimary}},
+			[]want{{"a", 2, SelectionPrimary}, {"b", 1, SelectionPrimary}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			name := filepath.Join(t.TempDir(), "history.json")
+			db, err := NewDatabase(name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i, c := range tt.copies {
+				if err := db.AddEntryFrom(c.text, Source{Selection: c.selection}); err != nil {
+					t.Fatal(err)
+				}
+				// Copies after a restart find the entries from before.
+				if i == len(tt.copies)/2 {
+					db.Close()
+					if db, err = NewDatabase(name); err != nil {
+						t.Fatal(err)
+					}
+				}
+			}
+			defer db.Close()
+
+			entries, err := db.GetRecent(math.MaxInt)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(entries) != len(tt.want) {
+				t.Fatalf("got %d entries, want %d", len(entries), len(tt.want))
+			}
+			for i, w := range tt.want {
+				e := entries[i]
+				if e.Text != w.text || e.CopyCount != w.copies || selection(e) != w.selection {
+					t.Errorf("entry %d = %q copied %d times from the %s, want %q %d times from the %s",
+						i, e.Text, e.CopyCount, selection(e), w.text, w.copies, w.selection)
+				}
+			}
+		})
+	}
+}
+
+func TestDuplicateImages(t *testing.T) {
+	dir := t.TempDir()
+	db, err := NewDatabase(filepath.Join(dir, "history.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if err := db.SetImageDir(filepath.Join(dir, "images")); err != nil {
+		t.Fatal(err)
+	}
+	png := []byte("\x89PNG\r\n\x1a\nsame image")
+	db.AddImage(png)
+	db.AddEntry("between")
+	db.AddImage(png)
+
+	entries, _ := db.GetRecent(math.MaxInt)
+	if len(entries) != 2 || !entries[0].IsImage || entries[0].CopyCount != 2 {
+		t.Fatalf("got %v, want the image on top copied twice", entries)
+	}
+	if refs := db.blobs.Refs(entries[0].ImagePath); refs != 1 {
+		t.Errorf("image file has %d references, want 1", refs)
+	}
+
+	// A deleted image copied again is a new entry, sharing the file with
+	// the one in the trash.
+	db.DeleteEntry(entries[0].ID)
+	db.AddImage(png)
+	again, _ := db.GetRecent(1)
+	if again[0].ID == entries[0].ID || again[0].CopyCount != 1 {
+		t.Errorf("copied after deleting: #%d copied %d times, want a new entry", again[0].ID, again[0].CopyCount)
+	}
+	if refs := db.blobs.Refs(again[0].ImagePath); refs != 2 {
+		t.Errorf("image file has %d references, want 2", refs)
+	}
+}
@@ -0,0 +1,97 @@
+package storage
+
+import "sort"
+
+// engine persists the state held by a Database. Every mutation is handed to
+// commit together with the full snapshot so file based engines can rewrite
+// the whole history while row based engines only apply the change.
+// saved reads back what is on disk without writing anything; a Database
+// uses it to undo its in-memory state when a commit fails.
+type engine interface {
+	load() (*snapshot, error)
+	saved() (*snapshot, error)
+	commit(s *snapshot, ch change) error
+	close() error
+}
+
+type snapshot struct {
+	Version int              `json:"version"`
+	Entries []ClipboardEntry `json:"entries"`
+	// Trash holds deleted entries when a Database commits. On disk they
+	// are stored among Entries with DeletedAt set.
+	Trash       []ClipboardEntry `json:"-"`
+	NextID      int              `json:"next_id"`
+	Collections []Collection     `json:"collections,omitempty"`
+}
+
+// change is what a commit alters. Collections are small and written as a
+// whole: when collections is not nil it replaces all of them. The files of
+// the entries in release are only let go of once the change is committed,
+// so a failed commit does not leave entries pointing at deleted files;
+// engines do not look at it.
+type change struct {
+	put         []ClipboardEntry
+	deleted     []int
+	cleared     bool
+	collections []Collection
+	release     []ClipboardEntry
+}
+
+// apply replays ch on s in the same order the engines persist it: a clear
+// first, then deletions, then inserts and updates. Callers sort the
+// entries once they are done applying changes.
+func (s *snapshot) apply(ch change, nextID int) {
+	if ch.cleared {
+		s.Entries = nil
+	}
+	if len(ch.deleted) > 0 {
+		gone := map[int]bool{}
+		for _, id := range ch.deleted {
+			gone[id] = true
+		}
+		kept := s.Entries[:0:0]
+		for _, e := range s.Entries {
+			if !gone[e.ID] {
+				kept = append(kept, e)
+			}
+		}
+		s.Entries = kept
+	}
+	for _, e := range ch.put {
+		found := false
+		for i := range s.Entries {
+			if s.Entries[i].ID == e.ID {
+				s.Entries[i] = e
+				found = true
+				break
+			}
+		}
+		if !found {
+			s.Entries = append(s.Entries, e)
+		}
+	}
+	if ch.collections != nil {
+		s.Collections = ch.collections
+	}
+	if nextID > s.NextID {
+		s.NextID = nextID
+	}
+}
+
+// sortTrash puts the most recently deleted entries first.
+func sortTrash(entries []ClipboardEntry) {
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].DeletedAt.After(entries[j].DeletedAt)
+	})
+}
+
+// sortEntries puts entries in history order, most recently used first.
+func sortEntries(entries []ClipboardEntry) {
+	sort.SliceStable(entries, func(i, j int) bool {
+		a, b := lastUsed(entries[i]), lastUsed(entries[j])
+		if !a.Equal(b) {
+			return a.After(b)
+		}
+		return entries[i].ID > entries[j].ID
+	})
+}
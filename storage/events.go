@@ -0,0 +1,155 @@
+package storage
+
+import "sync"
+
+type EventType int
+
+const (
+	EventAdded EventType = iota
+	EventDeleted
+	EventUpdated
+	EventRestored
+	// EventReset means the whole history was replaced, as by restoring a
+	// backup; Entry is empty.
+	EventReset
+	// EventCollections means collections were changed; Entry is empty.
+	EventCollections
+)
+
+func (t EventType) String() string {
+	switch t {
+	case EventAdded:
+		return "added"
+	case EventDeleted:
+		return "deleted"
+	case EventUpdated:
+		return "updated"
+	case EventRestored:
+		return "restored"
+	case EventReset:
+		return "reset"
+	case EventCollections:
+		return "collections"
+	default:
+		return "unknown"
+	}
+}
+
+// Event describes a single change to the history. For EventDeleted, Entry
+// holds the entry as it was just before it was removed; DeletedAt is set
+// when it went to the trash. EventRestored brings an entry back from the
+// trash.
+type Event struct {
+	Type  EventType
+	Entry ClipboardEntry
+}
+
+// subscription buffers events without limit so that publishing never
+// blocks the Database and a slow reader never misses a change.
+type subscription struct {
+	mu     sync.Mutex
+	queue  []Event
+	wake   chan struct{}
+	done   chan struct{}
+	out    chan Event
+	closed bool
+}
+
+func newSubscription() *subscription {
+	s := &subscription{
+		wake: make(chan struct{}, 1),
+		done: make(chan struct{}),
+		out:  make(chan Event),
+	}
+	go s.run()
+	return s
+}
+
+func (s *subscription) publish(ev Event) {
+	s.mu.Lock()
+	if !s.closed {
+		s.queue = append(s.queue, ev)
+	}
+	s.mu.Unlock()
+
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (s *subscription) close() {
+	s.mu.Lock()
+	if !s.closed {
+		s.closed = true
+		close(s.done)
+	}
+	s.mu.Unlock()
+}
+
+func (s *subscription) run() {
+	defer close(s.out)
+	for {
+		s.mu.Lock()
+		pending := s.queue
+		s.queue = nil
+		s.mu.Unlock()
+
+		for _, ev := range pending {
+			select {
+			case s.out <- ev:
+			case <-s.done:
+				return
+			}
+		}
+
+		select {
+		case <-s.wake:
+		case <-s.done:
+			return
+		}
+	}
+}
+
+type broker struct {
+	mu   sync.Mutex
+	subs map[*subscription]struct{}
+}
+
+func (b *broker) subscribe() (<-chan Event, func()) {
+	s := newSubscription()
+
+	b.mu.Lock()
+	if b.subs == nil {
+		b.subs = map[*subscription]struct{}{}
+	}
+	b.subs[s] = struct{}{}
+	b.mu.Unlock()
+
+	cancel := func() {
+		b.mu.Lock()
+		delete(b.subs, s)
+		b.mu.Unlock()
+		s.close()
+	}
+	return s.out, cancel
+}
+
+func (b *broker) publish(events ...Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for s := range b.subs {
+		for _, ev := range events {
+			s.publish(ev)
+		}
+	}
+}
+
+func (b *broker) closeAll() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for s := range b.subs {
+		s.close()
+	}
+	b.subs = nil
+}
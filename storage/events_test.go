@@ -0,0 +1,142 @@
+package storage
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+// drain reads events until the channel is closed, failing the test if that
+// takes too long.
+func drain(t *testing.T, events <-chan Event) []Event {
+	t.Helper()
+	var got []Event
+	timeout := time.After(10 * time.Second)
+	for {
+		select {
+		case ev, ok := <-events:
+			if !ok {
+				return got
+			}
+			got = append(got, ev)
+		case <-timeout:
+			t.Fatalf("channel not closed after %d events", len(got))
+		}
+	}
+}
+
+// take reads n events in the background.
+func take(t *testing.T, events <-chan Event, n int) <-chan []Event {
+	out := make(chan []Event, 1)
+	go func() {
+		var got []Event
+		timeout := time.After(10 * time.Second)
+		for len(got) < n {
+			select {
+			case ev, ok := <-events:
+				if !ok {
+					t.Errorf("channel closed after %d events", len(got))
+					out <- got
+					return
+				}
+				got = append(got, ev)
+			case <-timeout:
+				t.Errorf("got %d events, want %d", len(got), n)
+				out <- got
+				return
+			}
+		}
+		out <- got
+	}()
+	return out
+}
+
+func TestSubscribe(t *testing.T) {
+	const writers, adds = 8, 50
+	db := NewMemoryStore()
+	first, _ := db.Subscribe()
+	second, _ := db.Subscribe()
+	cancelled, cancel := db.Subscribe()
+	firstGot, secondGot := take(t, first, writers*adds), take(t, second, writers*adds)
+
+	var wg sync.WaitGroup
+	for w := 0; w < writers; w++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < adds; i++ {
+				if err := db.AddEntry(fmt.Sprintf("writer %d entry %d", w, i)); err != nil {
+					t.Error(err)
+				}
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for i := 0; i < adds; i++ {
+				db.GetRecent(10)
+				db.Search("entry")
+			}
+		}()
+	}
+	// The cancelled subscriber may see some of the events, but its channel
+	// is closed however many are still queued.
+	<-cancelled
+	cancel()
+	drain(t, cancelled)
+	wg.Wait()
+	a, b := <-firstGot, <-secondGot
+	db.Close()
+	if len(drain(t, first))+len(drain(t, second)) > 0 {
+		t.Error("events after the last change")
+	}
+	if len(a) != writers*adds || len(b) != writers*adds {
+		t.Fatalf("subscribers got %d and %d events, want %d", len(a), len(b), writers*adds)
+	}
+	next := map[int]int{}
+	for i, ev := range a {
+		if ev.Type != EventAdded {
+			t.Fatalf("event %d is %v, want added", i, ev.Type)
+		}
+		if b[i].Entry.ID != ev.Entry.ID {
+			t.Fatalf("event %d is #%d for one subscriber and #%d for the other", i, ev.Entry.ID, b[i].Entry.ID)
+		}
+		// Events come in the order the changes were made.
+		if i > 0 && ev.Entry.ID <= a[i-1].Entry.ID {
+			t.Fatalf("event %d for #%d after #%d", i, ev.Entry.ID, a[i-1].Entry.ID)
+		}
+		var w, n int
+		fmt.Sscanf(ev.Entry.Text, "writer %d entry %d", &w, &n)
+		if n != next[w] {
+			t.Fatalf("writer %d: entry %d published before entry %d", w, n, next[w])
+		}
+		next[w]++
+	}
+}
+
+func TestSubscribeAfterChange(t *testing.T) {
+	db := NewMemoryStore()
+	defer db.Close()
+	db.AddEntry("before")
+	events, cancel := db.Subscribe()
+	db.AddEntry("after")
+	db.AddEntry("before")
+	got := <-take(t, events, 2)
+	cancel()
+	if rest := drain(t, events); len(rest) > 0 {
+		t.Errorf("%d events after cancel", len(rest))
+	}
+
+	want := []struct {
+		typ  EventType
+		text string
+	}{
+		{EventAdded, "after"},
+		{EventUpdated, "before"},
+	}
+	for i, ev := range got {
+		if ev.Type != want[i].typ || ev.Entry.Text != want[i].text {
+			t.Errorf("event %d = %v %q, want %v %q", i, ev.Type, ev.Entry.Text, want[i].typ, want[i].text)
+		}
+	}
+}
@@ -0,0 +1,188 @@
+package storage
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Filter selects entries by their content and capture metadata. It is
+// parsed from a query such as "kubectl host:laptop lines>10"; words that
+// are not a known field are looked for in the text, title, note and tags.
+// The zero Filter matches every entry.
+type Filter struct {
+	text  string
+	terms []filterTerm
+}
+
+type filterTerm struct {
+	field string
+	op    byte
+	value string
+	n     int64
+}
+
+// Fields matched by name, and fields compared as numbers with :, < or >.
+var (
+	textFields = map[string]string{
+		"host": "host", "selection": "selection", "sel": "selection", "mime": "mime",
+		"format": "format", "category": "category", "cat": "category", "tag": "tag", "is": "is",
+	}
+	numberFields = map[string]bool{"size": true, "lines": true, "width": true, "height": true}
+)
+
+// ParseFilter reads a query made of words and field terms:
+//
+//	host:NAME  selection:clipboard|primary  mime:TYPE  format:png
+//	category:NAME  tag:NAME  is:image|text|pinned
+//	size>10KB  lines<5  width>1000  height:600
+//
+// Field names and values are not case sensitive; mime matches any part of
+// a MIME type, so mime:html finds text/html.
+func ParseFilter(query string) (Filter, error) {
+	var f Filter
+	var words []string
+	for _, word := range strings.Fields(query) {
+		i := strings.IndexAny(word, ":<>")
+		if i <= 0 {
+			words = append(words, word)
+			continue
+		}
+		name := strings.ToLower(word[:i])
+		t := filterTerm{op: word[i], value: strings.ToLower(word[i+1:])}
+		switch {
+		case numberFields[name]:
+			t.field = name
+			n, err := parseAmount(t.value)
+			if err != nil {
+				return Filter{}, fmt.Errorf("%s: %w", word, err)
+			}
+			t.n = n
+		case textFields[name] != "" && t.op == ':':
+			t.field = textFields[name]
+		default:
+			words = append(words, word)
+			continue
+		}
+		f.terms = append(f.terms, t)
+	}
+	f.text = strings.Join(words, " ")
+	return f, nil
+}
+
+// Empty reports whether f matches every entry.
+func (f Filter) Empty() bool {
+	return f.text == "" && len(f.terms) == 0
+}
+
+// Match reports whether e passes every part of f.
+func (f Filter) Match(e ClipboardEntry) bool {
+	if f.text != "" {
+		q := toLower(f.text)
+		if !contains(toLower(e.Text), q) && !contains(toLower(e.Title), q) &&
+			!contains(toLower(e.Note), q) && indexOfTag(e.Tags, NormalizeTag(f.text)) < 0 {
+			return false
+		}
+	}
+	for _, t := range f.terms {
+		if !t.match(e) {
+			return false
+		}
+	}
+	return true
+}
+
+func (t filterTerm) match(e ClipboardEntry) bool {
+	switch t.field {
+	case "host":
+		return strings.EqualFold(e.Host, t.value)
+	case "selection":
+		return strings.EqualFold(selection(e), t.value)
+	case "mime":
+		for _, m := range e.MIMETypes {
+			if strings.Contains(strings.ToLower(m), t.value) {
+				return true
+			}
+		}
+		return false
+	case "format":
+		return strings.EqualFold(e.Format, t.value)
+	case "category":
+		return strings.EqualFold(e.Category, t.value)
+	case "tag":
+		return indexOfTag(e.Tags, NormalizeTag(t.value)) >= 0
+	case "is":
+		switch t.value {
+		case "image":
+			return e.IsImage
+		case "text":
+			return !e.IsImage
+		case "pinned":
+			return e.Pinned
+		}
+		return false
+	}
+
+	var n int64
+	switch t.field {
+	case "size":
+		n = entrySize(e)
+	case "lines":
+		n = int64(e.Lines)
+		if n == 0 && !e.IsImage && !e.Offloaded() {
+			n = int64(lineCount(e.Text))
+		}
+	case "width":
+		n = int64(e.Width)
+	case "height":
+		n = int64(e.Height)
+	}
+	switch t.op {
+	case '<':
+		return n < t.n
+	case '>':
+		return n > t.n
+	default:
+		return n == t.n
+	}
+}
+
+// selection is where e was copied from; entries recorded before captures
+// had metadata all came from the clipboard.
+func selection(e ClipboardEntry) string {
+	if e.Selection == "" {
+		return SelectionClipboard
+	}
+	return e.Selection
+}
+
+// entrySize is the size of the text or image of e in bytes, as far as it
+// is known without reading files.
+func entrySize(e ClipboardEntry) int64 {
+	if e.IsImage {
+		return int64(e.Size)
+	}
+	return textSize(e)
+}
+
+// parseAmount reads a count or a size such as 10KB or 2M.
+func parseAmount(value string) (int64, error) {
+	s := strings.TrimSuffix(strings.ToUpper(value), "B")
+	mult := int64(1)
+	switch {
+	case strings.HasSuffix(s, "K"):
+		mult = 1 << 10
+	case strings.HasSuffix(s, "M"):
+		mult = 1 << 20
+	case strings.HasSuffix(s, "G"):
+		mult = 1 << 30
+	}
+	if mult > 1 {
+		s = s[:len(s)-1]
+	}
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid number %q", value)
+	}
+	return n * mult, nil
+}
@@ -1,8 +1,8 @@
 package storage
 
 import (
-	"encoding/json"
 	"os"
+	"sync"
 	"time"
 )
 
@@ -15,23 +15,133 @@ type ClipboardEntry struct {
 	Category  string    `json:"category"`
 	Language  string    `json:"language,omitempty"`
 	Timestamp time.Time `json:"timestamp"`
+	Pinned    bool      `json:"pinned,omitempty"`
+	Hash      string    `json:"hash,omitempty"`
+	CopyCount int       `json:"copy_count,omitempty"`
+	LastUsed  time.Time `json:"last_used"`
+	// Missing is set by GC when the image file of the entry is gone.
+	Missing bool `json:"missing,omitempty"`
+	// DeletedAt is set while the entry sits in the trash.
+	DeletedAt time.Time `json:"deleted_at,omitzero"`
+	// Size is the length of the text, or of the image file, in bytes.
+	// Large texts only keep a preview in Text; the whole text is in the
+	// gzipped file at TextBlob and is read by LoadText.
+	Size     int    `json:"size,omitempty"`
+	TextBlob string `json:"text_blob,omitempty"`
+	// Revisions are the earlier texts of an edited entry, oldest first;
+	// EditedAt is when it was last edited.
+	Revisions []Revision `json:"revisions,omitempty"`
+	EditedAt  time.Time  `json:"edited_at,omitzero"`
+	// Title replaces the preview of the text in lists; Note is free text
+	// about the entry. Both are set by the user and searched.
+	Title string `json:"title,omitempty"`
+	Note  string `json:"note,omitempty"`
+	// Capture metadata, recorded when the entry is first copied: the line
+	// count of texts, the selection and MIME types it was offered in, the
+	// dimensions and format of images, and the machine it was copied on.
+	Lines     int      `json:"lines,omitempty"`
+	Selection string   `json:"selection,omitempty"`
+	MIMETypes []string `json:"mime_types,omitempty"`
+	Width     int      `json:"width,omitempty"`
+	Height    int      `json:"height,omitempty"`
+	Format    string   `json:"format,omitempty"`
+	Host      string   `json:"host,omitempty"`
 }
 
+// Offloaded reports whether Text is only a preview of the entry's text.
+func (e ClipboardEntry) Offloaded() bool {
+	return e.TextBlob != ""
+}
+
+// Database is safe for concurrent use. Changes are published to every
+// channel returned by Subscribe.
 type Database struct {
-	filename string
-	entries  []ClipboardEntry
-	nextID   int
+	mu        sync.RWMutex
+	engine    engine
+	entries   []ClipboardEntry
+	trash     []ClipboardEntry
+	byHash    map[string]int
+	nextID    int
+	events    broker
+	retention RetentionPolicy
+	blobs     *BlobStore
+	texts     *BlobStore
+	largeText int
+	key       *Key
+	ignore    *ignoreMatcher
+	host      string
+	// collections are shared with the engines once committed; changes
+	// replace the slice instead of modifying it.
+	collections []Collection
+	// changes counts commits; backedUp is its value at the last
+	// scheduled backup.
+	changes  uint64
+	backedUp uint64
+}
+
+type options struct {
+	key *Key
+}
+
+// Option configures a Database when it is opened.
+type Option func(*options)
+
+// WithKey encrypts everything the Database writes with k, including image
+// files, and decrypts what it reads.
+func WithKey(k *Key) Option {
+	return func(o *options) { o.key = k }
+}
+
+func collectOptions(opts []Option) options {
+	var o options
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// NewDatabase opens a history kept in a single JSON file. It fails with
+// ErrLocked while another process has the same file open.
+func NewDatabase(filename string, opts ...Option) (*Database, error) {
+	o := collectOptions(opts)
+	lock, err := lockStore(filename)
+	if err != nil {
+		return nil, err
+	}
+	return open(&jsonEngine{filename: filename, key: o.key, lock: lock}, o)
+}
+
+// NewSQLiteDatabase opens a history kept in a SQLite database. If the
+// database is new and legacyJSON points at an existing JSON history, that
+// history is imported once. Like NewDatabase it fails with ErrLocked while
+// another process has the database open.
+func NewSQLiteDatabase(filename, legacyJSON string, opts ...Option) (*Database, error) {
+	o := collectOptions(opts)
+	e, err := openSQLite(filename, legacyJSON, o.key)
+	if err != nil {
+		return nil, err
+	}
+	return open(e, o)
 }
 
-func NewDatabase(filename string) (*Database, error) {
+func open(e engine, o options) (*Database, error) {
 	db := &Database{
-		filename: filename,
-		entries:  []ClipboardEntry{},
-		nextID:   1,
+		engine:    e,
+		entries:   []ClipboardEntry{},
+		nextID:    1,
+		retention: DefaultRetention(),
+		key:       o.key,
+		host:      hostname(),
 	}
 
-	if err := db.load(); err != nil {
-		if !os.IsNotExist(err) {
+	saved, err := e.load()
+	if err != nil {
+		e.close()
+		return nil, err
+	}
+	if fixed := db.setState(saved); len(fixed) > 0 {
+		if err := db.commit(change{put: fixed}); err != nil {
+			e.close()
 			return nil, err
 		}
 	}
@@ -39,49 +149,89 @@ func NewDatabase(filename string) (*Database, error) {
 	return db, nil
 }
 
-func (d *Database) load() error {
-	data, err := os.ReadFile(d.filename)
-	if err != nil {
-		return err
+// setState replaces the history with saved, which may be nil for an empty
+// store, and returns the entries reindex had to fix. Callers must hold d.mu
+// or own d.
+func (d *Database) setState(saved *snapshot) []ClipboardEntry {
+	d.entries, d.trash = []ClipboardEntry{}, nil
+	d.nextID, d.collections = 1, nil
+	if saved != nil {
+		for _, entry := range saved.Entries {
+			if entry.DeletedAt.IsZero() {
+				d.entries = append(d.entries, entry)
+			} else {
+				d.trash = append(d.trash, entry)
+			}
+		}
+		if saved.NextID > 0 {
+			d.nextID = saved.NextID
+		}
+		d.collections = saved.Collections
 	}
 
-	var saved struct {
-		Entries []ClipboardEntry `json:"entries"`
-		NextID  int              `json:"next_id"`
-	}
+	sortEntries(d.entries)
+	sortTrash(d.trash)
+	return d.reindex()
+}
 
-	if err := json.Unmarshal(data, &saved); err != nil {
-		return err
+// Migration returns what was migrated when the store was opened, or nil if
+// it was already current.
+func (d *Database) Migration() *MigrationReport {
+	if m, ok := d.engine.(interface{ migration() *MigrationReport }); ok {
+		return m.migration()
 	}
-
-	d.entries = saved.Entries
-	d.nextID = saved.NextID
-
 	return nil
 }
 
-func (d *Database) save() error {
-	data := struct {
-		Entries []ClipboardEntry `json:"entries"`
-		NextID  int              `json:"next_id"`
-	}{
-		Entries: d.entries,
-		NextID:  d.nextID,
-	}
+// Subscribe returns a channel that receives every change made after the
+// call, in order. The channel is closed by cancel or by Close.
+func (d *Database) Subscribe() (<-chan Event, func()) {
+	return d.events.subscribe()
+}
 
-	jsonData, err := json.MarshalIndent(data, "", "  ")
-	if err != nil {
+// commit persists ch and then publishes events. When the engine fails the
+// callers' changes are undone by reading the history back from disk and
+// recounting blob references, and nothing is published. Callers must hold
+// d.mu.
+func (d *Database) commit(ch change, events ...Event) error {
+	d.changes++
+	// Entries deleted for good leave their collections too.
+	if len(ch.deleted) > 0 && d.dropMembers(ch.deleted) {
+		ch.collections = d.collections
+		events = append(events, Event{Type: EventCollections})
+	}
+	if err := d.engine.commit(&snapshot{Entries: d.entries, Trash: d.trash, NextID: d.nextID, Collections: d.collections}, ch); err != nil {
+		if saved, loadErr := d.engine.saved(); loadErr == nil {
+			d.setState(saved)
+			d.countRefs()
+		}
 		return err
 	}
-
-	return os.WriteFile(d.filename, jsonData, 0644)
+	for _, e := range ch.release {
+		d.releaseFiles(e)
+	}
+	d.events.publish(events...)
+	return nil
 }
 
 func (d *Database) AddEntry(text string) error {
-	if len(d.entries) > 0 && d.entries[0].Text == text {
-		return nil
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return d.addTextLocked(text, Source{})
+}
+
+func (d *Database) addTextLocked(text string, src Source) error {
+	if d.ignoresText(text) {
+		return ErrIgnored
+	}
+
+	hash := hashBytes([]byte(text))
+	if found, err := d.bump(hash, src); found {
+		return err
 	}
 
+	now := time.Now()
 	entry := ClipboardEntry{
 		ID:        d.nextID,
 		Text:      text,
@@ -89,53 +239,150 @@ func (d *Database) AddEntry(text string) error {
 		Tags:      []string{},
 		Category:  d.categorize(text),
 		Language:  d.detectLanguage(text),
-		Timestamp: time.Now(),
+		Timestamp: now,
+		Hash:      hash,
+		CopyCount: 1,
+		LastUsed:  now,
+	}
+	d.describeText(&entry, src)
+	if err := d.offload(&entry); err != nil {
+		return err
 	}
 
-	d.nextID++
-	d.entries = append([]ClipboardEntry{entry}, d.entries...)
+	return d.insert(entry)
+}
+
+// AddImageEntry records an image file. With an image directory set the
+// file is copied into the blob store; otherwise the entry refers to it
+// where it is and takes ownership of it.
+func (d *Database) AddImageEntry(imagePath string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.ignoresImages() {
+		return ErrIgnored
+	}
+	if d.blobs != nil && !d.blobs.Contains(imagePath) {
+		data, err := os.ReadFile(imagePath)
+		if err != nil {
+			return err
+		}
+		return d.addImageLocked(data, Source{})
+	}
 
-	if len(d.entries) > 1000 {
-		d.entries = d.entries[:1000]
+	hash := d.entryHash(ClipboardEntry{IsImage: true, ImagePath: imagePath})
+	if id, ok := d.byHash[hash]; ok {
+		// The same image is already stored; keep its file and drop the copy.
+		if existing, err := d.getEntryLocked(id); err == nil && existing.ImagePath != imagePath && d.blobs == nil {
+			os.Remove(imagePath)
+		}
+		if found, err := d.bump(hash, Source{}); found {
+			return err
+		}
 	}
 
-	return d.save()
+	data, _ := readSealed(imagePath, d.key)
+	return d.insertImage(imagePath, hash, data, Source{})
 }
 
-func (d *Database) AddImageEntry(imagePath string) error {
+// insertImage records the image stored at path; data is its contents.
+func (d *Database) insertImage(path, hash string, data []byte, src Source) error {
+	now := time.Now()
 	entry := ClipboardEntry{
 		ID:        d.nextID,
 		Text:      "[Image]",
-		ImagePath: imagePath,
+		ImagePath: path,
 		IsImage:   true,
 		Tags:      []string{},
 		Category:  "image",
-		Timestamp: time.Now(),
+		Timestamp: now,
+		Hash:      hash,
+		CopyCount: 1,
+		LastUsed:  now,
+	}
+	d.describeImage(&entry, data, src)
+	if d.blobs != nil && d.blobs.Contains(path) {
+		d.blobs.Acquire(path)
 	}
 
+	return d.insert(entry)
+}
+
+func (d *Database) insert(entry ClipboardEntry) error {
 	d.nextID++
 	d.entries = append([]ClipboardEntry{entry}, d.entries...)
+	d.byHash[entry.Hash] = entry.ID
 
-	if len(d.entries) > 1000 {
-		d.entries = d.entries[:1000]
-	}
+	ch, events := d.pruneLocked(time.Now(), false, nil)
+	ch.put = []ClipboardEntry{entry}
+	events = append([]Event{{Type: EventAdded, Entry: entry}}, events...)
 
-	return d.save()
+	return d.commit(ch, events...)
 }
 
 func (d *Database) GetRecent(limit int) ([]ClipboardEntry, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
 	if limit > len(d.entries) {
 		limit = len(d.entries)
 	}
-	return d.entries[:limit], nil
+	return append([]ClipboardEntry(nil), d.entries[:limit]...), nil
+}
+
+func (d *Database) GetEntry(id int) (ClipboardEntry, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	return d.getEntryLocked(id)
+}
+
+func (d *Database) getEntryLocked(id int) (ClipboardEntry, error) {
+	for _, entry := range d.entries {
+		if entry.ID == id {
+			return entry, nil
+		}
+	}
+	return ClipboardEntry{}, ErrNotFound
 }
 
+func (d *Database) GetByCategory(category string, limit int) ([]ClipboardEntry, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	var results []ClipboardEntry
+	for _, entry := range d.entries {
+		if len(results) >= limit {
+			break
+		}
+		if entry.Category == category {
+			results = append(results, entry)
+		}
+	}
+	return results, nil
+}
+
+func (d *Database) Count() (int, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	return len(d.entries), nil
+}
+
+// Search returns up to 50 entries matching query, which is read by
+// ParseFilter.
 func (d *Database) Search(query string) ([]ClipboardEntry, error) {
+	f, err := ParseFilter(query)
+	if err != nil {
+		return nil, err
+	}
+
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
 	var results []ClipboardEntry
-	queryLower := toLower(query)
-	
 	for _, entry := range d.entries {
-		if contains(toLower(entry.Text), queryLower) {
+		if f.Match(entry) {
 			results = append(results, entry)
 			if len(results) >= 50 {
 				break
@@ -146,33 +393,49 @@ func (d *Database) Search(query string) ([]ClipboardEntry, error) {
 	return results, nil
 }
 
+// DeleteEntry moves an entry to the trash. It can be restored until the
+// trash is emptied or the retention policy's TrashFor has passed.
 func (d *Database) DeleteEntry(id int) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
 	for i, entry := range d.entries {
 		if entry.ID == id {
-			// Delete image file if exists
-			if entry.IsImage && entry.ImagePath != "" {
-				os.Remove(entry.ImagePath)
-			}
-			d.entries = append(d.entries[:i], d.entries[i+1:]...)
-			return d.save()
+			d.entries = append(d.entries[:i:i], d.entries[i+1:]...)
+			ch, events := d.trashLocked(time.Now(), entry)
+			return d.commit(ch, events...)
 		}
 	}
-	return nil
+	return ErrNotFound
 }
 
-func (d *Database) Clear() error {
-	// Delete all image files
+// Clear moves every entry that is not pinned to the trash. With force,
+// pinned entries go as well.
+func (d *Database) Clear(force bool) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	var removed []ClipboardEntry
+	kept := []ClipboardEntry{}
 	for _, entry := range d.entries {
-		if entry.IsImage && entry.ImagePath != "" {
-			os.Remove(entry.ImagePath)
+		if entry.Pinned && !force {
+			kept = append(kept, entry)
+			continue
 		}
+		removed = append(removed, entry)
 	}
-	d.entries = []ClipboardEntry{}
-	return d.save()
+	d.entries = kept
+	ch, events := d.trashLocked(time.Now(), removed...)
+	return d.commit(ch, events...)
 }
 
+// Close closes every subscription and the underlying engine.
 func (d *Database) Close() error {
-	return d.save()
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.events.closeAll()
+	return d.engine.close()
 }
 
 func (d *Database) categorize(text string) string {
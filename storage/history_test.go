@@ -0,0 +1,40 @@
+package storage
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestCommitFailure(t *testing.T) {
+	dir := t.TempDir()
+	db, err := NewDatabase(filepath.Join(dir, "history.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if err := db.SetImageDir(filepath.Join(dir, "images")); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AddEntry("kept"); err != nil {
+		t.Fatal(err)
+	}
+	events, cancel := db.Subscribe()
+	defer cancel()
+
+	db.engine = failingEngine{db.engine}
+	png := []byte("\x89PNG\r\n\x1a\nnever saved")
+	if err := db.AddImage(png); err == nil {
+		t.Fatal("AddImage succeeded without a commit")
+	}
+	if got := texts(t, db); !equalStrings(got, []string{"kept"}) {
+		t.Errorf("history is %q after a failed commit, want it as it was on disk", got)
+	}
+	if refs := db.blobs.Refs(db.blobs.Path(hashBytes(png), ".png")); refs != 0 {
+		t.Errorf("image of the entry that was not saved has %d references", refs)
+	}
+	select {
+	case ev := <-events:
+		t.Errorf("published %v for a change that was not saved", ev.Type)
+	default:
+	}
+}
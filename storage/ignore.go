@@ -0,0 +1,73 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+)
+
+// ErrIgnored is returned by AddEntry and AddImage when the ignore rules
+// say the content must not be recorded.
+var ErrIgnored = errors.New("content matches an ignore rule")
+
+// IgnoreRules keep content out of the history. Patterns are regular
+// expressions matched against copied text.
+type IgnoreRules struct {
+	Patterns   []string `json:"patterns,omitempty"`
+	Categories []string `json:"categories,omitempty"`
+	// MinLength skips text shorter than this many bytes.
+	MinLength int  `json:"min_length,omitempty"`
+	Images    bool `json:"images,omitempty"`
+}
+
+type ignoreMatcher struct {
+	patterns   []*regexp.Regexp
+	categories map[string]bool
+	minLength  int
+	images     bool
+}
+
+// SetIgnoreRules replaces the rules that decide what is not recorded.
+// Entries already in the history are not affected.
+func (d *Database) SetIgnoreRules(r IgnoreRules) error {
+	m := &ignoreMatcher{categories: map[string]bool{}, minLength: r.MinLength, images: r.Images}
+	for _, p := range r.Patterns {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return fmt.Errorf("ignore pattern %q: %w", p, err)
+		}
+		m.patterns = append(m.patterns, re)
+	}
+	for _, c := range r.Categories {
+		m.categories[c] = true
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.ignore = m
+	return nil
+}
+
+// ignoresText reports whether text must not be recorded. Callers must hold
+// d.mu.
+func (d *Database) ignoresText(text string) bool {
+	m := d.ignore
+	if m == nil {
+		return false
+	}
+	if len(text) < m.minLength || m.categories[d.categorize(text)] {
+		return true
+	}
+	for _, re := range m.patterns {
+		if re.MatchString(text) {
+			return true
+		}
+	}
+	return false
+}
+
+// ignoresImages reports whether images must not be recorded. Callers must
+// hold d.mu.
+func (d *Database) ignoresImages() bool {
+	return d.ignore != nil && (d.ignore.images || d.ignore.categories["image"])
+}
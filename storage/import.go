@@ -0,0 +1,95 @@
+package storage
+
+import (
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// ImportEntry adds an entry taken from another store, keeping its
+// timestamps, pin, tags, title, note and copy count. It gets a new ID; if
+// the same content is already in the history the two are merged. Text must
+// hold the whole text, as loaded by LoadText, and image the image file's
+// contents for image entries. Revisions are not carried over. Ignore rules
+// do not apply, as the entry is being moved on purpose.
+func (d *Database) ImportEntry(e ClipboardEntry, image []byte) (ClipboardEntry, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	e.DeletedAt = time.Time{}
+	e.Missing = false
+	e.TextBlob = ""
+	e.Revisions = nil
+	if e.IsImage {
+		if d.blobs == nil {
+			return ClipboardEntry{}, ErrNoImageDir
+		}
+		e.Hash = hashBytes(image)
+	} else {
+		e.Hash = hashBytes([]byte(e.Text))
+		e.Size = len(e.Text)
+	}
+	if e.CopyCount == 0 {
+		e.CopyCount = 1
+	}
+	if e.LastUsed.IsZero() {
+		e.LastUsed = e.Timestamp
+	}
+
+	if id, ok := d.byHash[e.Hash]; ok {
+		for i, live := range d.entries {
+			if live.ID != id {
+				continue
+			}
+			live.CopyCount += e.CopyCount
+			live.Pinned = live.Pinned || e.Pinned
+			for _, tag := range e.Tags {
+				if indexOfTag(live.Tags, tag) < 0 {
+					live.Tags = append(live.Tags, tag)
+				}
+			}
+			if live.Title == "" {
+				live.Title = e.Title
+			}
+			if live.Note == "" {
+				live.Note = e.Note
+			}
+			if e.LastUsed.After(live.LastUsed) {
+				live.LastUsed = e.LastUsed
+			}
+			d.entries[i] = live
+			sortEntries(d.entries)
+			return live, d.commit(change{put: []ClipboardEntry{live}}, Event{Type: EventUpdated, Entry: live})
+		}
+	}
+
+	if e.IsImage {
+		ext := filepath.Ext(strings.TrimSuffix(e.ImagePath, encExt))
+		if ext == "" {
+			ext = ".png"
+		}
+		path, _, err := d.blobs.Put(image, ext)
+		if err != nil {
+			return ClipboardEntry{}, err
+		}
+		d.blobs.Acquire(path)
+		e.ImagePath = path
+	}
+	if e.Tags == nil {
+		e.Tags = []string{}
+	}
+	if err := d.offload(&e); err != nil {
+		return ClipboardEntry{}, err
+	}
+
+	e.ID = d.nextID
+	d.nextID++
+	d.entries = append(d.entries, e)
+	sortEntries(d.entries)
+	d.byHash[e.Hash] = e.ID
+
+	ch, events := d.pruneLocked(time.Now(), false, nil)
+	ch.put = append(ch.put, e)
+	events = append([]Event{{Type: EventAdded, Entry: e}}, events...)
+	return e, d.commit(ch, events...)
+}
@@ -0,0 +1,484 @@
+package storage
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+)
+
+const (
+	journalCompactBytes   = 1 << 20
+	journalCompactRecords = 500
+)
+
+// jsonEngine keeps the history in a JSON snapshot file plus an append-only
+// journal next to it. Each commit appends one line to the journal, so the
+// cost of a write depends on the size of the change. Once the journal grows
+// large enough it is folded into a new snapshot in the background.
+//
+// Files used, for a snapshot called history.json:
+//
+//	history.json                   last compacted state
+//	history.json.journal           changes made since then
+//	history.json.journal.compact   journal being folded into the snapshot
+//
+// With a key the snapshot is encrypted as a whole and every journal line
+// on its own.
+type jsonEngine struct {
+	filename string
+	key      *Key
+	lock     *os.File
+
+	journal *os.File
+	size    int64
+	records int
+
+	migrated *MigrationReport
+
+	mu         sync.Mutex
+	compacting bool
+	err        error
+	wg         sync.WaitGroup
+}
+
+// journalRecord is one line of the journal and holds a single change.
+type journalRecord struct {
+	Put         []ClipboardEntry `json:"put,omitempty"`
+	Deleted     []int            `json:"deleted,omitempty"`
+	Cleared     bool             `json:"cleared,omitempty"`
+	NextID      int              `json:"next_id"`
+	Collections *[]Collection    `json:"collections,omitempty"`
+}
+
+func (j *jsonEngine) journalPath() string { return j.filename + ".journal" }
+func (j *jsonEngine) compactPath() string { return j.filename + ".journal.compact" }
+
+func (j *jsonEngine) load() (*snapshot, error) {
+	h, err := readHistory(j.filename, true, j.key)
+	if err != nil {
+		return nil, err
+	}
+
+	// A leftover compaction journal means we stopped before the new
+	// snapshot was written, and a missing snapshot means the store is new
+	// or predates format versions. In every case, after migrating, and to
+	// encrypt a history written in plain text, the whole state is written
+	// out again as a current snapshot.
+	rewrite := !h.found || h.interrupted > 0 || (j.key != nil && h.plain)
+	if h.found && h.report.Needed() {
+		backup, err := backupFiles(h.report.From, j.filename, j.journalPath(), j.compactPath())
+		if err != nil {
+			return nil, fmt.Errorf("back up %s before migrating: %w", j.filename, err)
+		}
+		h.report.Backup = backup
+		j.migrated = h.report
+		rewrite = true
+	}
+	if rewrite {
+		if err := writeSnapshot(j.filename, h.snap, j.key); err != nil {
+			return nil, err
+		}
+		os.Remove(j.journalPath())
+		os.Remove(j.compactPath())
+		h.pending = 0
+	}
+
+	if err := j.openJournal(); err != nil {
+		return nil, err
+	}
+	j.records = h.pending
+
+	if !h.found {
+		return nil, nil
+	}
+	return h.snap, nil
+}
+
+func (j *jsonEngine) saved() (*snapshot, error) {
+	h, err := readHistory(j.filename, false, j.key)
+	if err != nil || !h.found {
+		return nil, err
+	}
+	return h.snap, nil
+}
+
+func (j *jsonEngine) migration() *MigrationReport {
+	return j.migrated
+}
+
+func (j *jsonEngine) openJournal() error {
+	f, err := os.OpenFile(j.journalPath(), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	j.journal = f
+	j.size = info.Size()
+	return nil
+}
+
+// commit appends ch to the journal. Compaction errors are not its
+// concern: the record is on disk either way, and close reports them.
+func (j *jsonEngine) commit(s *snapshot, ch change) error {
+	rec := journalRecord{
+		Put:     ch.put,
+		Deleted: ch.deleted,
+		Cleared: ch.cleared,
+		NextID:  s.NextID,
+	}
+	if ch.collections != nil {
+		rec.Collections = &ch.collections
+	}
+	line, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	if j.key != nil {
+		sealed, err := j.key.sealString(line)
+		if err != nil {
+			return err
+		}
+		line = []byte(sealed)
+	}
+	line = append(line, '\n')
+
+	if _, err := j.journal.Write(line); err != nil {
+		// Cut off whatever part of the line made it, so the next record
+		// does not land behind a torn one.
+		j.journal.Truncate(j.size)
+		return err
+	}
+	if err := j.journal.Sync(); err != nil {
+		return err
+	}
+	j.size += int64(len(line))
+	j.records++
+
+	// A clear is compacted right away so the removed entries do not linger
+	// in the snapshot on disk.
+	if ch.cleared || j.size >= journalCompactBytes || j.records >= journalCompactRecords {
+		j.startCompaction(s)
+	}
+	return nil
+}
+
+// startCompaction moves the current journal aside and writes a snapshot of
+// s in the background. s must reflect every record in that journal.
+func (j *jsonEngine) startCompaction(s *snapshot) {
+	j.mu.Lock()
+	if j.compacting {
+		j.mu.Unlock()
+		return
+	}
+	j.compacting = true
+	j.mu.Unlock()
+
+	entries := make([]ClipboardEntry, 0, len(s.Entries)+len(s.Trash))
+	copied := &snapshot{
+		Entries:     append(append(entries, s.Entries...), s.Trash...),
+		NextID:      s.NextID,
+		Collections: s.Collections,
+	}
+
+	j.journal.Close()
+	err := j.moveJournal()
+	if openErr := j.openJournal(); openErr != nil && err == nil {
+		err = openErr
+	}
+	j.records = 0
+	if err != nil {
+		j.finishCompaction(err)
+		return
+	}
+
+	j.wg.Add(1)
+	go func() {
+		defer j.wg.Done()
+		err := writeSnapshot(j.filename, copied, j.key)
+		if err == nil {
+			err = os.Remove(j.compactPath())
+		}
+		j.finishCompaction(err)
+	}()
+}
+
+// finishCompaction records how the last compaction went; a later one that
+// succeeds leaves nothing to report.
+// moveJournal sets the journal aside for compaction. A compaction that
+// failed leaves its journal behind, holding records that are in no
+// snapshot yet; renaming over it would lose them, so the journal is
+// appended to it instead. Should that be interrupted, the records are
+// replayed twice on the next open, which leaves the same history.
+func (j *jsonEngine) moveJournal() error {
+	compact, err := os.OpenFile(j.compactPath(), os.O_WRONLY|os.O_APPEND, 0644)
+	if os.IsNotExist(err) {
+		return os.Rename(j.journalPath(), j.compactPath())
+	}
+	if err != nil {
+		return err
+	}
+	journal, err := os.Open(j.journalPath())
+	if err != nil {
+		compact.Close()
+		return err
+	}
+	defer journal.Close()
+	if _, err := io.Copy(compact, journal); err != nil {
+		compact.Close()
+		return err
+	}
+	if err := compact.Sync(); err != nil {
+		compact.Close()
+		return err
+	}
+	if err := compact.Close(); err != nil {
+		return err
+	}
+	return os.Truncate(j.journalPath(), 0)
+}
+
+func (j *jsonEngine) finishCompaction(err error) {
+	j.mu.Lock()
+	j.compacting = false
+	j.err = nil
+	if err != nil {
+		j.err = fmt.Errorf("compact %s: %w", j.filename, err)
+	}
+	j.mu.Unlock()
+}
+
+func (j *jsonEngine) close() error {
+	j.wg.Wait()
+	defer j.lock.Close()
+	if j.journal != nil {
+		if err := j.journal.Close(); err != nil {
+			return err
+		}
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.err
+}
+
+// history is everything read back from a snapshot and its journals.
+type history struct {
+	snap        *snapshot
+	found       bool
+	pending     int
+	interrupted int
+	report      *MigrationReport
+	// plain is set when anything was stored without encryption.
+	plain bool
+}
+
+type rawSnapshot struct {
+	Version     int               `json:"version"`
+	Entries     []json.RawMessage `json:"entries"`
+	NextID      int               `json:"next_id"`
+	Collections []Collection      `json:"collections"`
+}
+
+type rawRecord struct {
+	Put         []json.RawMessage `json:"put,omitempty"`
+	Deleted     []int             `json:"deleted,omitempty"`
+	Cleared     bool              `json:"cleared,omitempty"`
+	NextID      int               `json:"next_id"`
+	Collections *[]Collection     `json:"collections,omitempty"`
+}
+
+// readHistory loads the snapshot in filename and replays its journals on
+// top of it, running any migrations the stored format needs in memory.
+// Nothing is written unless repair is set, in which case a torn journal
+// tail is cut off. Encrypted files need key.
+func readHistory(filename string, repair bool, key *Key) (*history, error) {
+	h := &history{}
+	raw := rawSnapshot{Version: historyVersion}
+
+	data, err := os.ReadFile(filename)
+	if err == nil {
+		h.plain = !IsSealed(data)
+		if data, err = openFile(filename, data, key); err != nil {
+			return nil, err
+		}
+		// Files written before format versions have no version field.
+		raw.Version = 0
+		if err := json.Unmarshal(data, &raw); err != nil {
+			return nil, err
+		}
+		h.found = true
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	var records []rawRecord
+	collect := func(rec rawRecord, sealed bool) {
+		records = append(records, rec)
+		if !sealed {
+			h.plain = true
+		}
+	}
+	if h.interrupted, err = replayJournal(filename+".journal.compact", false, key, collect); err != nil {
+		return nil, err
+	}
+	if h.pending, err = replayJournal(filename+".journal", repair, key, collect); err != nil {
+		return nil, err
+	}
+	if !h.found && len(records) > 0 {
+		// Journals are only ever written without a snapshot by builds that
+		// predate format versions.
+		h.found = true
+		raw.Version = 0
+	}
+
+	if raw.Version > historyVersion {
+		return nil, fmt.Errorf("%s is format v%d, this build reads up to v%d: %w",
+			filename, raw.Version, historyVersion, ErrNewerFormat)
+	}
+
+	h.report = &MigrationReport{File: filename, From: raw.Version, To: historyVersion, fresh: !h.found}
+	for _, m := range historyMigrations {
+		if m.version <= raw.Version {
+			continue
+		}
+		step := MigrationStep{Version: m.version, Description: m.description}
+		n, err := migrateEntries(m, raw.Entries)
+		if err != nil {
+			return nil, err
+		}
+		step.Changed += n
+		for _, rec := range records {
+			n, err := migrateEntries(m, rec.Put)
+			if err != nil {
+				return nil, err
+			}
+			step.Changed += n
+		}
+		h.report.Steps = append(h.report.Steps, step)
+	}
+
+	h.snap = &snapshot{Entries: []ClipboardEntry{}, NextID: raw.NextID, Collections: raw.Collections}
+	if h.snap.Entries, err = decodeEntries(raw.Entries); err != nil {
+		return nil, err
+	}
+	for _, rec := range records {
+		put, err := decodeEntries(rec.Put)
+		if err != nil {
+			return nil, err
+		}
+		ch := change{put: put, deleted: rec.Deleted, cleared: rec.Cleared}
+		if rec.Collections != nil {
+			ch.collections = *rec.Collections
+		}
+		h.snap.apply(ch, rec.NextID)
+	}
+	sortEntries(h.snap.Entries)
+
+	return h, nil
+}
+
+func decodeEntries(raw []json.RawMessage) ([]ClipboardEntry, error) {
+	entries := make([]ClipboardEntry, 0, len(raw))
+	for _, msg := range raw {
+		var e ClipboardEntry
+		if err := json.Unmarshal(msg, &e); err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+func writeSnapshot(filename string, s *snapshot, key *Key) error {
+	stamped := *s
+	stamped.Version = historyVersion
+	jsonData, err := json.MarshalIndent(&stamped, "", "  ")
+	if err != nil {
+		return err
+	}
+	if key != nil {
+		if jsonData, err = key.Seal(jsonData); err != nil {
+			return err
+		}
+	}
+
+	return writeFileAtomic(filename, jsonData, 0644)
+}
+
+// replayJournal hands every complete record in path to fn and returns how
+// many there were. A torn tail, left by a crash in the middle of an append,
+// is cut off when repair is set. Damage anywhere before the tail is
+// reported instead, because dropping it would lose later changes.
+// Encrypted lines are decrypted with key, and fn is told whether the record
+// was encrypted.
+func replayJournal(path string, repair bool, key *Key, fn func(rec rawRecord, sealed bool)) (int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, nil
+		}
+		return 0, err
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(f)
+	var offset int64
+	count := 0
+	for {
+		line, err := r.ReadBytes('\n')
+		if err == io.EOF {
+			if len(bytes.TrimSpace(line)) == 0 {
+				return count, nil
+			}
+			// The last record never got its newline.
+			return count, truncateTornTail(path, offset, repair)
+		}
+		if err != nil {
+			return count, err
+		}
+
+		var rec rawRecord
+		if len(bytes.TrimSpace(line)) == 0 {
+			offset += int64(len(line))
+			continue
+		}
+		record := bytes.TrimSpace(line)
+		sealed := isSealedString(string(record))
+		if sealed {
+			if key == nil {
+				return count, fmt.Errorf("%s: %w", path, ErrEncrypted)
+			}
+			if record, err = key.openString(string(record)); err != nil {
+				if _, peekErr := r.Peek(1); peekErr == io.EOF && !errors.Is(err, ErrWrongKey) {
+					return count, truncateTornTail(path, offset, repair)
+				}
+				return count, fmt.Errorf("%s: record at byte %d: %w", path, offset, err)
+			}
+		}
+		if err := json.Unmarshal(record, &rec); err != nil {
+			if _, peekErr := r.Peek(1); peekErr == io.EOF {
+				return count, truncateTornTail(path, offset, repair)
+			}
+			return count, fmt.Errorf("%s: corrupt record at byte %d: %w", path, offset, err)
+		}
+
+		fn(rec, sealed)
+		offset += int64(len(line))
+		count++
+	}
+}
+
+func truncateTornTail(path string, offset int64, repair bool) error {
+	if !repair {
+		return nil
+	}
+	return os.Truncate(path, offset)
+}
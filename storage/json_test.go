@@ -0,0 +1,307 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// texts returns the text of every live entry, most recent first.
+func texts(t *testing.T, db *Database) []string {
+	t.Helper()
+	entries, err := db.GetRecent(math.MaxInt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out []string
+	for _, e := range entries {
+		out = append(out, e.Text)
+	}
+	return out
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// writeHistory opens a JSON history in a temporary directory, adds texts
+// and closes it again, leaving them in the journal.
+func writeHistory(t *testing.T, texts ...string) string {
+	t.Helper()
+	name := filepath.Join(t.TempDir(), "history.json")
+	db, err := NewDatabase(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, text := range texts {
+		if err := db.AddEntry(text); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return name
+}
+
+func appendFile(t *testing.T, name, data string) {
+	t.Helper()
+	f, err := os.OpenFile(name, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, err := f.WriteString(data); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestJournalTornTail(t *testing.T) {
+	tests := []struct {
+		name string
+		tail string
+	}{
+		{"no newline", `{"put":[{"id":3,"text":"thr`},
+		{"half a record", "{\"put\":[{\"id\":3,\n"},
+		{"blank line", "\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			name := writeHistory(t, "one", "two")
+			journal := name + ".journal"
+			info, err := os.Stat(journal)
+			if err != nil {
+				t.Fatal(err)
+			}
+			appendFile(t, journal, tt.tail)
+
+			db, err := NewDatabase(name)
+			if err != nil {
+				t.Fatalf("open with torn tail: %v", err)
+			}
+			defer db.Close()
+			if got, want := texts(t, db), []string{"two", "one"}; !equalStrings(got, want) {
+				t.Errorf("entries = %q, want %q", got, want)
+			}
+			after, err := os.Stat(journal)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.tail != "\n" && after.Size() != info.Size() {
+				t.Errorf("journal is %d bytes, want the tail cut back to %d", after.Size(), info.Size())
+			}
+
+			// The next record must not land behind the torn one.
+			if err := db.AddEntry("three"); err != nil {
+				t.Fatal(err)
+			}
+			db.Close()
+			db, err = NewDatabase(name)
+			if err != nil {
+				t.Fatalf("reopen: %v", err)
+			}
+			defer db.Close()
+			if got, want := texts(t, db), []string{"three", "two", "one"}; !equalStrings(got, want) {
+				t.Errorf("after reopening entries = %q, want %q", got, want)
+			}
+		})
+	}
+}
+
+func TestJournalDamageBeforeTail(t *testing.T) {
+	name := writeHistory(t, "one")
+	appendFile(t, name+".journal", "not json\n")
+	appendFile(t, name+".journal", `{"put":[{"id":9,"text":"later"}],"next_id":10}`+"\n")
+	before, err := os.Stat(name + ".journal")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db, err := NewDatabase(name)
+	if err == nil {
+		db.Close()
+		t.Fatal("opened a journal damaged before its tail")
+	}
+	// The later record must not have been cut off with the damage.
+	after, err := os.Stat(name + ".journal")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if after.Size() != before.Size() {
+		t.Errorf("journal is %d bytes, want it left at %d", after.Size(), before.Size())
+	}
+}
+
+func TestJournalCompaction(t *testing.T) {
+	tests := []struct {
+		name    string
+		adds    int
+		pending int
+	}{
+		{"below the record limit", journalCompactRecords - 1, journalCompactRecords - 1},
+		{"at the record limit", journalCompactRecords, 0},
+		{"past the record limit", journalCompactRecords + 2, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			name := filepath.Join(t.TempDir(), "history.json")
+			db, err := NewDatabase(name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i := 0; i < tt.adds; i++ {
+				if err := db.AddEntry(fmt.Sprintf("entry %d", i)); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := db.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			h, err := readHistory(name, false, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if h.pending != tt.pending {
+				t.Errorf("%d records in the journal, want %d", h.pending, tt.pending)
+			}
+			if _, err := os.Stat(name + ".journal.compact"); !errors.Is(err, os.ErrNotExist) {
+				t.Errorf("compaction journal left behind: %v", err)
+			}
+
+			db, err = NewDatabase(name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer db.Close()
+			if n, _ := db.Count(); n != tt.adds {
+				t.Errorf("reopened with %d entries, want %d", n, tt.adds)
+			}
+		})
+	}
+}
+
+func TestJournalInterruptedCompaction(t *testing.T) {
+	name := writeHistory(t, "one", "two")
+	// Stop as if the snapshot had not been written yet.
+	if err := os.Rename(name+".journal", name+".journal.compact"); err != nil {
+		t.Fatal(err)
+	}
+	appendFile(t, name+".journal", `{"put":[{"id":3,"text":"three","tags":[],"category":"text","copy_count":1}],"next_id":4}`+"\n")
+
+	db, err := NewDatabase(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if n, _ := db.Count(); n != 3 {
+		t.Errorf("got %d entries, want 3", n)
+	}
+	if _, err := os.Stat(name + ".journal.compact"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("compaction journal not folded in: %v", err)
+	}
+}
+
+// blockSnapshot makes writing the snapshot of name fail, as a full disk
+// would, until the returned function puts it back.
+func blockSnapshot(t *testing.T, name string) func() {
+	t.Helper()
+	data, err := os.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(name); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Join(name, "blocked"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	return func() {
+		if err := os.RemoveAll(name); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(name, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestJournalCompactionError(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "history.json")
+	db, err := NewDatabase(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	unblock := blockSnapshot(t, name)
+	for i := 0; i < journalCompactRecords; i++ {
+		if err := db.AddEntry(fmt.Sprintf("entry %d", i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	db.engine.(*jsonEngine).wg.Wait()
+
+	// The failed compaction is not the next change's to report.
+	events, cancel := db.Subscribe()
+	defer cancel()
+	if err := db.AddEntry("after"); err != nil {
+		t.Fatalf("commit after a failed compaction: %v", err)
+	}
+	if ev := <-events; ev.Type != EventAdded || ev.Entry.Text != "after" {
+		t.Errorf("got event %v %q, want the added entry", ev.Type, ev.Entry.Text)
+	}
+	if err := db.Close(); err == nil {
+		t.Error("Close did not report the failed compaction")
+	}
+
+	unblock()
+	db, err = NewDatabase(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if n, _ := db.Count(); n != journalCompactRecords+1 {
+		t.Errorf("reopened with %d entries, want %d", n, journalCompactRecords+1)
+	}
+}
+
+func TestJournalCompactionAfterFailure(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "history.json")
+	db, err := NewDatabase(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	unblock := blockSnapshot(t, name)
+	// Two compactions fail in a row, as if the process died each time
+	// before the snapshot landed.
+	for i := 0; i < 2*journalCompactRecords; i++ {
+		if err := db.AddEntry(fmt.Sprintf("entry %d", i)); err != nil {
+			t.Fatal(err)
+		}
+		db.engine.(*jsonEngine).wg.Wait()
+	}
+	db.Close()
+
+	unblock()
+	db, err = NewDatabase(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if n, _ := db.Count(); n != 2*journalCompactRecords {
+		t.Errorf("reopened with %d entries, want %d", n, 2*journalCompactRecords)
+	}
+	if _, err := os.Stat(name + ".journal.compact"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("compaction journal not folded in: %v", err)
+	}
+}
@@ -0,0 +1,242 @@
+package storage
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"unicode/utf8"
+)
+
+// DefaultLargeText is the size in bytes above which SetTextDir moves text
+// out of the history by default.
+const DefaultLargeText = 64 << 10
+
+// previewSize is how much of a large text stays in its entry.
+const previewSize = 512
+
+// textExt names compressed text blobs.
+const textExt = ".txt.gz"
+
+var ErrNoTextDir = errors.New("no text directory configured")
+
+// SetTextDir keeps texts longer than threshold bytes gzipped in a BlobStore
+// rooted at dir, leaving only a preview in the entry so the history stays
+// small to load and save. Large texts already in the history are moved
+// there, and so are texts written there before encryption was turned on.
+func (d *Database) SetTextDir(dir string, threshold int) error {
+	texts, err := NewBlobStore(dir)
+	if err != nil {
+		return err
+	}
+	texts.key = d.key
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.texts = texts
+	d.largeText = threshold
+	d.countRefs()
+	return d.offloadAll()
+}
+
+// LoadText returns the whole text of an entry, reading it from the text
+// directory if it was too large to keep in the history.
+func (d *Database) LoadText(e ClipboardEntry) (string, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return d.loadText(e)
+}
+
+func (d *Database) loadText(e ClipboardEntry) (string, error) {
+	if e.TextBlob == "" {
+		return e.Text, nil
+	}
+	var data []byte
+	var err error
+	if d.texts != nil {
+		data, err = d.texts.Read(e.TextBlob)
+	} else {
+		data, err = readSealed(e.TextBlob, d.key)
+	}
+	if err != nil {
+		return "", err
+	}
+	zr, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return "", err
+	}
+	defer zr.Close()
+	text, err := io.ReadAll(zr)
+	return string(text), err
+}
+
+// offload moves the text of e to the text directory if it is large enough,
+// taking a reference to the blob. Callers must hold d.mu.
+func (d *Database) offload(e *ClipboardEntry) error {
+	if d.texts == nil || e.IsImage || e.TextBlob != "" || len(e.Text) <= d.largeText {
+		return nil
+	}
+
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write([]byte(e.Text)); err != nil {
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		return err
+	}
+	path, _, err := d.texts.Put(buf.Bytes(), textExt)
+	if err != nil {
+		return err
+	}
+	d.texts.Acquire(path)
+
+	e.Size = len(e.Text)
+	e.Text = preview(e.Text)
+	e.TextBlob = path
+	return nil
+}
+
+// offloadAll moves every large text, trashed ones included, to the text
+// directory, and encrypts text blobs of entries and revisions written
+// before the store had a key. The plain blobs are only released once the
+// entries pointing at the encrypted ones are committed.
+// Callers must hold d.mu.
+func (d *Database) offloadAll() error {
+	var ch change
+	var events []Event
+	var replaced, added []string
+	undo := func(err error) error {
+		for _, path := range added {
+			d.texts.Release(path)
+		}
+		return err
+	}
+	reseal := func(path string) (string, error) {
+		sealed, err := d.resealText(path)
+		if err == nil && sealed != path {
+			replaced = append(replaced, path)
+			added = append(added, sealed)
+		}
+		return sealed, err
+	}
+
+	for _, list := range [][]ClipboardEntry{d.entries, d.trash} {
+		for i, e := range list {
+			changed, copied := false, false
+			if d.plainBlob(e.TextBlob) {
+				path, err := reseal(e.TextBlob)
+				if err != nil {
+					return undo(err)
+				}
+				e.TextBlob = path
+				changed = true
+			}
+			for j, r := range e.Revisions {
+				if !d.plainBlob(r.TextBlob) {
+					continue
+				}
+				path, err := reseal(r.TextBlob)
+				if err != nil {
+					return undo(err)
+				}
+				// The revisions are shared with the entry still in list.
+				if !copied {
+					e.Revisions = append([]Revision(nil), e.Revisions...)
+					copied = true
+				}
+				e.Revisions[j].TextBlob = path
+				changed = true
+			}
+			if e.TextBlob == "" && !e.IsImage && len(e.Text) > d.largeText {
+				if err := d.offload(&e); err != nil {
+					return undo(err)
+				}
+				added = append(added, e.TextBlob)
+				changed = true
+			}
+			if !changed {
+				continue
+			}
+			list[i] = e
+			ch.put = append(ch.put, e)
+			if e.DeletedAt.IsZero() {
+				events = append(events, Event{Type: EventUpdated, Entry: e})
+			}
+		}
+	}
+	if len(ch.put) == 0 {
+		return nil
+	}
+	if err := d.commit(ch, events...); err != nil {
+		return undo(err)
+	}
+	for _, path := range replaced {
+		d.texts.Release(path)
+	}
+	return nil
+}
+
+// plainBlob reports whether path is a text blob written before the store
+// had a key. Callers must hold d.mu.
+func (d *Database) plainBlob(path string) bool {
+	return path != "" && d.key != nil && !strings.HasSuffix(path, encExt) && d.texts.Contains(path)
+}
+
+// resealText writes an encrypted copy of a plain text blob, takes a
+// reference to it and returns its path. A blob that has gone missing keeps
+// its path. The caller releases the plain blob once nothing refers to it.
+// Callers must hold d.mu.
+func (d *Database) resealText(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return path, nil
+	}
+	if err != nil {
+		return "", err
+	}
+	sealed, _, err := d.texts.Put(data, textExt)
+	if err != nil {
+		return "", err
+	}
+	d.texts.Acquire(sealed)
+	return sealed, nil
+}
+
+// textBlobs are the text files an entry and its revisions refer to.
+func textBlobs(e ClipboardEntry) []string {
+	var paths []string
+	if e.TextBlob != "" {
+		paths = append(paths, e.TextBlob)
+	}
+	for _, r := range e.Revisions {
+		if r.TextBlob != "" {
+			paths = append(paths, r.TextBlob)
+		}
+	}
+	return paths
+}
+
+// textSize is the length of the entry's whole text.
+func textSize(e ClipboardEntry) int64 {
+	if e.Offloaded() {
+		return int64(e.Size)
+	}
+	return int64(len(e.Text))
+}
+
+// preview cuts text down to at most previewSize bytes without splitting a
+// character.
+func preview(text string) string {
+	if len(text) <= previewSize {
+		return text
+	}
+	cut := previewSize
+	for cut > 0 && !utf8.RuneStart(text[cut]) {
+		cut--
+	}
+	return text[:cut]
+}
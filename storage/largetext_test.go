@@ -0,0 +1,96 @@
+package storage
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// failingEngine persists nothing; what it reads back comes from the engine
+// it wraps.
+type failingEngine struct{ engine }
+
+func (failingEngine) commit(*snapshot, change) error { return errors.New("disk full") }
+
+func TestResealTexts(t *testing.T) {
+	first := strings.Repeat("first version ", 20)
+	second := strings.Repeat("second version ", 20)
+
+	tests := []struct {
+		name string
+		fail bool
+	}{
+		{"committed", false},
+		{"commit fails", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			name := filepath.Join(dir, "history.json")
+			texts := filepath.Join(dir, "texts")
+
+			db, err := NewDatabase(name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := db.SetTextDir(texts, 100); err != nil {
+				t.Fatal(err)
+			}
+			if err := db.AddEntry(first); err != nil {
+				t.Fatal(err)
+			}
+			entries, _ := db.GetRecent(1)
+			e, err := db.UpdateEntry(entries[0].ID, second)
+			if err != nil {
+				t.Fatal(err)
+			}
+			plain := textBlobs(e)
+			if len(plain) != 2 {
+				t.Fatalf("blobs %q, want the text and one revision", plain)
+			}
+			db.Close()
+
+			key := unlock(t, dir, KeySource{Passphrase: "texts"})
+			db, err = NewDatabase(name, WithKey(key))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer db.Close()
+			if tt.fail {
+				db.engine = failingEngine{db.engine}
+			}
+			err = db.SetTextDir(texts, 100)
+			if tt.fail != (err != nil) {
+				t.Fatalf("SetTextDir: %v", err)
+			}
+
+			e, err = db.GetEntry(e.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			blobs := textBlobs(e)
+			for _, path := range blobs {
+				if strings.HasSuffix(path, encExt) == tt.fail {
+					t.Errorf("entry refers to %s", filepath.Base(path))
+				}
+				if _, err := os.Stat(path); err != nil {
+					t.Errorf("blob the entry refers to is gone: %v", err)
+				}
+			}
+			for _, path := range plain {
+				if _, err := os.Stat(path); tt.fail != (err == nil) {
+					t.Errorf("plain blob %s: %v", filepath.Base(path), err)
+				}
+			}
+
+			if text, err := db.LoadText(e); err != nil || text != second {
+				t.Errorf("LoadText = %.20q, %v", text, err)
+			}
+			if text, err := db.LoadRevision(e.Revisions[0]); err != nil || text != first {
+				t.Errorf("LoadRevision = %.20q, %v", text, err)
+			}
+		})
+	}
+}
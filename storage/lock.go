@@ -0,0 +1,22 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"os"
+)
+
+// ErrLocked is returned when a store is already open in another process.
+var ErrLocked = errors.New("store is open in another process")
+
+// lockStore takes the lock file next to the store in filename, so that only
+// one process at a time writes to it. The lock is held until the returned
+// file is closed, and goes away with the process if it dies.
+func lockStore(filename string) (*os.File, error) {
+	path := filename + ".lock"
+	f, err := lockFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return f, nil
+}
@@ -0,0 +1,42 @@
+package storage
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+func TestStoreLock(t *testing.T) {
+	tests := []struct {
+		name string
+		open func(filename string) (*Database, error)
+	}{
+		{"json", func(filename string) (*Database, error) { return NewDatabase(filename) }},
+		{"sqlite", func(filename string) (*Database, error) { return NewSQLiteDatabase(filename, "") }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filename := filepath.Join(t.TempDir(), "history")
+			db, err := tt.open(filename)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if other, err := tt.open(filename); !errors.Is(err, ErrLocked) {
+				if err == nil {
+					other.Close()
+				}
+				t.Fatalf("second open: %v, want ErrLocked", err)
+			}
+
+			if err := db.Close(); err != nil {
+				t.Fatal(err)
+			}
+			db, err = tt.open(filename)
+			if err != nil {
+				t.Fatalf("open after close: %v", err)
+			}
+			db.Close()
+		})
+	}
+}
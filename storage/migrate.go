@@ -0,0 +1,200 @@
+package storage
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// ErrNewerFormat is returned when a store was written by a newer version of
+// the program than the one reading it.
+var ErrNewerFormat = errors.New("history was written by a newer version")
+
+// historyMigration upgrades one stored entry of the JSON history to the
+// given format version. entry reports whether it changed anything.
+type historyMigration struct {
+	version     int
+	description string
+	entry       func(e map[string]any) bool
+}
+
+// historyMigrations run in order on load. Append new steps at the end; the
+// last version is the one written by this build.
+var historyMigrations = []historyMigration{
+	{1, "stamp format version, fill in missing tags and category", migrateV1},
+	{2, "start copy counts and last-used times", migrateV2},
+	// Older builds would bring trashed entries back as live ones.
+	{3, "keep deleted entries in a trash", func(map[string]any) bool { return false }},
+	// Older builds would only see the preview of large texts.
+	{4, "move large texts to compressed files", func(map[string]any) bool { return false }},
+	// Older builds would drop the revisions when rewriting an entry.
+	{5, "keep revisions of edited entries", func(map[string]any) bool { return false }},
+	// Older builds would drop titles and notes when rewriting an entry.
+	{6, "add titles and notes to entries", func(map[string]any) bool { return false }},
+	// Older builds would drop collections when rewriting the history.
+	{7, "group entries in collections", func(map[string]any) bool { return false }},
+	// Older builds would drop capture metadata when rewriting an entry.
+	{8, "record capture metadata", func(map[string]any) bool { return false }},
+}
+
+var historyVersion = historyMigrations[len(historyMigrations)-1].version
+
+func migrateV1(e map[string]any) bool {
+	changed := false
+	if tags, _ := e["tags"].([]any); tags == nil {
+		e["tags"] = []any{}
+		changed = true
+	}
+	if category, _ := e["category"].(string); category == "" {
+		text, _ := e["text"].(string)
+		if isImage, _ := e["is_image"].(bool); isImage {
+			e["category"] = "image"
+		} else {
+			e["category"] = new(Database).categorize(text)
+		}
+		changed = true
+	}
+	return changed
+}
+
+func migrateV2(e map[string]any) bool {
+	if _, ok := e["copy_count"]; ok {
+		return false
+	}
+	e["copy_count"] = 1
+	e["last_used"] = e["timestamp"]
+	return true
+}
+
+type MigrationStep struct {
+	Version     int
+	Description string
+	Changed     int
+}
+
+// MigrationReport describes the migrations a store needed when it was
+// opened, or would need, for a dry run.
+type MigrationReport struct {
+	File   string
+	From   int
+	To     int
+	Steps  []MigrationStep
+	Backup string
+	DryRun bool
+
+	fresh bool
+}
+
+// Needed reports whether any migration has to run.
+func (r *MigrationReport) Needed() bool {
+	return r != nil && len(r.Steps) > 0
+}
+
+func (r *MigrationReport) String() string {
+	if !r.Needed() {
+		return fmt.Sprintf("%s: up to date (format v%d)", r.File, r.To)
+	}
+
+	var b strings.Builder
+	verb := "migrated"
+	if r.DryRun {
+		verb = "would migrate"
+	}
+	fmt.Fprintf(&b, "%s: %s format v%d -> v%d\n", r.File, verb, r.From, r.To)
+	for _, step := range r.Steps {
+		fmt.Fprintf(&b, "  v%d: %s", step.Version, step.Description)
+		if step.Changed >= 0 {
+			fmt.Fprintf(&b, " (%d entries changed)", step.Changed)
+		}
+		b.WriteString("\n")
+	}
+	if r.Backup != "" {
+		fmt.Fprintf(&b, "  backup: %s\n", r.Backup)
+	} else if r.DryRun && !r.fresh {
+		b.WriteString("  a backup would be made first\n")
+	}
+	return strings.TrimRight(b.String(), "\n")
+}
+
+// PlanMigration reports what opening the JSON history in filename would
+// migrate, without changing anything on disk. An encrypted history needs
+// the WithKey option.
+func PlanMigration(filename string, opts ...Option) (*MigrationReport, error) {
+	h, err := readHistory(filename, false, collectOptions(opts).key)
+	if err != nil {
+		return nil, err
+	}
+	h.report.DryRun = true
+	return h.report, nil
+}
+
+// migrateEntries runs m over every raw entry and counts the ones it changed.
+func migrateEntries(m historyMigration, entries []json.RawMessage) (int, error) {
+	changed := 0
+	for i, raw := range entries {
+		var e map[string]any
+		if err := json.Unmarshal(raw, &e); err != nil {
+			return changed, err
+		}
+		if !m.entry(e) {
+			continue
+		}
+		data, err := json.Marshal(e)
+		if err != nil {
+			return changed, err
+		}
+		entries[i] = data
+		changed++
+	}
+	return changed, nil
+}
+
+// backupFiles copies every existing file in names next to the original
+// with a suffix naming the old format version and the time. It returns the
+// backup of the first file.
+func backupFiles(version int, names ...string) (string, error) {
+	suffix := fmt.Sprintf(".v%d-%s.bak", version, time.Now().Format("20060102-150405"))
+	first := ""
+	for _, name := range names {
+		if _, err := os.Stat(name); os.IsNotExist(err) {
+			continue
+		}
+		if err := copyFile(name, name+suffix); err != nil {
+			return "", err
+		}
+		if first == "" {
+			first = name + suffix
+		}
+	}
+	return first, nil
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	info, err := in.Stat()
+	if err != nil {
+		return err
+	}
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Sync(); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
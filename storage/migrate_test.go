@@ -0,0 +1,189 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// v0History is a history as written before format versions: no version
+// field, and entries without tags, category or copy counts.
+const v0History = `{
+  "entries": [
+    {"id": 1, "text": "https://example.com", "timestamp": "2024-01-02T03:04:05Z"},
+    {"id": 2, "text": "func main() {}", "timestamp": "2024-01-03T03:04:05Z", "tags": ["go"], "category": "code"}
+  ],
+  "next_id": 3
+}`
+
+func writeFile(t *testing.T, name, data string) {
+	t.Helper()
+	if err := os.WriteFile(name, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMigrationOrder(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "history.json")
+	writeFile(t, name, v0History)
+
+	db, err := NewDatabase(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	m := db.Migration()
+	if !m.Needed() {
+		t.Fatal("v0 history was not migrated")
+	}
+	if m.From != 0 || m.To != historyVersion {
+		t.Errorf("migrated v%d -> v%d, want v0 -> v%d", m.From, m.To, historyVersion)
+	}
+	if len(m.Steps) != len(historyMigrations) {
+		t.Fatalf("ran %d steps, want %d", len(m.Steps), len(historyMigrations))
+	}
+	for i, step := range m.Steps {
+		if step.Version != historyMigrations[i].version {
+			t.Errorf("step %d is v%d, want v%d", i, step.Version, historyMigrations[i].version)
+		}
+	}
+
+	tests := []struct {
+		id       int
+		category string
+		tags     int
+	}{
+		{1, "url", 0},
+		{2, "code", 1},
+	}
+	for _, tt := range tests {
+		e, err := db.GetEntry(tt.id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if e.Category != tt.category {
+			t.Errorf("entry %d: category %q, want %q", tt.id, e.Category, tt.category)
+		}
+		if e.Tags == nil || len(e.Tags) != tt.tags {
+			t.Errorf("entry %d: tags %q, want %d", tt.id, e.Tags, tt.tags)
+		}
+		if e.CopyCount != 1 || !e.LastUsed.Equal(e.Timestamp) {
+			t.Errorf("entry %d: copy count %d, last used %v, want 1 and %v", tt.id, e.CopyCount, e.LastUsed, e.Timestamp)
+		}
+	}
+
+	// A migrated history is current the next time it is opened.
+	db.Close()
+	db, err = NewDatabase(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if m := db.Migration(); m.Needed() {
+		t.Errorf("migrated twice: %s", m)
+	}
+}
+
+func TestMigrationBackup(t *testing.T) {
+	tests := []struct {
+		name    string
+		files   map[string]string
+		backups int
+	}{
+		{"snapshot", map[string]string{"history.json": v0History}, 1},
+		{"snapshot and journal", map[string]string{
+			"history.json":         v0History,
+			"history.json.journal": `{"put":[{"id":3,"text":"three","timestamp":"2024-01-04T03:04:05Z"}],"next_id":4}` + "\n",
+		}, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			for file, data := range tt.files {
+				writeFile(t, filepath.Join(dir, file), data)
+			}
+			name := filepath.Join(dir, "history.json")
+
+			db, err := NewDatabase(name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer db.Close()
+
+			backup := db.Migration().Backup
+			if filepath.Dir(backup) != dir || !strings.HasPrefix(filepath.Base(backup), "history.json.v0-") {
+				t.Fatalf("backup %q, want history.json.v0-* in %s", backup, dir)
+			}
+			suffix := backup[len(name):]
+			found := 0
+			for file, data := range tt.files {
+				saved, err := os.ReadFile(filepath.Join(dir, file) + suffix)
+				if err != nil {
+					t.Errorf("no backup of %s: %v", file, err)
+					continue
+				}
+				if string(saved) != data {
+					t.Errorf("backup of %s differs from the original", file)
+				}
+				found++
+			}
+			if found != tt.backups {
+				t.Errorf("%d backups, want %d", found, tt.backups)
+			}
+		})
+	}
+}
+
+func TestMigrationDryRun(t *testing.T) {
+	tests := []struct {
+		name   string
+		data   string
+		needed bool
+		err    error
+	}{
+		{"v0", v0History, true, nil},
+		{"current", fmt.Sprintf(`{"version": %d, "entries": [], "next_id": 1}`, historyVersion), false, nil},
+		{"newer", fmt.Sprintf(`{"version": %d, "entries": [], "next_id": 1}`, historyVersion+1), false, ErrNewerFormat},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			name := filepath.Join(dir, "history.json")
+			writeFile(t, name, tt.data)
+
+			m, err := PlanMigration(name)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("PlanMigration error %v, want %v", err, tt.err)
+			}
+			if err != nil {
+				return
+			}
+			if !m.DryRun || m.Backup != "" {
+				t.Errorf("dry run = %v, backup = %q", m.DryRun, m.Backup)
+			}
+			if m.Needed() != tt.needed {
+				t.Errorf("Needed() = %v, want %v", m.Needed(), tt.needed)
+			}
+
+			// Nothing on disk may change.
+			data, err := os.ReadFile(name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(data) != tt.data {
+				t.Error("dry run rewrote the history")
+			}
+			files, err := os.ReadDir(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(files) != 1 {
+				t.Errorf("dry run left %d files, want only the history", len(files))
+			}
+		})
+	}
+}
@@ -0,0 +1,63 @@
+package storage
+
+import (
+	"encoding/json"
+	"io"
+	"strings"
+)
+
+// SetTitle gives an entry a title to show instead of the start of its
+// text. Line breaks are folded into spaces; an empty title removes it.
+func (d *Database) SetTitle(id int, title string) error {
+	title = strings.Join(strings.Fields(title), " ")
+	return d.annotate(id, func(e *ClipboardEntry) { e.Title = title })
+}
+
+// SetNote attaches free text to an entry; an empty note removes it.
+func (d *Database) SetNote(id int, note string) error {
+	note = strings.TrimSpace(note)
+	return d.annotate(id, func(e *ClipboardEntry) { e.Note = note })
+}
+
+func (d *Database) annotate(id int, set func(e *ClipboardEntry)) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	i := d.entryIndex(id)
+	if i < 0 {
+		return ErrNotFound
+	}
+	entry := d.entries[i]
+	set(&entry)
+	if entry.Title == d.entries[i].Title && entry.Note == d.entries[i].Note {
+		return nil
+	}
+	d.entries[i] = entry
+	return d.commit(change{put: []ClipboardEntry{entry}}, Event{Type: EventUpdated, Entry: entry})
+}
+
+// Export writes the entries matching f as a JSON array, most recent
+// first, with the whole text of large entries. Image entries refer to
+// their file by the path stored in the history.
+func (d *Database) Export(w io.Writer, f Filter) error {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	out := make([]ClipboardEntry, 0, len(d.entries))
+	for _, e := range d.entries {
+		if !f.Match(e) {
+			continue
+		}
+		text, err := d.loadText(e)
+		if err != nil {
+			return err
+		}
+		e.Text = text
+		e.TextBlob = ""
+		e.Revisions = nil
+		out = append(out, e)
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(out)
+}
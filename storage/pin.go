@@ -0,0 +1,43 @@
+package storage
+
+// Pin marks an entry so that retention never trims it and Clear keeps it
+// unless forced.
+func (d *Database) Pin(id int) error {
+	return d.setPinned(id, true)
+}
+
+func (d *Database) Unpin(id int) error {
+	return d.setPinned(id, false)
+}
+
+func (d *Database) setPinned(id int, pinned bool) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for i, entry := range d.entries {
+		if entry.ID != id {
+			continue
+		}
+		if entry.Pinned == pinned {
+			return nil
+		}
+		entry.Pinned = pinned
+		d.entries[i] = entry
+		return d.commit(change{put: []ClipboardEntry{entry}}, Event{Type: EventUpdated, Entry: entry})
+	}
+	return ErrNotFound
+}
+
+// GetPinned returns every pinned entry, most recent first.
+func (d *Database) GetPinned() ([]ClipboardEntry, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	var results []ClipboardEntry
+	for _, entry := range d.entries {
+		if entry.Pinned {
+			results = append(results, entry)
+		}
+	}
+	return results, nil
+}
@@ -0,0 +1,83 @@
+package storage
+
+import (
+	"math"
+	"testing"
+)
+
+func TestPin(t *testing.T) {
+	tests := []struct {
+		name string
+		// act runs against a history of "one", "two" and "three", with
+		// "two" pinned.
+		act     func(db *Database) error
+		history []string
+		pinned  []string
+		trash   int
+	}{
+		{"pin", func(db *Database) error { return db.Pin(3) },
+			[]string{"three", "two", "one"}, []string{"three", "two"}, 0},
+		{"pin twice", func(db *Database) error { return db.Pin(2) },
+			[]string{"three", "two", "one"}, []string{"two"}, 0},
+		{"unpin", func(db *Database) error { return db.Unpin(2) },
+			[]string{"three", "two", "one"}, nil, 0},
+		{"clear", func(db *Database) error { return db.Clear(false) },
+			[]string{"two"}, []string{"two"}, 2},
+		{"clear with force", func(db *Database) error { return db.Clear(true) },
+			nil, nil, 3},
+		{"retention", func(db *Database) error {
+			db.SetRetention(RetentionPolicy{MaxEntries: 1})
+			_, err := db.Prune()
+			return err
+		}, []string{"three", "two"}, []string{"two"}, 0},
+		{"copied again", func(db *Database) error { return db.AddEntry("two") },
+			[]string{"two", "three", "one"}, []string{"two"}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := NewMemoryStore()
+			defer db.Close()
+			for _, text := range []string{"one", "two", "three"} {
+				db.AddEntry(text)
+			}
+			if err := db.Pin(2); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := tt.act(db); err != nil && err != ErrNoImageDir {
+				t.Fatal(err)
+			}
+			if got := texts(t, db); !equalStrings(got, tt.history) {
+				t.Errorf("history is %q, want %q", got, tt.history)
+			}
+			pinned, _ := db.GetPinned()
+			var got []string
+			for _, e := range pinned {
+				got = append(got, e.Text)
+			}
+			if !equalStrings(got, tt.pinned) {
+				t.Errorf("pinned %q, want %q", got, tt.pinned)
+			}
+			if trash, _ := db.GetTrash(); len(trash) != tt.trash {
+				t.Errorf("%d entries in the trash, want %d", len(trash), tt.trash)
+			}
+		})
+	}
+}
+
+func TestPinNotFound(t *testing.T) {
+	db := NewMemoryStore()
+	defer db.Close()
+	db.AddEntry("deleted")
+	entries, _ := db.GetRecent(math.MaxInt)
+	db.DeleteEntry(entries[0].ID)
+
+	for _, id := range []int{entries[0].ID, 42} {
+		if err := db.Pin(id); err != ErrNotFound {
+			t.Errorf("pinning #%d: got %v, want ErrNotFound", id, err)
+		}
+		if err := db.Unpin(id); err != ErrNotFound {
+			t.Errorf("unpinning #%d: got %v, want ErrNotFound", id, err)
+		}
+	}
+}
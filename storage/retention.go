@@ -0,0 +1,248 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CategoryLimit bounds how many entries of one category are kept and for
+// how long. Zero values mean no limit.
+type CategoryLimit struct {
+	MaxEntries int
+	MaxAge     time.Duration
+}
+
+// RetentionPolicy decides which entries are pruned. Zero values mean no
+// limit. Pinned entries and entries in a collection are never pruned.
+type RetentionPolicy struct {
+	MaxEntries int
+	MaxAge     time.Duration
+	// MaxBytes bounds the text of all entries plus their image files.
+	MaxBytes   int64
+	Categories map[string]CategoryLimit
+	// TrashFor is how long deleted entries can be restored before they
+	// are purged.
+	TrashFor time.Duration
+}
+
+func DefaultRetention() RetentionPolicy {
+	return RetentionPolicy{MaxEntries: 1000, TrashFor: 7 * 24 * time.Hour}
+}
+
+type PrunedEntry struct {
+	Entry  ClipboardEntry
+	Reason string
+}
+
+// PruneReport lists what a prune removed.
+type PruneReport struct {
+	Entries []PrunedEntry
+	// Orphans are image files that no entry referred to any more.
+	Orphans    []string
+	BytesFreed int64
+}
+
+func (r PruneReport) Empty() bool {
+	return len(r.Entries) == 0 && len(r.Orphans) == 0
+}
+
+func (r PruneReport) String() string {
+	if r.Empty() {
+		return "nothing to prune"
+	}
+	return fmt.Sprintf("pruned %d entries and %d orphaned images, freed %s",
+		len(r.Entries), len(r.Orphans), FormatBytes(r.BytesFreed))
+}
+
+func (d *Database) SetRetention(p RetentionPolicy) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.retention = p
+}
+
+func (d *Database) Retention() RetentionPolicy {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return d.retention
+}
+
+// Prune applies the retention policy to the whole history, purges expired
+// trash and removes orphaned image files.
+func (d *Database) Prune() (PruneReport, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	var report PruneReport
+	var err error
+	if ch, events := d.pruneLocked(time.Now(), true, &report); len(ch.deleted) > 0 {
+		err = d.commit(ch, events...)
+	}
+
+	if d.blobs != nil {
+		gc, gcErr := d.gcLocked()
+		report.Orphans = gc.Removed
+		report.BytesFreed += gc.Freed
+		if err == nil {
+			err = gcErr
+		}
+	}
+
+	return report, err
+}
+
+// StartPruner runs Prune every interval until ctx is done, handing each
+// result to onPrune.
+func (d *Database) StartPruner(ctx context.Context, interval time.Duration, onPrune func(PruneReport, error)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			report, err := d.Prune()
+			if onPrune != nil {
+				onPrune(report, err)
+			}
+		}
+	}
+}
+
+// pruneLocked drops the entries the policy no longer allows from memory and
+// returns the change and events the caller has to commit. Pruned entries
+// skip the trash; their files go once the change is committed. Byte limits need a stat of every image, so they are only
+// checked when withBytes is set. Callers must hold d.mu.
+func (d *Database) pruneLocked(now time.Time, withBytes bool, report *PruneReport) (change, []Event) {
+	ch := d.expireTrashLocked(now, report)
+	p := d.retention
+	reasons := map[int]string{}
+
+	kept := 0
+	perCategory := map[string]int{}
+	var total int64
+	for _, e := range d.entries {
+		size := textSize(e)
+		if withBytes && e.IsImage && e.ImagePath != "" {
+			if info, err := os.Stat(e.ImagePath); err == nil {
+				size += info.Size()
+			}
+		}
+		if e.Pinned || d.collected(e.ID) {
+			total += size
+			continue
+		}
+
+		age := now.Sub(lastUsed(e))
+		limit, hasLimit := p.Categories[e.Category]
+		switch {
+		case p.MaxAge > 0 && age > p.MaxAge:
+			reasons[e.ID] = "older than " + p.MaxAge.String()
+		case hasLimit && limit.MaxAge > 0 && age > limit.MaxAge:
+			reasons[e.ID] = e.Category + " older than " + limit.MaxAge.String()
+		case hasLimit && limit.MaxEntries > 0 && perCategory[e.Category] >= limit.MaxEntries:
+			reasons[e.ID] = fmt.Sprintf("more than %d %s entries", limit.MaxEntries, e.Category)
+		case p.MaxEntries > 0 && kept >= p.MaxEntries:
+			reasons[e.ID] = fmt.Sprintf("more than %d entries", p.MaxEntries)
+		case withBytes && p.MaxBytes > 0 && total+size > p.MaxBytes:
+			reasons[e.ID] = "history larger than " + FormatBytes(p.MaxBytes)
+		default:
+			kept++
+			perCategory[e.Category]++
+			total += size
+			continue
+		}
+		if report != nil {
+			report.BytesFreed += size
+		}
+	}
+
+	var events []Event
+	if len(reasons) == 0 {
+		return ch, nil
+	}
+
+	var removed []ClipboardEntry
+	remaining := make([]ClipboardEntry, 0, len(d.entries)-len(reasons))
+	for _, e := range d.entries {
+		if _, ok := reasons[e.ID]; ok {
+			removed = append(removed, e)
+		} else {
+			remaining = append(remaining, e)
+		}
+	}
+	d.entries = remaining
+
+	for _, e := range removed {
+		ch.deleted = append(ch.deleted, e.ID)
+		ch.release = append(ch.release, e)
+		events = append(events, Event{Type: EventDeleted, Entry: e})
+		d.unindex(e)
+		if report != nil {
+			report.Entries = append(report.Entries, PrunedEntry{Entry: e, Reason: reasons[e.ID]})
+		}
+	}
+
+	return ch, events
+}
+
+// ParseCategoryLimits parses a list such as "url=30d,image=7d,code=200"
+// where each value is either an age (Go duration, or days with a d suffix)
+// or a maximum number of entries. Both can be given as "image=7d/50".
+func ParseCategoryLimits(s string) (map[string]CategoryLimit, error) {
+	limits := map[string]CategoryLimit{}
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		name, value, ok := strings.Cut(item, "=")
+		if !ok || name == "" {
+			return nil, fmt.Errorf("category limit %q: want name=value", item)
+		}
+
+		var limit CategoryLimit
+		for _, part := range strings.Split(value, "/") {
+			if n, err := strconv.Atoi(part); err == nil {
+				limit.MaxEntries = n
+				continue
+			}
+			age, err := ParseAge(part)
+			if err != nil {
+				return nil, fmt.Errorf("category limit %q: %w", item, err)
+			}
+			limit.MaxAge = age
+		}
+		limits[name] = limit
+	}
+	return limits, nil
+}
+
+// ParseAge is time.ParseDuration with an extra d suffix for days.
+func ParseAge(s string) (time.Duration, error) {
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil {
+			return 0, fmt.Errorf("invalid age %q", s)
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+	return time.ParseDuration(s)
+}
+
+func FormatBytes(n int64) string {
+	switch {
+	case n >= 1<<30:
+		return fmt.Sprintf("%.1f GB", float64(n)/(1<<30))
+	case n >= 1<<20:
+		return fmt.Sprintf("%.1f MB", float64(n)/(1<<20))
+	case n >= 1<<10:
+		return fmt.Sprintf("%.1f KB", float64(n)/(1<<10))
+	default:
+		return fmt.Sprintf("%d B", n)
+	}
+}
@@ -0,0 +1,154 @@
+package storage
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPrune(t *testing.T) {
+	day := 24 * time.Hour
+	// The history, most recent first, as text and age in days.
+	history := []struct {
+		text string
+		age  int
+	}{
+		{"new note", 0},
+		{"https://example.com/a", 1},
+		{"https://example.com/b", 2},
+		{"older note", 10},
+		{"oldest note", 40},
+	}
+	tests := []struct {
+		name   string
+		policy RetentionPolicy
+		// setup runs before pruning; IDs count up from 1 for the oldest.
+		setup func(db *Database)
+		kept  []string
+	}{
+		{"no limits", RetentionPolicy{}, nil,
+			[]string{"new note", "https://example.com/a", "https://example.com/b", "older note", "oldest note"}},
+		{"entry count", RetentionPolicy{MaxEntries: 2}, nil,
+			[]string{"new note", "https://example.com/a"}},
+		{"age", RetentionPolicy{MaxAge: 7 * day}, nil,
+			[]string{"new note", "https://example.com/a", "https://example.com/b"}},
+		{"size", RetentionPolicy{MaxBytes: int64(len("new note") + len("https://example.com/a"))}, nil,
+			[]string{"new note", "https://example.com/a"}},
+		{"category count", RetentionPolicy{Categories: map[string]CategoryLimit{"url": {MaxEntries: 1}}}, nil,
+			[]string{"new note", "https://example.com/a", "older note", "oldest note"}},
+		{"category age", RetentionPolicy{Categories: map[string]CategoryLimit{"url": {MaxAge: day + day/2}}}, nil,
+			[]string{"new note", "https://example.com/a", "older note", "oldest note"}},
+		{"pinned entries are kept", RetentionPolicy{MaxEntries: 1, MaxAge: 7 * day}, func(db *Database) {
+			db.Pin(1)
+		}, []string{"new note", "oldest note"}},
+		{"collected entries are kept", RetentionPolicy{MaxEntries: 1}, func(db *Database) {
+			c, _ := db.CreateCollection("keep")
+			db.AddToCollection(c.ID, 2)
+		}, []string{"new note", "older note"}},
+		{"kept entries do not count against the limit", RetentionPolicy{MaxEntries: 2}, func(db *Database) {
+			db.Pin(1)
+		}, []string{"new note", "https://example.com/a", "oldest note"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := NewMemoryStore()
+			defer db.Close()
+			db.SetRetention(RetentionPolicy{})
+			now := time.Now()
+			for i := len(history) - 1; i >= 0; i-- {
+				h := history[i]
+				at := now.Add(-time.Duration(h.age) * day)
+				if _, err := db.ImportEntry(ClipboardEntry{Text: h.text, Category: db.categorize(h.text), Timestamp: at}, nil); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if tt.setup != nil {
+				tt.setup(db)
+			}
+
+			db.SetRetention(tt.policy)
+			report, err := db.Prune()
+			if err != nil && err != ErrNoImageDir {
+				t.Fatal(err)
+			}
+			if got := texts(t, db); !equalStrings(got, tt.kept) {
+				t.Errorf("kept %q, want %q", got, tt.kept)
+			}
+			if n := len(history) - len(tt.kept); len(report.Entries) != n {
+				t.Errorf("report lists %d entries, want %d", len(report.Entries), n)
+			}
+			for _, p := range report.Entries {
+				if p.Reason == "" {
+					t.Errorf("no reason given for pruning %q", p.Entry.Text)
+				}
+			}
+		})
+	}
+}
+
+func TestPruneTrash(t *testing.T) {
+	db := NewMemoryStore()
+	defer db.Close()
+	db.AddEntry("deleted")
+	db.AddEntry("kept")
+	entries, _ := db.GetRecent(math.MaxInt)
+	db.DeleteEntry(entries[1].ID)
+
+	db.SetRetention(RetentionPolicy{TrashFor: time.Hour})
+	db.Prune()
+	if trash, _ := db.GetTrash(); len(trash) != 1 {
+		t.Fatalf("%d entries in the trash, want the one deleted just now", len(trash))
+	}
+
+	db.SetRetention(RetentionPolicy{TrashFor: time.Nanosecond})
+	time.Sleep(time.Millisecond)
+	report, _ := db.Prune()
+	if trash, _ := db.GetTrash(); len(trash) != 0 {
+		t.Errorf("%d entries left in the trash", len(trash))
+	}
+	if len(report.Entries) != 1 || !strings.Contains(report.Entries[0].Reason, "trash") {
+		t.Errorf("report %v, want the purged entry", report.Entries)
+	}
+	if got := texts(t, db); !equalStrings(got, []string{"kept"}) {
+		t.Errorf("history is %q", got)
+	}
+}
+
+func TestPruneCommitFails(t *testing.T) {
+	dir := t.TempDir()
+	db, err := NewDatabase(filepath.Join(dir, "history.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if err := db.SetImageDir(filepath.Join(dir, "images")); err != nil {
+		t.Fatal(err)
+	}
+	db.AddImage([]byte("\x89PNG\r\n\x1a\nold"))
+	db.AddImage([]byte("\x89PNG\r\n\x1a\nnew"))
+	entries, _ := db.GetRecent(2)
+	old := entries[1]
+
+	db.SetRetention(RetentionPolicy{MaxEntries: 1})
+	db.engine = failingEngine{db.engine}
+	if _, err := db.Prune(); err == nil {
+		t.Fatal("Prune succeeded without a commit")
+	}
+	if n, _ := db.Count(); n != 2 {
+		t.Errorf("%d entries after a failed prune, want 2", n)
+	}
+	if _, err := os.Stat(old.ImagePath); err != nil {
+		t.Errorf("image of the entry that was kept: %v", err)
+	}
+
+	db.engine = db.engine.(failingEngine).engine
+	if _, err := db.Prune(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(old.ImagePath); !os.IsNotExist(err) {
+		t.Errorf("image of the pruned entry: %v", err)
+	}
+}
@@ -0,0 +1,146 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// maxRevisions is how many earlier texts an entry keeps; the oldest go
+// first.
+const maxRevisions = 50
+
+// ErrNotEditable is returned when editing an image entry.
+var ErrNotEditable = errors.New("image entries cannot be edited")
+
+// ErrDuplicate is returned when an edit would give an entry the same text
+// as another one.
+var ErrDuplicate = errors.New("another entry has the same text")
+
+// Revision is an earlier text of an edited entry. Large texts are stored
+// like those of entries; LoadRevision reads them.
+type Revision struct {
+	Text     string `json:"text"`
+	TextBlob string `json:"text_blob,omitempty"`
+	Size     int    `json:"size,omitempty"`
+	Hash     string `json:"hash"`
+	// Saved is when this text was copied, or written by an edit.
+	Saved time.Time `json:"saved"`
+}
+
+// Offloaded reports whether Text is only a preview of the revision's text.
+func (r Revision) Offloaded() bool {
+	return r.TextBlob != ""
+}
+
+// UpdateEntry replaces the text of an entry, keeping the previous text as a
+// revision. Category and language are worked out again. Copying the old
+// text afterwards records a new entry.
+func (d *Database) UpdateEntry(id int, text string) (ClipboardEntry, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	i := d.entryIndex(id)
+	if i < 0 {
+		return ClipboardEntry{}, ErrNotFound
+	}
+	return d.updateLocked(i, text)
+}
+
+// RevertEntry brings back the text of revision n of an entry, counting
+// from 1 for the oldest. The text it replaces becomes a revision itself,
+// so a revert can be undone like any edit.
+func (d *Database) RevertEntry(id, n int) (ClipboardEntry, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	i := d.entryIndex(id)
+	if i < 0 {
+		return ClipboardEntry{}, ErrNotFound
+	}
+	revs := d.entries[i].Revisions
+	if n < 1 || n > len(revs) {
+		return ClipboardEntry{}, fmt.Errorf("entry #%d has no revision %d", id, n)
+	}
+	text, err := d.loadRevision(revs[n-1])
+	if err != nil {
+		return ClipboardEntry{}, err
+	}
+	return d.updateLocked(i, text)
+}
+
+// LoadRevision returns the whole text of a revision.
+func (d *Database) LoadRevision(r Revision) (string, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return d.loadRevision(r)
+}
+
+func (d *Database) loadRevision(r Revision) (string, error) {
+	return d.loadText(ClipboardEntry{Text: r.Text, TextBlob: r.TextBlob})
+}
+
+// updateLocked gives d.entries[i] a new text and keeps the old one as a
+// revision. Callers must hold d.mu.
+func (d *Database) updateLocked(i int, text string) (ClipboardEntry, error) {
+	e := d.entries[i]
+	if e.IsImage {
+		return e, ErrNotEditable
+	}
+	hash := hashBytes([]byte(text))
+	if hash == e.Hash {
+		return e, nil
+	}
+	if other, ok := d.byHash[hash]; ok && other != e.ID {
+		return e, fmt.Errorf("%w: #%d", ErrDuplicate, other)
+	}
+
+	now := time.Now()
+	saved := e.EditedAt
+	if saved.IsZero() {
+		saved = e.Timestamp
+	}
+	revs := append(append([]Revision(nil), e.Revisions...), Revision{
+		Text:     e.Text,
+		TextBlob: e.TextBlob,
+		Size:     int(textSize(e)),
+		Hash:     e.Hash,
+		Saved:    saved,
+	})
+	// The files of the oldest revisions go once the update is committed.
+	var dropped []Revision
+	if len(revs) > maxRevisions {
+		dropped, revs = revs[:len(revs)-maxRevisions], revs[len(revs)-maxRevisions:]
+	}
+
+	updated := e
+	updated.Revisions = revs
+	updated.Text = text
+	updated.TextBlob = ""
+	updated.Size = len(text)
+	updated.Lines = lineCount(text)
+	updated.Hash = hash
+	updated.Category = d.categorize(text)
+	updated.Language = d.detectLanguage(text)
+	updated.EditedAt = now
+	if err := d.offload(&updated); err != nil {
+		return e, err
+	}
+
+	d.entries[i] = updated
+	if d.byHash[e.Hash] == e.ID {
+		delete(d.byHash, e.Hash)
+	}
+	d.byHash[hash] = e.ID
+	ch := change{put: []ClipboardEntry{updated}, release: []ClipboardEntry{{Revisions: dropped}}}
+	return updated, d.commit(ch, Event{Type: EventUpdated, Entry: updated})
+}
+
+func (d *Database) entryIndex(id int) int {
+	for i, e := range d.entries {
+		if e.ID == id {
+			return i
+		}
+	}
+	return -1
+}
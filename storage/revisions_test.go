@@ -0,0 +1,58 @@
+package storage
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRevisionLimitCommitFails(t *testing.T) {
+	dir := t.TempDir()
+	db, err := NewDatabase(filepath.Join(dir, "history.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if err := db.SetTextDir(filepath.Join(dir, "texts"), 100); err != nil {
+		t.Fatal(err)
+	}
+	text := func(n int) string { return strings.Repeat(fmt.Sprintf("version %d ", n), 20) }
+	db.AddEntry(text(0))
+	entries, _ := db.GetRecent(1)
+	id := entries[0].ID
+	var e ClipboardEntry
+	for n := 1; n <= maxRevisions; n++ {
+		if e, err = db.UpdateEntry(id, text(n)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	oldest := e.Revisions[0].TextBlob
+	if oldest == "" {
+		t.Fatal("oldest revision was not stored in a file")
+	}
+
+	db.engine = failingEngine{db.engine}
+	if _, err := db.UpdateEntry(id, text(maxRevisions+1)); err == nil {
+		t.Fatal("UpdateEntry succeeded without a commit")
+	}
+	if _, err := os.Stat(oldest); err != nil {
+		t.Errorf("oldest revision after a failed update: %v", err)
+	}
+	if got, err := db.LoadRevision(e.Revisions[0]); err != nil || got != text(0) {
+		t.Errorf("LoadRevision = %.20q, %v", got, err)
+	}
+
+	db.engine = db.engine.(failingEngine).engine
+	e, err = db.UpdateEntry(id, text(maxRevisions+1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(e.Revisions) != maxRevisions {
+		t.Errorf("%d revisions, want %d", len(e.Revisions), maxRevisions)
+	}
+	if _, err := os.Stat(oldest); !os.IsNotExist(err) {
+		t.Errorf("revision that was dropped: %v", err)
+	}
+}
@@ -0,0 +1,796 @@
+package storage
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	_ "modernc.org/sqlite"
+)
+
+type sqliteMigration struct {
+	description string
+	sql         string
+}
+
+// sqliteMigrations are applied in order; PRAGMA user_version records how
+// many of them the database has already seen.
+var sqliteMigrations = []sqliteMigration{
+	{"create entries, tags and images tables, importing the old history table", `CREATE TABLE meta (
+		key   TEXT PRIMARY KEY,
+		value TEXT NOT NULL
+	);
+	CREATE TABLE entries (
+		id           INTEGER PRIMARY KEY,
+		text         TEXT NOT NULL,
+		is_image     INTEGER NOT NULL DEFAULT 0,
+		category     TEXT NOT NULL DEFAULT '',
+		language     TEXT NOT NULL DEFAULT '',
+		content_hash TEXT NOT NULL DEFAULT '',
+		timestamp    INTEGER NOT NULL
+	);
+	CREATE INDEX idx_entries_timestamp ON entries(timestamp);
+	CREATE INDEX idx_entries_category ON entries(category);
+	CREATE INDEX idx_entries_content_hash ON entries(content_hash);
+	CREATE TABLE tags (
+		entry_id INTEGER NOT NULL REFERENCES entries(id) ON DELETE CASCADE,
+		position INTEGER NOT NULL,
+		tag      TEXT NOT NULL,
+		PRIMARY KEY (entry_id, tag)
+	);
+	CREATE INDEX idx_tags_tag ON tags(tag);
+	CREATE TABLE images (
+		entry_id INTEGER PRIMARY KEY REFERENCES entries(id) ON DELETE CASCADE,
+		path     TEXT NOT NULL
+	);`},
+	{"add pinned flag to entries", `ALTER TABLE entries ADD COLUMN pinned INTEGER NOT NULL DEFAULT 0;`},
+	// Image hashes used to cover the path; clearing them makes the
+	// Database rehash the image bytes on the next load.
+	{"add copy counts and last-used times", `ALTER TABLE entries ADD COLUMN copy_count INTEGER NOT NULL DEFAULT 1;
+	ALTER TABLE entries ADD COLUMN last_used INTEGER NOT NULL DEFAULT 0;
+	UPDATE entries SET last_used = timestamp;
+	UPDATE entries SET content_hash = '' WHERE is_image = 1;
+	CREATE INDEX idx_entries_last_used ON entries(last_used);`},
+	{"flag images whose file is missing", `ALTER TABLE images ADD COLUMN missing INTEGER NOT NULL DEFAULT 0;`},
+	{"keep deleted entries in a trash", `ALTER TABLE entries ADD COLUMN deleted_at INTEGER NOT NULL DEFAULT 0;`},
+	{"move large texts to compressed files", `ALTER TABLE entries ADD COLUMN size INTEGER NOT NULL DEFAULT 0;
+	ALTER TABLE entries ADD COLUMN text_blob TEXT NOT NULL DEFAULT '';`},
+	{"keep revisions of edited entries", `ALTER TABLE entries ADD COLUMN edited_at INTEGER NOT NULL DEFAULT 0;
+	CREATE TABLE revisions (
+		entry_id     INTEGER NOT NULL REFERENCES entries(id) ON DELETE CASCADE,
+		position     INTEGER NOT NULL,
+		text         TEXT NOT NULL,
+		text_blob    TEXT NOT NULL DEFAULT '',
+		size         INTEGER NOT NULL DEFAULT 0,
+		content_hash TEXT NOT NULL DEFAULT '',
+		saved        INTEGER NOT NULL,
+		PRIMARY KEY (entry_id, position)
+	);`},
+	{"add titles and notes to entries", `ALTER TABLE entries ADD COLUMN title TEXT NOT NULL DEFAULT '';
+	ALTER TABLE entries ADD COLUMN note TEXT NOT NULL DEFAULT '';`},
+	{"group entries in collections", `CREATE TABLE collections (
+		id       INTEGER PRIMARY KEY,
+		name     TEXT NOT NULL,
+		position INTEGER NOT NULL,
+		created  INTEGER NOT NULL
+	);
+	CREATE TABLE collection_entries (
+		collection_id INTEGER NOT NULL REFERENCES collections(id) ON DELETE CASCADE,
+		entry_id      INTEGER NOT NULL,
+		position      INTEGER NOT NULL,
+		PRIMARY KEY (collection_id, position)
+	);`},
+	{"record capture metadata", `ALTER TABLE entries ADD COLUMN lines INTEGER NOT NULL DEFAULT 0;
+	ALTER TABLE entries ADD COLUMN selection TEXT NOT NULL DEFAULT '';
+	ALTER TABLE entries ADD COLUMN mime_types TEXT NOT NULL DEFAULT '';
+	ALTER TABLE entries ADD COLUMN width INTEGER NOT NULL DEFAULT 0;
+	ALTER TABLE entries ADD COLUMN height INTEGER NOT NULL DEFAULT 0;
+	ALTER TABLE entries ADD COLUMN format TEXT NOT NULL DEFAULT '';
+	ALTER TABLE entries ADD COLUMN host TEXT NOT NULL DEFAULT '';`},
+}
+
+// sqliteData moves what a schema change alone cannot, after the migration
+// to the version it is keyed by has run, and reports how many entries it
+// changed.
+var sqliteData = map[int]func(tx *sql.Tx) (int, error){
+	1: importHistoryTable,
+}
+
+// sqliteEngine keeps one row per entry. With a key the text, hash, title,
+// note and tags of every entry, and the names of collections, are encrypted
+// column by column; meta records once that has been done for the whole
+// database.
+type sqliteEngine struct {
+	db         *sql.DB
+	filename   string
+	legacyJSON string
+	key        *Key
+	lock       *os.File
+	migrated   *MigrationReport
+}
+
+func openSQLite(filename, legacyJSON string, key *Key) (*sqliteEngine, error) {
+	lock, err := lockStore(filename)
+	if err != nil {
+		return nil, err
+	}
+	dsn := "file:" + filename +
+		"?_pragma=foreign_keys(1)&_pragma=journal_mode(WAL)&_pragma=busy_timeout(5000)"
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		lock.Close()
+		return nil, err
+	}
+	db.SetMaxOpenConns(1)
+
+	s := &sqliteEngine{db: db, filename: filename, legacyJSON: legacyJSON, key: key, lock: lock}
+	if err := s.migrate(); err != nil {
+		s.close()
+		return nil, fmt.Errorf("migrate %s: %w", filename, err)
+	}
+
+	return s, nil
+}
+
+func (s *sqliteEngine) migrate() error {
+	report, err := planSQLite(s.db, s.filename)
+	if err != nil || !report.Needed() {
+		return err
+	}
+
+	// A database without any tables is brand new and has nothing to lose.
+	var tables int
+	if err := s.db.QueryRow("SELECT count(*) FROM sqlite_master").Scan(&tables); err != nil {
+		return err
+	}
+	if tables > 0 {
+		report.Backup = fmt.Sprintf("%s.v%d-%s.bak", s.filename, report.From, time.Now().Format("20060102-150405"))
+		if _, err := s.db.Exec("VACUUM INTO ?", report.Backup); err != nil {
+			return fmt.Errorf("back up before migrating: %w", err)
+		}
+		s.migrated = report
+	}
+
+	for version := report.From; version < report.To; version++ {
+		tx, err := s.db.Begin()
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec(sqliteMigrations[version].sql); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("schema version %d: %w", version+1, err)
+		}
+		if data := sqliteData[version+1]; data != nil {
+			n, err := data(tx)
+			if err != nil {
+				tx.Rollback()
+				return fmt.Errorf("schema version %d: %w", version+1, err)
+			}
+			report.Steps[version-report.From].Changed = n
+		}
+		if _, err := tx.Exec(fmt.Sprintf("PRAGMA user_version = %d", version+1)); err != nil {
+			tx.Rollback()
+			return err
+		}
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// importHistoryTable moves the rows of the history table the first
+// versions kept into entries. The table is dropped afterwards, so that an
+// encrypted store does not keep a plain copy; the backup taken before
+// migrating still has it.
+func importHistoryTable(tx *sql.Tx) (int, error) {
+	var tables int
+	if err := tx.QueryRow("SELECT count(*) FROM sqlite_master WHERE type = 'table' AND name = 'history'").Scan(&tables); err != nil || tables == 0 {
+		return 0, err
+	}
+
+	// Timestamps were SQLite's CURRENT_TIMESTAMP, in UTC.
+	rows, err := tx.Query(`SELECT id, text, COALESCE(strftime('%s', timestamp), strftime('%s', 'now'))
+		FROM history ORDER BY id`)
+	if err != nil {
+		return 0, err
+	}
+	type row struct {
+		id   int
+		text string
+		ts   int64
+	}
+	var legacy []row
+	for rows.Next() {
+		var r row
+		if err := rows.Scan(&r.id, &r.text, &r.ts); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		legacy = append(legacy, r)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	var d Database
+	next := 1
+	for _, r := range legacy {
+		if _, err := tx.Exec("INSERT INTO entries (id, text, category, language, timestamp) VALUES (?, ?, ?, ?, ?)",
+			r.id, r.text, d.categorize(r.text), d.detectLanguage(r.text), time.Unix(r.ts, 0).UnixNano()); err != nil {
+			return 0, err
+		}
+		if r.id >= next {
+			next = r.id + 1
+		}
+	}
+	if err := setMeta(tx, "next_id", strconv.Itoa(next)); err != nil {
+		return 0, err
+	}
+	if _, err := tx.Exec("DROP TABLE history"); err != nil {
+		return 0, err
+	}
+	return len(legacy), nil
+}
+
+func (s *sqliteEngine) migration() *MigrationReport {
+	return s.migrated
+}
+
+// PlanSQLiteMigration reports which schema migrations opening the SQLite
+// database in filename would run, without changing it.
+func PlanSQLiteMigration(filename string) (*MigrationReport, error) {
+	if _, err := os.Stat(filename); os.IsNotExist(err) {
+		report := &MigrationReport{File: filename, To: len(sqliteMigrations), DryRun: true, fresh: true}
+		for i, m := range sqliteMigrations {
+			report.Steps = append(report.Steps, MigrationStep{Version: i + 1, Description: m.description, Changed: -1})
+		}
+		return report, nil
+	}
+
+	db, err := sql.Open("sqlite", "file:"+filename+"?mode=ro")
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	report, err := planSQLite(db, filename)
+	if err != nil {
+		return nil, err
+	}
+	report.DryRun = true
+	return report, nil
+}
+
+func planSQLite(db *sql.DB, filename string) (*MigrationReport, error) {
+	var version int
+	if err := db.QueryRow("PRAGMA user_version").Scan(&version); err != nil {
+		return nil, err
+	}
+	if version > len(sqliteMigrations) {
+		return nil, fmt.Errorf("%s is schema v%d, this build reads up to v%d: %w",
+			filename, version, len(sqliteMigrations), ErrNewerFormat)
+	}
+
+	report := &MigrationReport{File: filename, From: version, To: len(sqliteMigrations)}
+	for i := version; i < len(sqliteMigrations); i++ {
+		report.Steps = append(report.Steps, MigrationStep{
+			Version:     i + 1,
+			Description: sqliteMigrations[i].description,
+			Changed:     -1,
+		})
+	}
+	return report, nil
+}
+
+// saved reads the rows back. The legacy import in load only ever runs
+// once, so by the time a Database commits it writes nothing.
+func (s *sqliteEngine) saved() (*snapshot, error) {
+	return s.load()
+}
+
+func (s *sqliteEngine) load() (*snapshot, error) {
+	encrypted, err := s.getMeta("encrypted")
+	if err != nil {
+		return nil, err
+	}
+	if encrypted != "" && s.key == nil {
+		return nil, fmt.Errorf("%s: %w", s.filename, ErrEncrypted)
+	}
+
+	if err := s.importLegacyJSON(); err != nil {
+		return nil, fmt.Errorf("import %s: %w", s.legacyJSON, err)
+	}
+
+	saved := &snapshot{Entries: []ClipboardEntry{}}
+	byID := map[int]*ClipboardEntry{}
+
+	rows, err := s.db.Query(`SELECT id, text, is_image, category, language, timestamp, pinned,
+		content_hash, copy_count, last_used, deleted_at, size, text_blob, edited_at, title, note,
+		lines, selection, mime_types, width, height, format, host
+		FROM entries ORDER BY last_used DESC, id DESC`)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var e ClipboardEntry
+		var ts, used, deleted, edited int64
+		var mimeTypes string
+		if err := rows.Scan(&e.ID, &e.Text, &e.IsImage, &e.Category, &e.Language, &ts, &e.Pinned,
+			&e.Hash, &e.CopyCount, &used, &deleted, &e.Size, &e.TextBlob, &edited, &e.Title, &e.Note,
+			&e.Lines, &e.Selection, &mimeTypes, &e.Width, &e.Height, &e.Format, &e.Host); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		if mimeTypes != "" {
+			e.MIMETypes = strings.Split(mimeTypes, "\n")
+		}
+		if e.Text, err = s.openColumn(e.Text); err == nil {
+			e.Hash, err = s.openColumn(e.Hash)
+		}
+		if err == nil {
+			e.Title, err = s.openColumn(e.Title)
+		}
+		if err == nil {
+			e.Note, err = s.openColumn(e.Note)
+		}
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		e.Tags = []string{}
+		e.Timestamp = time.Unix(0, ts)
+		e.LastUsed = time.Unix(0, used)
+		if deleted != 0 {
+			e.DeletedAt = time.Unix(0, deleted)
+		}
+		if edited != 0 {
+			e.EditedAt = time.Unix(0, edited)
+		}
+		saved.Entries = append(saved.Entries, e)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	for i := range saved.Entries {
+		byID[saved.Entries[i].ID] = &saved.Entries[i]
+	}
+
+	rows, err = s.db.Query("SELECT entry_id, tag FROM tags ORDER BY entry_id, position")
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var id int
+		var tag string
+		if err := rows.Scan(&id, &tag); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		if tag, err = s.openColumn(tag); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		if e, ok := byID[id]; ok {
+			e.Tags = append(e.Tags, tag)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows, err = s.db.Query(`SELECT entry_id, text, text_blob, size, content_hash, saved
+		FROM revisions ORDER BY entry_id, position`)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var id int
+		var r Revision
+		var saved int64
+		if err := rows.Scan(&id, &r.Text, &r.TextBlob, &r.Size, &r.Hash, &saved); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		if r.Text, err = s.openColumn(r.Text); err == nil {
+			r.Hash, err = s.openColumn(r.Hash)
+		}
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		r.Saved = time.Unix(0, saved)
+		if e, ok := byID[id]; ok {
+			e.Revisions = append(e.Revisions, r)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows, err = s.db.Query("SELECT entry_id, path, missing FROM images")
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var id int
+		var path string
+		var missing bool
+		if err := rows.Scan(&id, &path, &missing); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		if e, ok := byID[id]; ok {
+			e.ImagePath = path
+			e.Missing = missing
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	next, err := s.getMeta("next_id")
+	if err != nil {
+		return nil, err
+	}
+	saved.NextID, _ = strconv.Atoi(next)
+
+	if saved.Collections, err = s.loadCollections(); err != nil {
+		return nil, err
+	}
+
+	if s.key != nil && encrypted == "" {
+		if err := s.sealAll(saved.Entries, saved.Collections); err != nil {
+			return nil, fmt.Errorf("encrypt %s: %w", s.filename, err)
+		}
+	}
+
+	return saved, nil
+}
+
+// sealAll rewrites every entry encrypted, the first time a key is used
+// with a database that was written in plain text. The database is vacuumed
+// afterwards so no plain copy is left in free pages.
+func (s *sqliteEngine) sealAll(entries []ClipboardEntry, collections []Collection) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, e := range entries {
+		if err := putEntry(tx, e, s.key); err != nil {
+			return err
+		}
+	}
+	if err := putCollections(tx, collections, s.key); err != nil {
+		return err
+	}
+	if err := setMeta(tx, "encrypted", "aes-256-gcm"); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	if _, err := s.db.Exec("VACUUM"); err != nil {
+		return err
+	}
+	_, err = s.db.Exec("PRAGMA wal_checkpoint(TRUNCATE)")
+	return err
+}
+
+// openColumn decrypts a column value written by sealColumn.
+func (s *sqliteEngine) openColumn(value string) (string, error) {
+	if !isSealedString(value) {
+		return value, nil
+	}
+	if s.key == nil {
+		return "", fmt.Errorf("%s: %w", s.filename, ErrEncrypted)
+	}
+	plain, err := s.key.openString(value)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", s.filename, err)
+	}
+	return string(plain), nil
+}
+
+// deletedAt is the deleted_at column of e, 0 for entries not in the trash.
+func deletedAt(e ClipboardEntry) int64 {
+	return unixNano(e.DeletedAt)
+}
+
+// unixNano stores an optional time, 0 when it is not set.
+func unixNano(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.UnixNano()
+}
+
+func sealColumn(value string, key *Key) (string, error) {
+	if key == nil {
+		return value, nil
+	}
+	return key.sealString([]byte(value))
+}
+
+// importLegacyJSON copies an existing JSON history into an empty database.
+// The import is recorded in meta so it only ever happens once.
+func (s *sqliteEngine) importLegacyJSON() error {
+	if s.legacyJSON == "" {
+		return nil
+	}
+	done, err := s.getMeta("imported_json")
+	if err != nil || done != "" {
+		return err
+	}
+
+	h, err := readHistory(s.legacyJSON, false, s.key)
+	if err != nil {
+		return err
+	}
+	var legacy *snapshot
+	if h.found {
+		legacy = h.snap
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if legacy != nil {
+		for _, e := range legacy.Entries {
+			if err := putEntry(tx, e, s.key); err != nil {
+				return err
+			}
+		}
+		next := legacy.NextID
+		for _, e := range legacy.Entries {
+			if e.ID >= next {
+				next = e.ID + 1
+			}
+		}
+		if err := setMeta(tx, "next_id", strconv.Itoa(next)); err != nil {
+			return err
+		}
+		if err := putCollections(tx, legacy.Collections, s.key); err != nil {
+			return err
+		}
+	}
+	if err := setMeta(tx, "imported_json", s.legacyJSON); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (s *sqliteEngine) commit(snap *snapshot, ch change) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if ch.cleared {
+		if _, err := tx.Exec("DELETE FROM entries"); err != nil {
+			return err
+		}
+	}
+	for _, id := range ch.deleted {
+		if _, err := tx.Exec("DELETE FROM entries WHERE id = ?", id); err != nil {
+			return err
+		}
+	}
+	for _, e := range ch.put {
+		if err := putEntry(tx, e, s.key); err != nil {
+			return err
+		}
+	}
+	if ch.collections != nil {
+		if err := putCollections(tx, ch.collections, s.key); err != nil {
+			return err
+		}
+	}
+	if err := setMeta(tx, "next_id", strconv.Itoa(snap.NextID)); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (s *sqliteEngine) close() error {
+	defer s.lock.Close()
+	return s.db.Close()
+}
+
+func (s *sqliteEngine) getMeta(key string) (string, error) {
+	var value string
+	err := s.db.QueryRow("SELECT value FROM meta WHERE key = ?", key).Scan(&value)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	return value, err
+}
+
+func setMeta(tx *sql.Tx, key, value string) error {
+	_, err := tx.Exec(`INSERT INTO meta (key, value) VALUES (?, ?)
+		ON CONFLICT(key) DO UPDATE SET value = excluded.value`, key, value)
+	return err
+}
+
+func putEntry(tx *sql.Tx, e ClipboardEntry, key *Key) error {
+	text, err := sealColumn(e.Text, key)
+	if err != nil {
+		return err
+	}
+	hash, err := sealColumn(e.Hash, key)
+	if err != nil {
+		return err
+	}
+	title, err := sealColumn(e.Title, key)
+	if err != nil {
+		return err
+	}
+	note, err := sealColumn(e.Note, key)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`INSERT INTO entries (id, text, is_image, category, language, content_hash,
+			timestamp, pinned, copy_count, last_used, deleted_at, size, text_blob, edited_at, title, note,
+			lines, selection, mime_types, width, height, format, host)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(id) DO UPDATE SET
+			text = excluded.text,
+			is_image = excluded.is_image,
+			category = excluded.category,
+			language = excluded.language,
+			content_hash = excluded.content_hash,
+			timestamp = excluded.timestamp,
+			pinned = excluded.pinned,
+			copy_count = excluded.copy_count,
+			last_used = excluded.last_used,
+			deleted_at = excluded.deleted_at,
+			size = excluded.size,
+			text_blob = excluded.text_blob,
+			edited_at = excluded.edited_at,
+			title = excluded.title,
+			note = excluded.note,
+			lines = excluded.lines,
+			selection = excluded.selection,
+			mime_types = excluded.mime_types,
+			width = excluded.width,
+			height = excluded.height,
+			format = excluded.format,
+			host = excluded.host`,
+		e.ID, text, e.IsImage, e.Category, e.Language, hash,
+		e.Timestamp.UnixNano(), e.Pinned, e.CopyCount, lastUsed(e).UnixNano(), deletedAt(e),
+		e.Size, e.TextBlob, unixNano(e.EditedAt), title, note,
+		e.Lines, e.Selection, strings.Join(e.MIMETypes, "\n"), e.Width, e.Height, e.Format, e.Host)
+	if err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec("DELETE FROM tags WHERE entry_id = ?", e.ID); err != nil {
+		return err
+	}
+	for i, tag := range e.Tags {
+		if tag, err = sealColumn(tag, key); err != nil {
+			return err
+		}
+		if _, err := tx.Exec("INSERT OR IGNORE INTO tags (entry_id, position, tag) VALUES (?, ?, ?)",
+			e.ID, i, tag); err != nil {
+			return err
+		}
+	}
+
+	if _, err := tx.Exec("DELETE FROM revisions WHERE entry_id = ?", e.ID); err != nil {
+		return err
+	}
+	for i, r := range e.Revisions {
+		text, err := sealColumn(r.Text, key)
+		if err != nil {
+			return err
+		}
+		hash, err := sealColumn(r.Hash, key)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec(`INSERT INTO revisions (entry_id, position, text, text_blob, size, content_hash, saved)
+			VALUES (?, ?, ?, ?, ?, ?, ?)`, e.ID, i, text, r.TextBlob, r.Size, hash, r.Saved.UnixNano()); err != nil {
+			return err
+		}
+	}
+
+	if _, err := tx.Exec("DELETE FROM images WHERE entry_id = ?", e.ID); err != nil {
+		return err
+	}
+	if e.IsImage && e.ImagePath != "" {
+		if _, err := tx.Exec("INSERT INTO images (entry_id, path, missing) VALUES (?, ?, ?)",
+			e.ID, e.ImagePath, e.Missing); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *sqliteEngine) loadCollections() ([]Collection, error) {
+	var collections []Collection
+	rows, err := s.db.Query("SELECT id, name, created FROM collections ORDER BY position")
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		c := Collection{Entries: []int{}}
+		var created int64
+		if err := rows.Scan(&c.ID, &c.Name, &created); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		if c.Name, err = s.openColumn(c.Name); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		c.Created = time.Unix(0, created)
+		collections = append(collections, c)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows, err = s.db.Query("SELECT collection_id, entry_id FROM collection_entries ORDER BY collection_id, position")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id, entryID int
+		if err := rows.Scan(&id, &entryID); err != nil {
+			return nil, err
+		}
+		for i := range collections {
+			if collections[i].ID == id {
+				collections[i].Entries = append(collections[i].Entries, entryID)
+			}
+		}
+	}
+	return collections, rows.Err()
+}
+
+// putCollections replaces every collection with cs.
+func putCollections(tx *sql.Tx, cs []Collection, key *Key) error {
+	if _, err := tx.Exec("DELETE FROM collections"); err != nil {
+		return err
+	}
+	for i, c := range cs {
+		name, err := sealColumn(c.Name, key)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec("INSERT INTO collections (id, name, position, created) VALUES (?, ?, ?, ?)",
+			c.ID, name, i, c.Created.UnixNano()); err != nil {
+			return err
+		}
+		for j, id := range c.Entries {
+			if _, err := tx.Exec("INSERT INTO collection_entries (collection_id, entry_id, position) VALUES (?, ?, ?)",
+				c.ID, id, j); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
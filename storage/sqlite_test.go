@@ -0,0 +1,96 @@
+package storage
+
+import (
+	"database/sql"
+	"math"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSQLiteHistoryTable(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "clipboard.db")
+	old, err := sql.Open("sqlite", "file:"+name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The schema the first versions created.
+	_, err = old.Exec(`CREATE TABLE history (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		text TEXT NOT NULL,
+		timestamp DATETIME DEFAULT CURRENT_TIMESTAMP
+	);
+	INSERT INTO history (text, timestamp) VALUES ('hello', '2025-10-14 02:28:47');
+	INSERT INTO history (text, timestamp) VALUES ('https://example.com', '2025-10-14 02:29:18');
+	INSERT INTO history (text) VALUES ('def f(): import os');`)
+	old.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db, err := NewSQLiteDatabase(name, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	m := db.Migration()
+	if m == nil || m.Backup == "" {
+		t.Fatalf("migration report %v, want a backup", m)
+	}
+	if got := m.Steps[0].Changed; got != 3 {
+		t.Errorf("first step changed %d entries, want 3", got)
+	}
+
+	entries, err := db.GetRecent(math.MaxInt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []struct {
+		id       int
+		text     string
+		category string
+	}{
+		{3, "def f(): import os", "code"},
+		{2, "https://example.com", "url"},
+		{1, "hello", "text"},
+	}
+	if len(entries) != len(want) {
+		t.Fatalf("got %d entries, want %d", len(entries), len(want))
+	}
+	for i, w := range want {
+		e := entries[i]
+		if e.ID != w.id || e.Text != w.text || e.Category != w.category {
+			t.Errorf("entry %d = %d %q %s, want %d %q %s", i, e.ID, e.Text, e.Category, w.id, w.text, w.category)
+		}
+		if e.Hash == "" || e.CopyCount != 1 {
+			t.Errorf("entry %d: hash %q, copied %d times", e.ID, e.Hash, e.CopyCount)
+		}
+	}
+	if ts := entries[2].Timestamp.UTC(); !ts.Equal(time.Date(2025, 10, 14, 2, 28, 47, 0, time.UTC)) {
+		t.Errorf("timestamp %v", ts)
+	}
+
+	if err := db.AddEntry("new"); err != nil {
+		t.Fatal(err)
+	}
+	if entries, _ := db.GetRecent(1); entries[0].ID != 4 {
+		t.Errorf("new entry got ID %d, want 4", entries[0].ID)
+	}
+
+	// The old table is gone, its rows kept in the backup.
+	s := db.engine.(*sqliteEngine)
+	var tables int
+	if err := s.db.QueryRow("SELECT count(*) FROM sqlite_master WHERE name = 'history'").Scan(&tables); err != nil || tables != 0 {
+		t.Errorf("history table still there: %d, %v", tables, err)
+	}
+	backup, err := sql.Open("sqlite", "file:"+m.Backup+"?mode=ro")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer backup.Close()
+	var rows int
+	if err := backup.QueryRow("SELECT count(*) FROM history").Scan(&rows); err != nil || rows != 3 {
+		t.Errorf("backup has %d rows, %v", rows, err)
+	}
+}
@@ -0,0 +1,105 @@
+package storage
+
+import (
+	"errors"
+	"io"
+)
+
+var ErrNotFound = errors.New("entry not found")
+
+// Recorder adds what was copied to the history.
+type Recorder interface {
+	AddEntry(text string) error
+	AddImageEntry(imagePath string) error
+	AddImage(png []byte) error
+	AddEntryFrom(text string, src Source) error
+	AddImageFrom(data []byte, src Source) error
+}
+
+// History reads the entries and reports changes to them as they happen.
+type History interface {
+	GetRecent(limit int) ([]ClipboardEntry, error)
+	GetEntry(id int) (ClipboardEntry, error)
+	LoadText(e ClipboardEntry) (string, error)
+	GetByCategory(category string, limit int) ([]ClipboardEntry, error)
+	Search(query string) ([]ClipboardEntry, error)
+	Count() (int, error)
+	Subscribe() (<-chan Event, func())
+}
+
+// Editor changes the text of entries, keeping revisions, and their titles
+// and notes.
+type Editor interface {
+	UpdateEntry(id int, text string) (ClipboardEntry, error)
+	RevertEntry(id, revision int) (ClipboardEntry, error)
+	LoadRevision(r Revision) (string, error)
+	SetTitle(id int, title string) error
+	SetNote(id int, note string) error
+}
+
+// Pins keeps entries out of reach of retention and Clear.
+type Pins interface {
+	GetPinned() ([]ClipboardEntry, error)
+	Pin(id int) error
+	Unpin(id int) error
+}
+
+// Tags labels entries.
+type Tags interface {
+	AddTags(id int, tags ...string) error
+	RemoveTags(id int, tags ...string) error
+	ListTags() ([]TagCount, error)
+	RenameTag(old, name string) (int, error)
+	MergeTag(from, into string) (int, error)
+}
+
+// Collections groups entries into named, ordered lists.
+type Collections interface {
+	Collections() ([]Collection, error)
+	CollectionEntries(id int) ([]ClipboardEntry, error)
+	CreateCollection(name string) (Collection, error)
+	RenameCollection(id int, name string) error
+	DeleteCollection(id int) error
+	MoveCollection(id, index int) error
+	AddToCollection(id, entryID int) error
+	RemoveFromCollection(id, entryID int) error
+	MoveInCollection(id, entryID, index int) error
+}
+
+// Trash deletes entries so that they can still be restored.
+type Trash interface {
+	DeleteEntry(id int) error
+	Clear(force bool) error
+	GetTrash() ([]ClipboardEntry, error)
+	Restore(id int) error
+	EmptyTrash() (int, error)
+}
+
+// Maintenance keeps the history within its limits and its files in order,
+// and copies it elsewhere.
+type Maintenance interface {
+	Prune() (PruneReport, error)
+	GC() (GCReport, error)
+	Backup(dir string) (Backup, error)
+	VerifyBackup(path string) error
+	RestoreBackup(path string) error
+	Export(w io.Writer, f Filter) error
+}
+
+// Store is a whole clipboard history, as the UIs use it. Database
+// implements it on top of a JSON file, SQLite or plain memory through its
+// engine; code that needs only part of a history, like the watcher, takes
+// the role interfaces above.
+type Store interface {
+	Recorder
+	History
+	Editor
+	Pins
+	Tags
+	Collections
+	Trash
+	Maintenance
+	Close() error
+}
+
+var _ Store = (*Database)(nil)
@@ -0,0 +1,183 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ErrTagExists is returned when renaming a tag to one that is already in
+// use; MergeTag joins two tags instead.
+var ErrTagExists = errors.New("tag already exists")
+
+// ErrNoTag is returned when renaming or merging a tag no entry has.
+var ErrNoTag = errors.New("no entry has that tag")
+
+// TagCount is a tag and how many entries in the history carry it.
+type TagCount struct {
+	Name  string
+	Count int
+}
+
+// NormalizeTag returns tag the way it is stored: lower case, without a
+// leading # and with inner spaces turned into dashes. It is empty for
+// blank tags.
+func NormalizeTag(tag string) string {
+	tag = strings.TrimPrefix(strings.TrimSpace(tag), "#")
+	return strings.ToLower(strings.Join(strings.Fields(tag), "-"))
+}
+
+// AddTags tags an entry. Tags it already has are left as they are.
+func (d *Database) AddTags(id int, tags ...string) error {
+	return d.retag(id, func(have []string) []string {
+		for _, tag := range tags {
+			if tag = NormalizeTag(tag); tag != "" && indexOfTag(have, tag) < 0 {
+				have = append(have, tag)
+			}
+		}
+		return have
+	})
+}
+
+// RemoveTags takes tags off an entry. Tags it does not have are ignored.
+func (d *Database) RemoveTags(id int, tags ...string) error {
+	return d.retag(id, func(have []string) []string {
+		for _, tag := range tags {
+			if i := indexOfTag(have, NormalizeTag(tag)); i >= 0 {
+				have = append(have[:i], have[i+1:]...)
+			}
+		}
+		return have
+	})
+}
+
+func (d *Database) retag(id int, edit func(have []string) []string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	i := d.entryIndex(id)
+	if i < 0 {
+		return ErrNotFound
+	}
+	entry := d.entries[i]
+	entry.Tags = edit(append([]string{}, entry.Tags...))
+	if strings.Join(entry.Tags, " ") == strings.Join(d.entries[i].Tags, " ") {
+		return nil
+	}
+	d.entries[i] = entry
+	return d.commit(change{put: []ClipboardEntry{entry}}, Event{Type: EventUpdated, Entry: entry})
+}
+
+// ListTags returns every tag in the history with the number of entries
+// carrying it, most used first.
+func (d *Database) ListTags() ([]TagCount, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	counts := map[string]int{}
+	for _, e := range d.entries {
+		for _, tag := range e.Tags {
+			counts[tag]++
+		}
+	}
+	tags := make([]TagCount, 0, len(counts))
+	for name, n := range counts {
+		tags = append(tags, TagCount{Name: name, Count: n})
+	}
+	sort.Slice(tags, func(i, j int) bool {
+		if tags[i].Count != tags[j].Count {
+			return tags[i].Count > tags[j].Count
+		}
+		return tags[i].Name < tags[j].Name
+	})
+	return tags, nil
+}
+
+// RenameTag renames a tag on every entry, including those in the trash,
+// and returns how many entries changed. It fails with ErrTagExists if the
+// new name is already used.
+func (d *Database) RenameTag(old, name string) (int, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	old, name = NormalizeTag(old), NormalizeTag(name)
+	if name == "" {
+		return 0, errors.New("tag is empty")
+	}
+	if old == name {
+		return 0, nil
+	}
+	if d.tagged(name) {
+		return 0, fmt.Errorf("%w: %s", ErrTagExists, name)
+	}
+	return d.replaceTag(old, name)
+}
+
+// MergeTag moves every entry tagged from over to into, which may already
+// be in use, and returns how many entries changed.
+func (d *Database) MergeTag(from, into string) (int, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	from, into = NormalizeTag(from), NormalizeTag(into)
+	if into == "" {
+		return 0, errors.New("tag is empty")
+	}
+	if from == into {
+		return 0, nil
+	}
+	return d.replaceTag(from, into)
+}
+
+// replaceTag swaps tag old for name on every entry that has it. Callers
+// must hold d.mu.
+func (d *Database) replaceTag(old, name string) (int, error) {
+	if !d.tagged(old) {
+		return 0, fmt.Errorf("%w: %s", ErrNoTag, old)
+	}
+	var ch change
+	var events []Event
+	for _, list := range [][]ClipboardEntry{d.entries, d.trash} {
+		for i, e := range list {
+			j := indexOfTag(e.Tags, old)
+			if j < 0 {
+				continue
+			}
+			tags := append([]string{}, e.Tags...)
+			if indexOfTag(tags, name) >= 0 {
+				tags = append(tags[:j], tags[j+1:]...)
+			} else {
+				tags[j] = name
+			}
+			e.Tags = tags
+			list[i] = e
+			ch.put = append(ch.put, e)
+			if e.DeletedAt.IsZero() {
+				events = append(events, Event{Type: EventUpdated, Entry: e})
+			}
+		}
+	}
+	return len(ch.put), d.commit(ch, events...)
+}
+
+// tagged reports whether any entry, in the history or the trash, has tag.
+func (d *Database) tagged(tag string) bool {
+	for _, list := range [][]ClipboardEntry{d.entries, d.trash} {
+		for _, e := range list {
+			if indexOfTag(e.Tags, tag) >= 0 {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func indexOfTag(tags []string, tag string) int {
+	for i, t := range tags {
+		if t == tag {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,161 @@
+package storage
+
+import (
+	"fmt"
+	"time"
+)
+
+// trashLocked moves entries, already taken out of d.entries, to the trash
+// and returns the change and events the caller has to commit. Their image
+// files stay until the trash is purged. Callers must hold d.mu.
+func (d *Database) trashLocked(now time.Time, entries ...ClipboardEntry) (change, []Event) {
+	var ch change
+	var events []Event
+	for _, entry := range entries {
+		entry.DeletedAt = now
+		d.unindex(entry)
+		d.trash = append(d.trash, entry)
+		ch.put = append(ch.put, entry)
+		events = append(events, Event{Type: EventDeleted, Entry: entry})
+	}
+	sortTrash(d.trash)
+	return ch, events
+}
+
+// GetTrash returns the deleted entries that can still be restored, most
+// recently deleted first.
+func (d *Database) GetTrash() ([]ClipboardEntry, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	return append([]ClipboardEntry(nil), d.trash...), nil
+}
+
+// Restore brings an entry back from the trash. If the same content has
+// been copied again since, the two are merged into the live entry, which
+// gains the tags of the restored one and its title, note and revisions
+// where it has none of its own.
+func (d *Database) Restore(id int) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	i := d.trashIndex(id)
+	if i < 0 {
+		return ErrNotFound
+	}
+	entry := d.trash[i]
+	d.trash = append(d.trash[:i:i], d.trash[i+1:]...)
+	entry.DeletedAt = time.Time{}
+
+	if liveID, ok := d.byHash[entry.Hash]; ok {
+		for j, live := range d.entries {
+			if live.ID != liveID {
+				continue
+			}
+			live.CopyCount += entry.CopyCount
+			live.Pinned = live.Pinned || entry.Pinned
+			live.Tags = append([]string(nil), live.Tags...)
+			for _, tag := range entry.Tags {
+				if indexOfTag(live.Tags, tag) < 0 {
+					live.Tags = append(live.Tags, tag)
+				}
+			}
+			if live.Title == "" {
+				live.Title = entry.Title
+			}
+			if live.Note == "" {
+				live.Note = entry.Note
+			}
+			if len(live.Revisions) == 0 {
+				// The revisions move over with their files.
+				live.Revisions, entry.Revisions = entry.Revisions, nil
+			}
+			d.entries[j] = live
+			ch := change{put: []ClipboardEntry{live}, deleted: []int{entry.ID}, release: []ClipboardEntry{entry}}
+			events := []Event{{Type: EventUpdated, Entry: live}}
+			if d.replaceMember(entry.ID, live.ID) {
+				ch.collections = d.collections
+				events = append(events, Event{Type: EventCollections})
+			}
+			return d.commit(ch, events...)
+		}
+	}
+
+	d.entries = append(d.entries, entry)
+	sortEntries(d.entries)
+	d.byHash[entry.Hash] = entry.ID
+	return d.commit(change{put: []ClipboardEntry{entry}}, Event{Type: EventRestored, Entry: entry})
+}
+
+// EmptyTrash deletes every entry in the trash for good, along with image
+// files nothing else refers to, and returns how many entries it deleted.
+func (d *Database) EmptyTrash() (int, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	n := len(d.trash)
+	if n == 0 {
+		return 0, nil
+	}
+	ch := d.purgeLocked(d.trash...)
+	return n, d.commit(ch)
+}
+
+func (d *Database) trashIndex(id int) int {
+	for i, entry := range d.trash {
+		if entry.ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// purgeLocked drops entries from the trash; their images are released once
+// the change is committed. Nothing is published, as the entries already
+// left the history when they were trashed. Callers must hold d.mu.
+func (d *Database) purgeLocked(entries ...ClipboardEntry) change {
+	var ch change
+	gone := map[int]bool{}
+	for _, entry := range entries {
+		gone[entry.ID] = true
+		ch.deleted = append(ch.deleted, entry.ID)
+		ch.release = append(ch.release, entry)
+	}
+
+	kept := d.trash[:0:0]
+	for _, entry := range d.trash {
+		if !gone[entry.ID] {
+			kept = append(kept, entry)
+		}
+	}
+	d.trash = kept
+	return ch
+}
+
+// expireTrashLocked purges entries that have been in the trash longer than
+// the retention policy allows. Callers must hold d.mu.
+func (d *Database) expireTrashLocked(now time.Time, report *PruneReport) change {
+	keep := d.retention.TrashFor
+	if keep <= 0 {
+		return change{}
+	}
+
+	var expired []ClipboardEntry
+	for _, entry := range d.trash {
+		if now.Sub(entry.DeletedAt) > keep {
+			expired = append(expired, entry)
+		}
+	}
+	if len(expired) == 0 {
+		return change{}
+	}
+
+	if report != nil {
+		reason := fmt.Sprintf("in trash for more than %s", keep)
+		for _, entry := range expired {
+			report.Entries = append(report.Entries, PrunedEntry{Entry: entry, Reason: reason})
+			report.BytesFreed += textSize(entry)
+		}
+	}
+	return d.purgeLocked(expired...)
+}
@@ -0,0 +1,171 @@
+package storage
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestRestore(t *testing.T) {
+	tests := []struct {
+		name string
+		// again copies the text again after it was deleted.
+		again bool
+		// live is how the copy made since is annotated.
+		live func(db *Database, id int)
+		want ClipboardEntry
+	}{
+		{"nothing copied since", false, nil,
+			ClipboardEntry{Tags: []string{"deploy"}, Title: "old title", Note: "old note", CopyCount: 2}},
+		{"copied again", true, nil,
+			ClipboardEntry{Tags: []string{"deploy"}, Title: "old title", Note: "old note", CopyCount: 3}},
+		{"copied again and annotated", true, func(db *Database, id int) {
+			db.AddTags(id, "prod", "deploy")
+			db.SetTitle(id, "new title")
+		}, ClipboardEntry{Tags: []string{"prod", "deploy"}, Title: "new title", Note: "old note", CopyCount: 3}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := NewMemoryStore()
+			defer db.Close()
+			db.AddEntry("kubectl apply")
+			db.AddEntry("kubectl apply")
+			old, _ := db.GetRecent(1)
+			id := old[0].ID
+			db.AddTags(id, "deploy")
+			db.SetTitle(id, "old title")
+			db.SetNote(id, "old note")
+			if err := db.DeleteEntry(id); err != nil {
+				t.Fatal(err)
+			}
+			if tt.again {
+				db.AddEntry("kubectl apply")
+				if tt.live != nil {
+					live, _ := db.GetRecent(1)
+					tt.live(db, live[0].ID)
+				}
+			}
+
+			if err := db.Restore(id); err != nil {
+				t.Fatal(err)
+			}
+			entries, _ := db.GetRecent(10)
+			if len(entries) != 1 {
+				t.Fatalf("got %d entries, want the two merged into one", len(entries))
+			}
+			got := entries[0]
+			if !reflect.DeepEqual(got.Tags, tt.want.Tags) || got.Title != tt.want.Title || got.Note != tt.want.Note || got.CopyCount != tt.want.CopyCount {
+				t.Errorf("restored %v %q %q copied %d times, want %v %q %q %d times",
+					got.Tags, got.Title, got.Note, got.CopyCount, tt.want.Tags, tt.want.Title, tt.want.Note, tt.want.CopyCount)
+			}
+			if trash, _ := db.GetTrash(); len(trash) != 0 {
+				t.Errorf("%d entries left in the trash", len(trash))
+			}
+		})
+	}
+}
+
+func TestTrash(t *testing.T) {
+	tests := []struct {
+		name string
+		// act runs against a history of "one", "two" and "three".
+		act     func(db *Database) error
+		history []string
+		trash   []string
+	}{
+		{"delete", func(db *Database) error { return db.DeleteEntry(2) },
+			[]string{"three", "one"}, []string{"two"}},
+		{"delete twice", func(db *Database) error {
+			db.DeleteEntry(2)
+			return db.DeleteEntry(1)
+		}, []string{"three"}, []string{"one", "two"}},
+		{"delete from the trash", func(db *Database) error {
+			db.DeleteEntry(2)
+			if err := db.DeleteEntry(2); err != ErrNotFound {
+				t.Errorf("deleting a trashed entry: got %v, want ErrNotFound", err)
+			}
+			return nil
+		}, []string{"three", "one"}, []string{"two"}},
+		{"clear", func(db *Database) error { return db.Clear(false) },
+			nil, []string{"three", "two", "one"}},
+		{"restore", func(db *Database) error {
+			db.DeleteEntry(2)
+			return db.Restore(2)
+		}, []string{"three", "two", "one"}, nil},
+		{"restore a live entry", func(db *Database) error {
+			if err := db.Restore(2); err != ErrNotFound {
+				t.Errorf("restoring a live entry: got %v, want ErrNotFound", err)
+			}
+			return nil
+		}, []string{"three", "two", "one"}, nil},
+		{"empty", func(db *Database) error {
+			db.Clear(false)
+			n, err := db.EmptyTrash()
+			if n != 3 {
+				t.Errorf("emptied %d entries, want 3", n)
+			}
+			return err
+		}, nil, nil},
+		{"empty an empty trash", func(db *Database) error {
+			_, err := db.EmptyTrash()
+			return err
+		}, []string{"three", "two", "one"}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := NewMemoryStore()
+			defer db.Close()
+			for _, text := range []string{"one", "two", "three"} {
+				db.AddEntry(text)
+			}
+
+			if err := tt.act(db); err != nil {
+				t.Fatal(err)
+			}
+			if got := texts(t, db); !equalStrings(got, tt.history) {
+				t.Errorf("history is %q, want %q", got, tt.history)
+			}
+			trash, _ := db.GetTrash()
+			var got []string
+			for _, e := range trash {
+				got = append(got, e.Text)
+			}
+			if !equalStrings(got, tt.trash) {
+				t.Errorf("trash is %q, want %q", got, tt.trash)
+			}
+		})
+	}
+}
+
+func TestRestoreCommitFails(t *testing.T) {
+	dir := t.TempDir()
+	db, err := NewDatabase(filepath.Join(dir, "history.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if err := db.SetImageDir(filepath.Join(dir, "images")); err != nil {
+		t.Fatal(err)
+	}
+	png := []byte("\x89PNG\r\n\x1a\ncopied twice")
+	db.AddImage(png)
+	entries, _ := db.GetRecent(1)
+	trashed := entries[0]
+	db.DeleteEntry(trashed.ID)
+	db.AddImage(png)
+
+	db.engine = failingEngine{db.engine}
+	if err := db.Restore(trashed.ID); err == nil {
+		t.Fatal("Restore succeeded without a commit")
+	}
+	if trash, _ := db.GetTrash(); len(trash) != 1 || trash[0].ID != trashed.ID {
+		t.Errorf("trash is %v, want the entry back in it", trash)
+	}
+	if refs := db.blobs.Refs(trashed.ImagePath); refs != 2 {
+		t.Errorf("image has %d references, want one from each entry", refs)
+	}
+	if _, err := os.Stat(trashed.ImagePath); err != nil {
+		t.Errorf("image of the trashed entry: %v", err)
+	}
+}
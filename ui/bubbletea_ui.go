@@ -1,11 +1,15 @@
 package ui
 
 import (
+	"clipboard_manager/clipboard"
+	"clipboard_manager/profile"
 	"clipboard_manager/storage"
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/charmbracelet/bubbles/list"
+	"github.com/charmbracelet/bubbles/textinput"
 	"github.com/charmbracelet/bubbles/viewport"
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/lipgloss"
@@ -32,8 +36,20 @@ type item struct {
 }
 
 func (i item) Title() string {
+	pin := ""
+	if i.entry.Pinned {
+		pin = "📌 "
+	}
+
+	if i.entry.Title != "" {
+		return fmt.Sprintf("%s[%d] %s", pin, i.entry.ID, i.entry.Title)
+	}
+
 	if i.entry.IsImage {
-		return fmt.Sprintf("🖼️  [Image] - ID: %d", i.entry.ID)
+		if i.entry.Missing {
+			return fmt.Sprintf("%s⚠️  [Image missing] - ID: %d", pin, i.entry.ID)
+		}
+		return fmt.Sprintf("%s🖼️  [Image] - ID: %d", pin, i.entry.ID)
 	}
 
 	preview := i.entry.Text
@@ -42,53 +58,127 @@ func (i item) Title() string {
 	}
 	preview = strings.ReplaceAll(preview, "\n", " ")
 
-	return fmt.Sprintf("[%d] %s", i.entry.ID, preview)
+	return fmt.Sprintf("%s[%d] %s", pin, i.entry.ID, preview)
 }
 
 func (i item) Description() string {
-	return fmt.Sprintf("Category: %s | %s", i.entry.Category, FormatTimeAgo(i.entry.Timestamp))
+	desc := fmt.Sprintf("Category: %s | %s", i.entry.Category, FormatTimeAgo(i.entry.LastUsed))
+	if i.entry.CopyCount > 1 {
+		desc += fmt.Sprintf(" | copied %d×", i.entry.CopyCount)
+	}
+	if i.entry.Offloaded() {
+		desc += " | " + storage.FormatBytes(int64(i.entry.Size))
+	}
+	if i.entry.Note != "" {
+		desc += " | 📝"
+	}
+	if len(i.entry.Tags) > 0 {
+		desc += " | #" + strings.Join(i.entry.Tags, " #")
+	}
+	return desc
 }
 
-func (i item) FilterValue() string { return i.entry.Text }
+func (i item) FilterValue() string {
+	return strings.Join([]string{i.entry.Title, i.entry.Note, strings.Join(i.entry.Tags, " "), i.entry.Text}, " ")
+}
 
 type StatusMsg string
 
+// entryEventMsg carries a change published by the store that events
+// belongs to.
+type entryEventMsg struct {
+	storage.Event
+	events <-chan storage.Event
+}
+
+// undoExpiredMsg hides the undo toast it was scheduled for.
+type undoExpiredMsg int
+
+// undoWindow is how long the undo toast stays up after a delete.
+const undoWindow = 5 * time.Second
+
 type model struct {
 	list     list.Model
 	viewport viewport.Model
-	db       *storage.Database
+	db       storage.Store
+	clip     clipboard.Backend
+	events   <-chan storage.Event
 	viewing  bool
 	selected *storage.ClipboardEntry
 	status   string
+	// undo is the entry the last delete sent to the trash while the undo
+	// toast is showing, undoSeq tells its toasts apart.
+	undo    *storage.ClipboardEntry
+	undoSeq int
+	// profiles is nil when profiles are not in use. While picking, the
+	// profile picker is showing for pickAction: switch, move or copy.
+	profiles   *profile.Manager
+	picking    bool
+	pickAction string
+	pickNames  []string
+	pickIndex  int
+	// revising shows the revisions of the selected entry, revIndex is the
+	// one compared with the current text, counting from 1. When revMark is
+	// set, the revision it names is compared with revIndex instead.
+	revising bool
+	revIndex int
+	revMark  int
+	// prompt is "title" or "tags" while that field of the selected entry
+	// is typed into input.
+	prompt string
+	input  textinput.Model
+	// collecting shows the collections, or the entries of colOpen when it
+	// is not 0. With colAdding set, choosing a collection adds that entry
+	// to it. colNaming is "new" or "rename" while a name is typed.
+	collecting bool
+	colAdding  *storage.ClipboardEntry
+	colList    []storage.Collection
+	colIndex   int
+	colOpen    int
+	colEntries []storage.ClipboardEntry
+	colEntry   int
+	colNaming  string
+	colInput   textinput.Model
 }
 
-func NewBubbleTeaUI(db *storage.Database) *model {
-	entries, _ := db.GetRecent(50)
-
-	items := []list.Item{}
-	for _, entry := range entries {
-		items = append(items, item{entry: entry})
-	}
-
-	l := list.New(items, list.NewDefaultDelegate(), 0, 0)
+func NewBubbleTeaUI(db storage.Store, profiles *profile.Manager, clip clipboard.Backend) *model {
+	l := list.New(loadItems(db), list.NewDefaultDelegate(), 0, 0)
 	l.Title = "📋 Clipboard Manager"
+	if profiles != nil {
+		p, _ := profiles.Active()
+		l.Title = "📋 Clipboard Manager · " + p.Name
+	}
 	l.SetShowStatusBar(true)
 	l.SetFilteringEnabled(true)
 	l.Styles.Title = titleStyle
 
 	vp := viewport.New(80, 20)
+	events, _ := db.Subscribe()
 
 	return &model{
 		list:     l,
 		viewport: vp,
 		db:       db,
+		clip:     clip,
+		events:   events,
 		viewing:  false,
 		status:   "",
+		profiles: profiles,
 	}
 }
 
 func (m model) Init() tea.Cmd {
-	return nil
+	return waitForEvent(m.events)
+}
+
+func waitForEvent(events <-chan storage.Event) tea.Cmd {
+	return func() tea.Msg {
+		ev, ok := <-events
+		if !ok {
+			return nil
+		}
+		return entryEventMsg{Event: ev, events: events}
+	}
 }
 
 func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
@@ -97,7 +187,46 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		m.status = string(msg)
 		return m, nil
 
+	case entryEventMsg:
+		if msg.events != m.events {
+			// Left over from the profile that was switched away from.
+			return m, nil
+		}
+		m.refreshList()
+		if m.collecting {
+			m.loadCollections()
+		}
+		// Collection changes come from this UI, which reports them itself.
+		if msg.Type != storage.EventCollections {
+			m.status = eventStatus(msg.Event)
+		}
+		return m, waitForEvent(m.events)
+
+	case editedMsg:
+		return m.finishEdit(msg)
+
+	case copiedMsg:
+		return m.finishCopy(msg)
+
+	case noteEditedMsg:
+		return m.finishNote(msg)
+
+	case undoExpiredMsg:
+		if int(msg) == m.undoSeq {
+			m.undo = nil
+		}
+		return m, nil
+
 	case tea.KeyMsg:
+		if m.picking {
+			return m.updatePicker(msg)
+		}
+		if m.prompt != "" {
+			return m.updatePrompt(msg)
+		}
+		if m.collecting && !m.viewing {
+			return m.updateCollections(msg)
+		}
 		switch msg.String() {
 		case "ctrl+c", "q":
 			return m, tea.Quit
@@ -112,23 +241,157 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			}
 
 		case "esc":
-			if m.viewing {
+			if m.revising {
+				m.revising = false
+				m.showEntry(*m.selected)
+			} else if m.viewing {
 				m.viewing = false
 				m.selected = nil
 			}
 
-		case "d":
-			if !m.viewing {
+		case "e":
+			if m.viewing && !m.revising {
+				return m.editEntry(*m.selected)
+			}
+
+		case "t":
+			if m.viewing && !m.revising {
+				return m.openPrompt("title")
+			}
+
+		case "T":
+			if m.viewing && !m.revising {
+				return m.openPrompt("tags")
+			}
+			if !m.viewing && m.list.FilterState() != list.Filtering {
 				if i, ok := m.list.SelectedItem().(item); ok {
-					m.db.DeleteEntry(i.entry.ID)
-					m.refreshList()
-					m.status = fmt.Sprintf("Deleted entry #%d", i.entry.ID)
+					m.selected = &i.entry
+					return m.openPrompt("tags")
 				}
 			}
 
+		case "n":
+			if m.viewing && !m.revising {
+				return m.editNote(*m.selected)
+			}
+
+		case "h":
+			if m.viewing && !m.revising {
+				if len(m.selected.Revisions) == 0 {
+					m.status = "No earlier revisions"
+					return m, nil
+				}
+				m.revising = true
+				m.revIndex = len(m.selected.Revisions)
+				m.revMark = 0
+				m.showEntry(*m.selected)
+				m.viewport.GotoTop()
+				return m, nil
+			}
+
+		case "left", "right":
+			if m.revising {
+				if msg.String() == "left" && m.revIndex > 1 {
+					m.revIndex--
+				} else if msg.String() == "right" && m.revIndex < len(m.selected.Revisions) {
+					m.revIndex++
+				}
+				m.showEntry(*m.selected)
+				return m, nil
+			}
+
+		case " ":
+			if m.revising {
+				if m.revMark == m.revIndex {
+					m.revMark = 0
+				} else {
+					m.revMark = m.revIndex
+				}
+				m.showEntry(*m.selected)
+				return m, nil
+			}
+
 		case "r":
-			m.refreshList()
-			m.status = "Refreshed"
+			if m.revising {
+				return m.revert()
+			}
+
+		case "d":
+			if !m.viewing && m.list.FilterState() != list.Filtering {
+				if i, ok := m.list.SelectedItem().(item); ok {
+					if err := m.db.DeleteEntry(i.entry.ID); err != nil {
+						m.status = "❌ " + err.Error()
+						return m, nil
+					}
+					entry := i.entry
+					m.undo = &entry
+					m.undoSeq++
+					seq := m.undoSeq
+					return m, tea.Tick(undoWindow, func(time.Time) tea.Msg { return undoExpiredMsg(seq) })
+				}
+			}
+
+		case "u":
+			if !m.viewing && m.list.FilterState() != list.Filtering && m.undo != nil {
+				if err := m.db.Restore(m.undo.ID); err != nil {
+					m.status = "❌ " + err.Error()
+				}
+				m.undo = nil
+				return m, nil
+			}
+
+		case "P", "m", "c":
+			if !m.viewing && m.list.FilterState() != list.Filtering && m.profiles != nil {
+				action := map[string]string{"P": "switch", "m": "move", "c": "copy"}[msg.String()]
+				if _, ok := m.list.SelectedItem().(item); !ok && action != "switch" {
+					return m, nil
+				}
+				if err := m.openPicker(action); err != nil {
+					m.status = "❌ " + err.Error()
+				}
+				return m, nil
+			}
+
+		case "C":
+			if !m.viewing && m.list.FilterState() != list.Filtering {
+				m.openCollections(nil)
+				return m, nil
+			}
+
+		case "a":
+			if !m.viewing && m.list.FilterState() != list.Filtering {
+				if i, ok := m.list.SelectedItem().(item); ok {
+					entry := i.entry
+					m.openCollections(&entry)
+				}
+				return m, nil
+			}
+
+		case "y":
+			if m.viewing && !m.revising {
+				cmd := m.copyEntry(*m.selected)
+				return m, cmd
+			}
+			if !m.viewing && m.list.FilterState() != list.Filtering {
+				var cmd tea.Cmd
+				if i, ok := m.list.SelectedItem().(item); ok {
+					cmd = m.copyEntry(i.entry)
+				}
+				return m, cmd
+			}
+
+		case "p":
+			if !m.viewing && m.list.FilterState() != list.Filtering {
+				if i, ok := m.list.SelectedItem().(item); ok {
+					pin := m.db.Pin
+					if i.entry.Pinned {
+						pin = m.db.Unpin
+					}
+					if err := pin(i.entry.ID); err != nil {
+						m.status = "❌ " + err.Error()
+					}
+				}
+			}
 		}
 
 	case tea.WindowSizeMsg:
@@ -149,22 +412,94 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 }
 
 func (m model) View() string {
+	if m.picking {
+		return m.pickerView()
+	}
 	if m.viewing && m.selected != nil {
+		keys := "Press ESC to go back | y: Copy  e: Edit  t: Title  T: Tags  n: Note  h: Revisions | q to quit"
+		if m.revising {
+			keys = "Press ESC to go back | ←/→: Pick revision  space: Mark to compare  r: Revert | q to quit"
+		}
+		if m.prompt != "" {
+			return m.viewport.View() + "\n\n" + m.input.View()
+		}
 		return m.viewport.View() + "\n\n" +
-			lipgloss.NewStyle().Faint(true).Render("Press ESC to go back | q to quit")
+			lipgloss.NewStyle().Faint(true).Render(strings.TrimSpace(m.status+"  "+keys))
+	}
+	if m.collecting {
+		return m.collectionsView()
 	}
 
-	footer := lipgloss.NewStyle().Faint(true).Render(m.status + "  |  Enter: View  d: Delete  r: Refresh  q: Quit")
+	keys := "  |  Enter: View  y: Copy  p: Pin  d: Delete  T: Tags  a: Collect  C: Collections  q: Quit"
+	if m.profiles != nil {
+		keys = "  |  Enter: View  y: Copy  p: Pin  d: Delete  T: Tags  a: Collect  C: Collections  P: Profile  m/c: Move/Copy  q: Quit"
+	}
+	footer := lipgloss.NewStyle().Faint(true).Render(m.status + keys)
+	if m.prompt != "" {
+		footer = m.input.View()
+	}
+	if m.undo != nil {
+		toast := lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color("#EE6FF8")).
+			Render(fmt.Sprintf("🗑️  Entry #%d moved to trash — press u to undo", m.undo.ID))
+		footer = toast + "\n" + footer
+	}
 	return m.list.View() + "\n" + footer
 }
 
 func (m *model) refreshList() {
-	entries, _ := m.db.GetRecent(50)
+	m.list.SetItems(loadItems(m.db))
+}
+
+// loadItems lists pinned entries first, then the most recent ones.
+func loadItems(db storage.Store) []list.Item {
+	pinned, _ := db.GetPinned()
+	entries, _ := db.GetRecent(50)
+
 	items := []list.Item{}
-	for _, entry := range entries {
+	for _, entry := range pinned {
 		items = append(items, item{entry: entry})
 	}
-	m.list.SetItems(items)
+	for _, entry := range entries {
+		if !entry.Pinned {
+			items = append(items, item{entry: entry})
+		}
+	}
+	return items
+}
+
+func eventStatus(ev storage.Event) string {
+	switch ev.Type {
+	case storage.EventAdded:
+		if ev.Entry.IsImage {
+			return "🖼️ Saved image: " + ev.Entry.ImagePath
+		}
+		preview := ev.Entry.Text
+		if len(preview) > 60 {
+			preview = preview[:60] + "..."
+		}
+		return "✓ Saved: " + strings.ReplaceAll(preview, "\n", " ")
+	case storage.EventDeleted:
+		if !ev.Entry.DeletedAt.IsZero() {
+			return fmt.Sprintf("🗑️ Moved entry #%d to trash", ev.Entry.ID)
+		}
+		return fmt.Sprintf("Deleted entry #%d", ev.Entry.ID)
+	case storage.EventRestored:
+		return fmt.Sprintf("♻️ Restored entry #%d", ev.Entry.ID)
+	case storage.EventReset:
+		return "♻️ History restored from backup"
+	case storage.EventCollections:
+		return "📚 Collections updated"
+	case storage.EventUpdated:
+		if time.Since(ev.Entry.LastUsed) < time.Second && ev.Entry.CopyCount > 1 {
+			return fmt.Sprintf("↑ Copied again: entry #%d", ev.Entry.ID)
+		}
+		if ev.Entry.Pinned {
+			return fmt.Sprintf("📌 Pinned entry #%d", ev.Entry.ID)
+		}
+		return fmt.Sprintf("Updated entry #%d", ev.Entry.ID)
+	default:
+		return fmt.Sprintf("Updated entry #%d", ev.Entry.ID)
+	}
 }
 
 func (m *model) formatEntryView(entry storage.ClipboardEntry) string {
@@ -173,36 +508,104 @@ func (m *model) formatEntryView(entry storage.ClipboardEntry) string {
 	b.WriteString(titleStyle.Render(fmt.Sprintf(" Entry #%d ", entry.ID)))
 	b.WriteString("\n\n")
 
+	if entry.Title != "" {
+		b.WriteString(fmt.Sprintf("Title: %s\n", entry.Title))
+	}
+
 	b.WriteString(fmt.Sprintf("Category: %s\n", entry.Category))
 	b.WriteString(fmt.Sprintf("Time: %s\n", entry.Timestamp.Format("2006-01-02 15:04:05")))
+	if entry.CopyCount > 1 {
+		b.WriteString(fmt.Sprintf("Copied: %d times, last %s\n", entry.CopyCount, entry.LastUsed.Format("2006-01-02 15:04:05")))
+	}
+	if entry.Pinned {
+		b.WriteString("Pinned: yes\n")
+	}
+	if !entry.EditedAt.IsZero() {
+		b.WriteString(fmt.Sprintf("Edited: %s (%d revisions)\n", entry.EditedAt.Format("2006-01-02 15:04:05"), len(entry.Revisions)))
+	}
+	if len(entry.Tags) > 0 {
+		b.WriteString(fmt.Sprintf("Tags: #%s\n", strings.Join(entry.Tags, " #")))
+	}
+	if cs, err := m.db.Collections(); err == nil {
+		if names := collectionNames(cs, entry.ID); len(names) > 0 {
+			b.WriteString(fmt.Sprintf("Collections: %s\n", strings.Join(names, ", ")))
+		}
+	}
+	if entry.Note != "" {
+		b.WriteString(fmt.Sprintf("Note: %s\n", strings.ReplaceAll(entry.Note, "\n", "\n      ")))
+	}
 
 	if entry.IsImage {
 		b.WriteString(fmt.Sprintf("Type: Image\n"))
 		b.WriteString(fmt.Sprintf("Path: %s\n", entry.ImagePath))
+		if entry.Missing {
+			b.WriteString("File: missing\n")
+		}
+		if entry.Width > 0 {
+			b.WriteString(fmt.Sprintf("Image: %d×%d %s\n", entry.Width, entry.Height, entry.Format))
+		}
+		if entry.Size > 0 {
+			b.WriteString(fmt.Sprintf("Size: %s\n", storage.FormatBytes(int64(entry.Size))))
+		}
 	} else {
-		b.WriteString(fmt.Sprintf("Length: %d characters\n", len(entry.Text)))
+		if entry.Offloaded() {
+			b.WriteString(fmt.Sprintf("Length: %d characters (%s, stored compressed)\n", entry.Size, storage.FormatBytes(int64(entry.Size))))
+		} else {
+			b.WriteString(fmt.Sprintf("Length: %d characters\n", len(entry.Text)))
+		}
+		if entry.Lines > 0 {
+			b.WriteString(fmt.Sprintf("Lines: %d\n", entry.Lines))
+		}
 		if entry.Language != "" {
 			b.WriteString(fmt.Sprintf("Language: %s\n", entry.Language))
 		}
 	}
+	b.WriteString(captureDetails(entry))
 
 	b.WriteString("\n")
 	b.WriteString(strings.Repeat("━", 80))
 	b.WriteString("\n\n")
 
 	if !entry.IsImage {
-		b.WriteString(entry.Text)
+		text, err := m.db.LoadText(entry)
+		if err != nil {
+			b.WriteString("❌ " + err.Error() + "\n\n" + entry.Text)
+		} else {
+			b.WriteString(text)
+		}
 	}
 
 	return b.String()
 }
 
-func NewProgram(db *storage.Database) *tea.Program {
-	return tea.NewProgram(NewBubbleTeaUI(db), tea.WithAltScreen())
+// captureDetails lists where an entry was copied from, for entries that
+// were recorded with capture metadata.
+func captureDetails(entry storage.ClipboardEntry) string {
+	var b strings.Builder
+	if entry.Selection != "" {
+		b.WriteString(fmt.Sprintf("Selection: %s\n", entry.Selection))
+	}
+	if len(entry.MIMETypes) > 0 {
+		b.WriteString(fmt.Sprintf("MIME types: %s\n", strings.Join(entry.MIMETypes, ", ")))
+	}
+	if entry.Host != "" {
+		b.WriteString(fmt.Sprintf("Host: %s\n", entry.Host))
+	}
+	if len(entry.Hash) >= 12 {
+		b.WriteString(fmt.Sprintf("Hash: %s\n", entry.Hash[:12]))
+	}
+	return b.String()
+}
+
+// NewProgram starts the TUI on db. With profiles set, db must be the store
+// of its active profile and the TUI can switch profiles. Entries are copied
+// back through clip, if it is not nil.
+func NewProgram(db storage.Store, profiles *profile.Manager, clip clipboard.Backend) *tea.Program {
+	return tea.NewProgram(NewBubbleTeaUI(db, profiles, clip), tea.WithAltScreen())
 }
 
-func RunBubbleTea(db *storage.Database) error {
-	p := NewProgram(db)
+func RunBubbleTea(db storage.Store) error {
+	p := NewProgram(db, nil, nil)
 	_, err := p.Run()
 	return err
 }
@@ -0,0 +1,283 @@
+package ui
+
+import (
+	"clipboard_manager/storage"
+	"fmt"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// openCollections shows the collections. With adding set, choosing one
+// adds that entry to it instead of opening it.
+func (m *model) openCollections(adding *storage.ClipboardEntry) {
+	m.collecting = true
+	m.colAdding = adding
+	m.colOpen = 0
+	m.colIndex = 0
+	m.loadCollections()
+}
+
+// loadCollections reads the collections, and the entries of the open one,
+// again after a change.
+func (m *model) loadCollections() {
+	cs, err := m.db.Collections()
+	if err != nil {
+		m.status = "❌ " + err.Error()
+	}
+	m.colList = cs
+	m.colIndex = max(0, min(m.colIndex, len(cs)-1))
+	if m.colOpen == 0 {
+		return
+	}
+	entries, err := m.db.CollectionEntries(m.colOpen)
+	if err != nil {
+		// Deleted meanwhile.
+		m.colOpen = 0
+		return
+	}
+	m.colEntries = entries
+	m.colEntry = max(0, min(m.colEntry, len(entries)-1))
+}
+
+func (m model) updateCollections(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	if m.colNaming != "" {
+		return m.updateCollectionName(msg)
+	}
+	if m.colOpen != 0 {
+		return m.updateCollection(msg)
+	}
+
+	var err error
+	switch msg.String() {
+	case "ctrl+c", "q":
+		return m, tea.Quit
+	case "esc":
+		m.collecting = false
+	case "up", "k":
+		if m.colIndex > 0 {
+			m.colIndex--
+		}
+	case "down", "j":
+		if m.colIndex < len(m.colList)-1 {
+			m.colIndex++
+		}
+	case "n":
+		return m.nameCollection("new")
+	}
+	if len(m.colList) == 0 || (m.colAdding != nil && msg.String() != "enter") {
+		return m, nil
+	}
+	c := m.colList[m.colIndex]
+	switch msg.String() {
+	case "enter":
+		if m.colAdding != nil {
+			err = m.db.AddToCollection(c.ID, m.colAdding.ID)
+			if err == nil {
+				m.status = fmt.Sprintf("📚 Added entry #%d to %s", m.colAdding.ID, c.Name)
+				m.collecting = false
+			}
+			break
+		}
+		m.colOpen = c.ID
+		m.colEntry = 0
+	case "r":
+		return m.nameCollection("rename")
+	case "d":
+		if err = m.db.DeleteCollection(c.ID); err == nil {
+			m.status = fmt.Sprintf("🗑️ Deleted collection %s; its entries stay in the history", c.Name)
+		}
+	case "K", "shift+up":
+		if m.colIndex > 0 {
+			if err = m.db.MoveCollection(c.ID, m.colIndex-1); err == nil {
+				m.colIndex--
+			}
+		}
+	case "J", "shift+down":
+		if m.colIndex < len(m.colList)-1 {
+			if err = m.db.MoveCollection(c.ID, m.colIndex+1); err == nil {
+				m.colIndex++
+			}
+		}
+	}
+	if err != nil {
+		m.status = "❌ " + err.Error()
+	}
+	m.loadCollections()
+	return m, nil
+}
+
+// updateCollection handles keys while the entries of a collection show.
+func (m model) updateCollection(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "ctrl+c", "q":
+		return m, tea.Quit
+	case "esc":
+		m.colOpen = 0
+		return m, nil
+	case "up", "k":
+		if m.colEntry > 0 {
+			m.colEntry--
+		}
+		return m, nil
+	case "down", "j":
+		if m.colEntry < len(m.colEntries)-1 {
+			m.colEntry++
+		}
+		return m, nil
+	}
+	if len(m.colEntries) == 0 {
+		return m, nil
+	}
+
+	var err error
+	e := m.colEntries[m.colEntry]
+	switch msg.String() {
+	case "enter":
+		m.viewing = true
+		m.showEntry(e)
+		return m, nil
+	case "d":
+		err = m.db.RemoveFromCollection(m.colOpen, e.ID)
+	case "K", "shift+up":
+		if m.colEntry > 0 {
+			if err = m.db.MoveInCollection(m.colOpen, e.ID, m.colEntry-1); err == nil {
+				m.colEntry--
+			}
+		}
+	case "J", "shift+down":
+		if m.colEntry < len(m.colEntries)-1 {
+			if err = m.db.MoveInCollection(m.colOpen, e.ID, m.colEntry+1); err == nil {
+				m.colEntry++
+			}
+		}
+	}
+	if err != nil {
+		m.status = "❌ " + err.Error()
+	}
+	m.loadCollections()
+	return m, nil
+}
+
+// nameCollection starts typing the name of a new collection, or a new name
+// for the highlighted one.
+func (m model) nameCollection(action string) (tea.Model, tea.Cmd) {
+	in := textinput.New()
+	in.Prompt = "Name: "
+	in.CharLimit = 100
+	if action == "rename" {
+		in.SetValue(m.colList[m.colIndex].Name)
+		in.CursorEnd()
+	}
+	m.colInput = in
+	m.colNaming = action
+	return m, in.Focus()
+}
+
+func (m model) updateCollectionName(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "esc":
+		m.colNaming = ""
+		return m, nil
+	case "enter":
+		var err error
+		name := m.colInput.Value()
+		if m.colNaming == "new" {
+			var c storage.Collection
+			if c, err = m.db.CreateCollection(name); err == nil {
+				m.status = "📚 Created collection " + c.Name
+				m.colIndex = len(m.colList)
+			}
+		} else {
+			err = m.db.RenameCollection(m.colList[m.colIndex].ID, name)
+		}
+		if err != nil {
+			m.status = "❌ " + err.Error()
+		}
+		m.colNaming = ""
+		m.loadCollections()
+		return m, nil
+	}
+	var cmd tea.Cmd
+	m.colInput, cmd = m.colInput.Update(msg)
+	return m, cmd
+}
+
+func (m model) collectionsView() string {
+	var b strings.Builder
+	faint := lipgloss.NewStyle().Faint(true)
+
+	if m.colOpen != 0 {
+		name := ""
+		for _, c := range m.colList {
+			if c.ID == m.colOpen {
+				name = c.Name
+			}
+		}
+		b.WriteString(titleStyle.Render("📚 " + name))
+		b.WriteString("\n\n")
+		if len(m.colEntries) == 0 {
+			b.WriteString(itemStyle.Render("No entries yet; press a on an entry in the history to add it"))
+			b.WriteString("\n")
+		}
+		for i, e := range m.colEntries {
+			line := item{entry: e}.Title()
+			if i == m.colEntry {
+				b.WriteString(selectedItemStyle.Render("> " + line))
+			} else {
+				b.WriteString(itemStyle.Render(line))
+			}
+			b.WriteString("\n")
+		}
+		b.WriteString("\n")
+		b.WriteString(faint.Render(strings.TrimSpace(m.status + "  ↑/↓: Choose  Enter: View  K/J: Move  d: Remove  ESC: Back")))
+		return b.String()
+	}
+
+	title := "📚 Collections"
+	if m.colAdding != nil {
+		title = fmt.Sprintf("📚 Add entry #%d to collection", m.colAdding.ID)
+	}
+	b.WriteString(titleStyle.Render(title))
+	b.WriteString("\n\n")
+	if len(m.colList) == 0 {
+		b.WriteString(itemStyle.Render("No collections yet; press n to create one"))
+		b.WriteString("\n")
+	}
+	for i, c := range m.colList {
+		line := fmt.Sprintf("%s (%d)", c.Name, len(c.Entries))
+		if i == m.colIndex {
+			b.WriteString(selectedItemStyle.Render("> " + line))
+		} else {
+			b.WriteString(itemStyle.Render(line))
+		}
+		b.WriteString("\n")
+	}
+	b.WriteString("\n")
+	if m.colNaming != "" {
+		b.WriteString(m.colInput.View())
+		return b.String()
+	}
+	keys := "↑/↓: Choose  Enter: Open  n: New  r: Rename  K/J: Move  d: Delete  ESC: Back"
+	if m.colAdding != nil {
+		keys = "↑/↓: Choose  Enter: Add  n: New  ESC: Cancel"
+	}
+	b.WriteString(faint.Render(strings.TrimSpace(m.status + "  " + keys)))
+	return b.String()
+}
+
+// collectionNames lists the collections an entry is in.
+func collectionNames(cs []storage.Collection, id int) []string {
+	var names []string
+	for _, c := range cs {
+		for _, entryID := range c.Entries {
+			if entryID == id {
+				names = append(names, c.Name)
+				break
+			}
+		}
+	}
+	return names
+}
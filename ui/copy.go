@@ -0,0 +1,76 @@
+package ui
+
+import (
+	"clipboard_manager/clipboard"
+	"clipboard_manager/storage"
+	"fmt"
+	"io"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// copiedMsg reports that an entry was written to the terminal's clipboard.
+type copiedMsg struct {
+	id  int
+	err error
+}
+
+// terminalWrite writes an escape sequence while the program has let go of
+// the terminal, so it does not land in the middle of a frame.
+type terminalWrite struct {
+	seq []byte
+	out io.Writer
+}
+
+func (w *terminalWrite) Run() error {
+	_, err := w.out.Write(w.seq)
+	return err
+}
+
+func (w *terminalWrite) SetStdin(io.Reader)    {}
+func (w *terminalWrite) SetStdout(o io.Writer) { w.out = o }
+func (w *terminalWrite) SetStderr(io.Writer)   {}
+
+// copyEntry puts the text of an entry back on the clipboard. The watcher
+// then sees it copied again and moves it to the top. Backends that copy
+// through the terminal get it between frames.
+func (m *model) copyEntry(entry storage.ClipboardEntry) tea.Cmd {
+	switch {
+	case m.clip == nil:
+		m.status = "❌ No clipboard to copy to"
+		return nil
+	case entry.IsImage:
+		m.status = "❌ Only text can be copied back"
+		return nil
+	}
+	text, err := m.db.LoadText(entry)
+	if err != nil {
+		m.status = "❌ " + err.Error()
+		return nil
+	}
+	if t, ok := m.clip.(clipboard.TerminalBackend); ok {
+		seq, err := t.Sequence(clipboard.Text, []byte(text))
+		if err != nil {
+			m.status = "❌ " + err.Error()
+			return nil
+		}
+		return tea.Exec(&terminalWrite{seq: seq}, func(err error) tea.Msg {
+			return copiedMsg{id: entry.ID, err: err}
+		})
+	}
+	if err := clipboard.WriteText(m.clip, text); err != nil {
+		m.status = "❌ " + err.Error()
+		return nil
+	}
+	m.status = fmt.Sprintf("📋 Copied entry #%d", entry.ID)
+	return nil
+}
+
+func (m model) finishCopy(msg copiedMsg) (tea.Model, tea.Cmd) {
+	if msg.err != nil {
+		m.status = "❌ " + msg.err.Error()
+	} else {
+		m.status = fmt.Sprintf("📋 Copied entry #%d", msg.id)
+	}
+	return m, nil
+}
@@ -0,0 +1,106 @@
+package ui
+
+import (
+	"fmt"
+	"strings"
+)
+
+type diffOp int
+
+const (
+	diffSame diffOp = iota
+	diffRemoved
+	diffAdded
+	// diffSkipped stands for a run of unchanged lines left out.
+	diffSkipped
+)
+
+type diffLine struct {
+	op   diffOp
+	text string
+}
+
+// maxDiffCells bounds the table of the line diff; larger inputs are shown
+// as all removed and all added.
+const maxDiffCells = 4 << 20
+
+// diffLines compares two texts line by line using their longest common
+// subsequence. Unchanged runs longer than twice context are cut down to
+// context lines on each side.
+func diffLines(a, b string, context int) []diffLine {
+	x, y := strings.Split(a, "\n"), strings.Split(b, "\n")
+
+	var out []diffLine
+	if len(x)*len(y) > maxDiffCells {
+		for _, l := range x {
+			out = append(out, diffLine{diffRemoved, l})
+		}
+		for _, l := range y {
+			out = append(out, diffLine{diffAdded, l})
+		}
+		return out
+	}
+
+	// lcs[i][j] is the length of the common subsequence of x[i:] and y[j:].
+	lcs := make([][]int, len(x)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(y)+1)
+	}
+	for i := len(x) - 1; i >= 0; i-- {
+		for j := len(y) - 1; j >= 0; j-- {
+			if x[i] == y[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	i, j := 0, 0
+	for i < len(x) || j < len(y) {
+		switch {
+		case i < len(x) && j < len(y) && x[i] == y[j]:
+			out = append(out, diffLine{diffSame, x[i]})
+			i++
+			j++
+		case j < len(y) && (i == len(x) || lcs[i][j+1] >= lcs[i+1][j]):
+			out = append(out, diffLine{diffAdded, y[j]})
+			j++
+		default:
+			out = append(out, diffLine{diffRemoved, x[i]})
+			i++
+		}
+	}
+	return collapseDiff(out, context)
+}
+
+func collapseDiff(lines []diffLine, context int) []diffLine {
+	var out []diffLine
+	for start := 0; start < len(lines); {
+		if lines[start].op != diffSame {
+			out = append(out, lines[start])
+			start++
+			continue
+		}
+		end := start
+		for end < len(lines) && lines[end].op == diffSame {
+			end++
+		}
+		head, tail := context, context
+		if start == 0 {
+			head = 0
+		}
+		if end == len(lines) {
+			tail = 0
+		}
+		if end-start > head+tail+1 {
+			out = append(out, lines[start:start+head]...)
+			out = append(out, diffLine{diffSkipped, fmt.Sprintf("… %d unchanged lines", end-start-head-tail)})
+			out = append(out, lines[end-tail:end]...)
+		} else {
+			out = append(out, lines[start:end]...)
+		}
+		start = end
+	}
+	return out
+}
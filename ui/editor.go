@@ -0,0 +1,52 @@
+package ui
+
+import (
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// editorCommand writes text to a private temporary file and returns the
+// command that opens it in $VISUAL or $EDITOR, vi if neither is set, along
+// with the file's path.
+func editorCommand(text string) (*exec.Cmd, string, error) {
+	f, err := os.CreateTemp("", "clipboard-entry-*.txt")
+	if err != nil {
+		return nil, "", err
+	}
+	if _, err := f.WriteString(text); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return nil, "", err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return nil, "", err
+	}
+
+	editor := os.Getenv("VISUAL")
+	if editor == "" {
+		editor = os.Getenv("EDITOR")
+	}
+	if editor == "" {
+		editor = "vi"
+	}
+	args := append(strings.Fields(editor), f.Name())
+	return exec.Command(args[0], args[1:]...), f.Name(), nil
+}
+
+// readEdited returns what was saved to the file of editorCommand and
+// removes it. The newline editors add at the end is dropped unless the
+// original text had one.
+func readEdited(path, original string) (string, error) {
+	defer os.Remove(path)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	text := string(data)
+	if !strings.HasSuffix(original, "\n") {
+		text = strings.TrimSuffix(text, "\n")
+	}
+	return text, nil
+}
@@ -0,0 +1,125 @@
+package ui
+
+import (
+	"clipboard_manager/storage"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// noteEditedMsg reports that the editor opened for a note has exited.
+type noteEditedMsg editedMsg
+
+// openPrompt starts typing the title or the tags of the selected entry.
+func (m model) openPrompt(field string) (tea.Model, tea.Cmd) {
+	in := textinput.New()
+	in.CharLimit = 200
+	if field == "title" {
+		in.Prompt = "Title: "
+		in.Placeholder = "empty to remove"
+		in.SetValue(m.selected.Title)
+	} else {
+		in.Prompt = "Tags: "
+		in.Placeholder = "separated by spaces"
+		in.SetValue(strings.Join(m.selected.Tags, " "))
+	}
+	in.CursorEnd()
+	m.input = in
+	m.prompt = field
+	return m, in.Focus()
+}
+
+func (m model) updatePrompt(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "esc":
+		m.prompt = ""
+		return m, nil
+	case "enter":
+		field := m.prompt
+		m.prompt = ""
+		var err error
+		if field == "title" {
+			err = m.db.SetTitle(m.selected.ID, m.input.Value())
+		} else {
+			err = m.setTags(strings.Fields(m.input.Value()))
+		}
+		if err != nil {
+			m.status = "❌ " + err.Error()
+			return m, nil
+		}
+		m.reloadSelected()
+		m.status = fmt.Sprintf("🏷️ Saved %s of entry #%d", field, m.selected.ID)
+		return m, nil
+	}
+	var cmd tea.Cmd
+	m.input, cmd = m.input.Update(msg)
+	return m, cmd
+}
+
+// setTags gives the selected entry exactly tags.
+func (m model) setTags(tags []string) error {
+	keep := map[string]bool{}
+	for _, tag := range tags {
+		keep[storage.NormalizeTag(tag)] = true
+	}
+	var drop []string
+	for _, tag := range m.selected.Tags {
+		if !keep[tag] {
+			drop = append(drop, tag)
+		}
+	}
+	if len(drop) > 0 {
+		if err := m.db.RemoveTags(m.selected.ID, drop...); err != nil {
+			return err
+		}
+	}
+	return m.db.AddTags(m.selected.ID, tags...)
+}
+
+// editNote suspends the TUI and opens the entry's note in an editor.
+func (m model) editNote(entry storage.ClipboardEntry) (tea.Model, tea.Cmd) {
+	cmd, path, err := editorCommand(entry.Note)
+	if err != nil {
+		m.status = "❌ " + err.Error()
+		return m, nil
+	}
+	return m, tea.ExecProcess(cmd, func(err error) tea.Msg {
+		return noteEditedMsg{id: entry.ID, path: path, original: entry.Note, err: err}
+	})
+}
+
+func (m model) finishNote(msg noteEditedMsg) (tea.Model, tea.Cmd) {
+	if msg.err != nil {
+		os.Remove(msg.path)
+		m.status = "❌ Editor failed: " + msg.err.Error()
+		return m, nil
+	}
+	note, err := readEdited(msg.path, msg.original)
+	if err != nil {
+		m.status = "❌ " + err.Error()
+		return m, nil
+	}
+	if err := m.db.SetNote(msg.id, note); err != nil {
+		m.status = "❌ " + err.Error()
+		return m, nil
+	}
+	m.reloadSelected()
+	m.status = fmt.Sprintf("📝 Saved note of entry #%d", msg.id)
+	return m, nil
+}
+
+// reloadSelected shows the stored state of the selected entry again.
+func (m *model) reloadSelected() {
+	if m.selected == nil {
+		return
+	}
+	entry, err := m.db.GetEntry(m.selected.ID)
+	if err != nil {
+		m.status = "❌ " + err.Error()
+		return
+	}
+	m.showEntry(entry)
+}
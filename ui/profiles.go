@@ -0,0 +1,115 @@
+package ui
+
+import (
+	"fmt"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// openPicker shows the profiles to switch to, or to move or copy the
+// selected entry to.
+func (m *model) openPicker(action string) error {
+	list, err := m.profiles.List()
+	if err != nil {
+		return err
+	}
+	active, _ := m.profiles.Active()
+
+	m.pickNames = m.pickNames[:0]
+	m.pickIndex = 0
+	for _, p := range list {
+		if p.Name == active.Name {
+			if action != "switch" {
+				continue
+			}
+			m.pickIndex = len(m.pickNames)
+		}
+		m.pickNames = append(m.pickNames, p.Name)
+	}
+	if len(m.pickNames) == 0 {
+		return fmt.Errorf("no other profile to %s to; start with -profile <name> to create one", action)
+	}
+	m.picking = true
+	m.pickAction = action
+	return nil
+}
+
+func (m model) updatePicker(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "ctrl+c":
+		return m, tea.Quit
+	case "esc", "q":
+		m.picking = false
+	case "up", "k":
+		if m.pickIndex > 0 {
+			m.pickIndex--
+		}
+	case "down", "j":
+		if m.pickIndex < len(m.pickNames)-1 {
+			m.pickIndex++
+		}
+	case "enter":
+		m.picking = false
+		name := m.pickNames[m.pickIndex]
+		if m.pickAction == "switch" {
+			return m.switchProfile(name)
+		}
+		i, ok := m.list.SelectedItem().(item)
+		if !ok {
+			return m, nil
+		}
+		_, err := m.profiles.Transfer([]int{i.entry.ID}, name, m.pickAction == "move")
+		switch {
+		case err != nil:
+			m.status = "❌ " + err.Error()
+		case m.pickAction == "move":
+			m.status = fmt.Sprintf("📦 Moved entry #%d to %s", i.entry.ID, name)
+		default:
+			m.status = fmt.Sprintf("📋 Copied entry #%d to %s", i.entry.ID, name)
+		}
+	}
+	return m, nil
+}
+
+// switchProfile closes the current profile and shows the history of the
+// one called name.
+func (m model) switchProfile(name string) (tea.Model, tea.Cmd) {
+	db, err := m.profiles.Switch(name)
+	if err != nil {
+		m.status = "❌ " + err.Error()
+		return m, nil
+	}
+
+	m.db = db
+	m.events, _ = db.Subscribe()
+	m.undo = nil
+	m.list.Title = "📋 Clipboard Manager · " + name
+	m.list.ResetFilter()
+	m.refreshList()
+	m.status = "👤 Switched to profile " + name
+	return m, waitForEvent(m.events)
+}
+
+func (m model) pickerView() string {
+	var b strings.Builder
+	title := map[string]string{
+		"switch": "Switch to profile",
+		"move":   "Move entry to profile",
+		"copy":   "Copy entry to profile",
+	}[m.pickAction]
+	b.WriteString(titleStyle.Render(title))
+	b.WriteString("\n\n")
+	for i, name := range m.pickNames {
+		if i == m.pickIndex {
+			b.WriteString(selectedItemStyle.Render("> " + name))
+		} else {
+			b.WriteString(itemStyle.Render(name))
+		}
+		b.WriteString("\n")
+	}
+	b.WriteString("\n")
+	b.WriteString(lipgloss.NewStyle().Faint(true).Render("↑/↓: Choose  Enter: Confirm  ESC: Cancel"))
+	return b.String()
+}
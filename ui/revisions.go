@@ -0,0 +1,163 @@
+package ui
+
+import (
+	"clipboard_manager/storage"
+	"fmt"
+	"os"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+var (
+	addedStyle   = lipgloss.NewStyle().Foreground(lipgloss.Color("#73F59F"))
+	removedStyle = lipgloss.NewStyle().Foreground(lipgloss.Color("#FF5F87"))
+	skippedStyle = lipgloss.NewStyle().Faint(true)
+)
+
+// editedMsg reports that the editor opened for an entry has exited.
+type editedMsg struct {
+	id       int
+	path     string
+	original string
+	err      error
+}
+
+// editEntry suspends the TUI and opens the entry's text in an editor.
+func (m model) editEntry(entry storage.ClipboardEntry) (tea.Model, tea.Cmd) {
+	if entry.IsImage {
+		m.status = "❌ " + storage.ErrNotEditable.Error()
+		return m, nil
+	}
+	text, err := m.db.LoadText(entry)
+	if err != nil {
+		m.status = "❌ " + err.Error()
+		return m, nil
+	}
+	cmd, path, err := editorCommand(text)
+	if err != nil {
+		m.status = "❌ " + err.Error()
+		return m, nil
+	}
+	return m, tea.ExecProcess(cmd, func(err error) tea.Msg {
+		return editedMsg{id: entry.ID, path: path, original: text, err: err}
+	})
+}
+
+func (m model) finishEdit(msg editedMsg) (tea.Model, tea.Cmd) {
+	if msg.err != nil {
+		os.Remove(msg.path)
+		m.status = "❌ Editor failed: " + msg.err.Error()
+		return m, nil
+	}
+	text, err := readEdited(msg.path, msg.original)
+	if err != nil {
+		m.status = "❌ " + err.Error()
+		return m, nil
+	}
+	if text == msg.original {
+		m.status = "No changes"
+		return m, nil
+	}
+	entry, err := m.db.UpdateEntry(msg.id, text)
+	if err != nil {
+		m.status = "❌ " + err.Error()
+		return m, nil
+	}
+	m.status = fmt.Sprintf("✏️ Saved entry #%d, revision %d kept", entry.ID, len(entry.Revisions))
+	m.showEntry(entry)
+	return m, nil
+}
+
+// revert brings back the revision picked in the revision view.
+func (m model) revert() (tea.Model, tea.Cmd) {
+	entry, err := m.db.RevertEntry(m.selected.ID, m.revIndex)
+	if err != nil {
+		m.status = "❌ " + err.Error()
+		return m, nil
+	}
+	m.status = fmt.Sprintf("⏪ Reverted entry #%d to revision %d", entry.ID, m.revIndex)
+	m.revising = false
+	m.showEntry(entry)
+	return m, nil
+}
+
+// showEntry puts an entry in the detail view, or its revisions while the
+// revision view is open.
+func (m *model) showEntry(entry storage.ClipboardEntry) {
+	m.selected = &entry
+	if m.revising {
+		m.viewport.SetContent(m.formatRevisions(entry))
+	} else {
+		m.viewport.SetContent(m.formatEntryView(entry))
+	}
+}
+
+// formatRevisions lists the revisions of an entry and shows how the picked
+// one differs from the current text, or from the marked one if there is one.
+func (m *model) formatRevisions(entry storage.ClipboardEntry) string {
+	var b strings.Builder
+	b.WriteString(titleStyle.Render(fmt.Sprintf(" Entry #%d: revisions ", entry.ID)))
+	b.WriteString("\n\n")
+
+	for i, r := range entry.Revisions {
+		mark := " "
+		if i+1 == m.revMark {
+			mark = "*"
+		}
+		line := fmt.Sprintf("%3d%s %s  %s", i+1, mark, r.Saved.Format("2006-01-02 15:04:05"), storage.FormatBytes(int64(revisionSize(r))))
+		if i+1 == m.revIndex {
+			b.WriteString(selectedItemStyle.Render("> "+line) + "\n")
+		} else {
+			b.WriteString(itemStyle.Render(line) + "\n")
+		}
+	}
+	b.WriteString(itemStyle.Render(fmt.Sprintf("     %s  current", entry.EditedAt.Format("2006-01-02 15:04:05"))) + "\n\n")
+
+	// Revisions count from 1; 0 stands for the current text.
+	from, to := m.revIndex, 0
+	if m.revMark != 0 {
+		from, to = m.revMark, m.revIndex
+	}
+	load := func(n int) (string, error) {
+		if n == 0 {
+			return m.db.LoadText(entry)
+		}
+		return m.db.LoadRevision(entry.Revisions[n-1])
+	}
+	before, err := load(from)
+	if err != nil {
+		return b.String() + "❌ " + err.Error()
+	}
+	after, err := load(to)
+	if err != nil {
+		return b.String() + "❌ " + err.Error()
+	}
+	if to == 0 {
+		b.WriteString(fmt.Sprintf("Changes from revision %d to current:\n", from))
+	} else {
+		b.WriteString(fmt.Sprintf("Changes from revision %d to revision %d:\n", from, to))
+	}
+	b.WriteString(strings.Repeat("━", 80) + "\n")
+	for _, l := range diffLines(before, after, 3) {
+		switch l.op {
+		case diffAdded:
+			b.WriteString(addedStyle.Render("+ "+l.text) + "\n")
+		case diffRemoved:
+			b.WriteString(removedStyle.Render("- "+l.text) + "\n")
+		case diffSkipped:
+			b.WriteString(skippedStyle.Render("  "+l.text) + "\n")
+		default:
+			b.WriteString("  " + l.text + "\n")
+		}
+	}
+	return b.String()
+}
+
+func revisionSize(r storage.Revision) int {
+	if r.Offloaded() {
+		return r.Size
+	}
+	return len(r.Text)
+}
@@ -7,43 +7,100 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
 	"time"
 )
 
 type Terminal struct {
-	db *storage.Database
+	db        storage.Store
+	backupDir string
+	input     *bufio.Reader
 }
 
-func NewTerminal(db *storage.Database) *Terminal {
-	return &Terminal{db: db}
+func NewTerminal(db storage.Store, backupDir string) *Terminal {
+	return &Terminal{db: db, backupDir: backupDir, input: bufio.NewReader(os.Stdin)}
 }
 
 func (t *Terminal) Run(ctx context.Context) {
-	reader := bufio.NewReader(os.Stdin)
+	events, cancel := t.db.Subscribe()
+	defer cancel()
+	go t.watchEvents(ctx, events)
+
+	// A line is read in the background for each prompt, so that cancelling
+	// ctx ends the prompt while it waits. Nothing reads between prompts,
+	// leaving the input to commands that ask a question or run an editor.
+	prompts := make(chan struct{})
+	defer close(prompts)
+	lines := make(chan string, 1)
+	go func() {
+		defer close(lines)
+		for range prompts {
+			input, err := t.input.ReadString('\n')
+			if input == "" && err != nil {
+				return
+			}
+			lines <- input
+		}
+	}()
 
 	time.Sleep(1 * time.Second)
 	t.printHelp()
 
 	for {
+		fmt.Print("\n📋 > ")
+		prompts <- struct{}{}
 		select {
 		case <-ctx.Done():
+			fmt.Println()
 			return
-		default:
-			fmt.Print("\n📋 > ")
-			input, _ := reader.ReadString('\n')
+		case input, ok := <-lines:
+			if !ok {
+				fmt.Println()
+				return
+			}
 			input = strings.TrimSpace(input)
 
 			if input == "" {
 				continue
 			}
 
+			switch strings.ToLower(input) {
+			case "quit", "q", "exit":
+				fmt.Println("👋 Goodbye!")
+				return
+			}
 			t.handleCommand(input)
 		}
 	}
 }
 
+// Notify prints a status message between prompts.
+func (t *Terminal) Notify(msg string) {
+	fmt.Printf("\n%s\n📋 > ", msg)
+}
+
+// watchEvents reports new clipboard entries as they are recorded so the
+// history never has to be listed again by hand.
+func (t *Terminal) watchEvents(ctx context.Context, events <-chan storage.Event) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case ev, ok := <-events:
+			if !ok {
+				return
+			}
+			if ev.Type != storage.EventAdded {
+				continue
+			}
+			preview := t.formatPreview(ev.Entry.Text, 60, true)
+			fmt.Printf("\n%s\n📋 > ", info(fmt.Sprintf("New entry [%d] %s", ev.Entry.ID, preview)))
+		}
+	}
+}
+
 func (t *Terminal) handleCommand(input string) {
 	parts := strings.SplitN(input, " ", 2)
 	command := strings.ToLower(parts[0])
@@ -90,16 +147,137 @@ func (t *Terminal) handleCommand(input string) {
 			t.deleteEntry(id)
 		}
 
+	case "edit", "e":
+		if len(parts) < 2 {
+			fmt.Println("❌ Usage: edit <id>")
+			return
+		}
+		if id, err := strconv.Atoi(parts[1]); err == nil {
+			t.editEntry(id)
+		}
+
+	case "revisions":
+		if len(parts) < 2 {
+			fmt.Println("❌ Usage: revisions <id>")
+			return
+		}
+		if id, err := strconv.Atoi(parts[1]); err == nil {
+			t.listRevisions(id)
+		}
+
+	case "diff":
+		args := []string{}
+		if len(parts) > 1 {
+			args = strings.Fields(parts[1])
+		}
+		t.diff(args)
+
+	case "revert":
+		args := []string{}
+		if len(parts) > 1 {
+			args = strings.Fields(parts[1])
+		}
+		if len(args) != 2 {
+			fmt.Println("❌ Usage: revert <id> <revision>")
+			return
+		}
+		id, err1 := strconv.Atoi(args[0])
+		n, err2 := strconv.Atoi(args[1])
+		if err1 != nil || err2 != nil {
+			fmt.Println("❌ Usage: revert <id> <revision>")
+			return
+		}
+		t.revertEntry(id, n)
+
+	case "title", "note":
+		if len(parts) < 2 {
+			fmt.Printf("❌ Usage: %s <id> [text]\n", command)
+			return
+		}
+		args := strings.SplitN(strings.TrimSpace(parts[1]), " ", 2)
+		id, err := strconv.Atoi(args[0])
+		if err != nil {
+			fmt.Printf("❌ Usage: %s <id> [text]\n", command)
+			return
+		}
+		text := ""
+		if len(args) > 1 {
+			text = args[1]
+		}
+		t.annotate(command, id, text)
+
+	case "tag", "untag":
+		args := []string{}
+		if len(parts) > 1 {
+			args = strings.Fields(parts[1])
+		}
+		t.tag(command, args)
+
+	case "tags":
+		t.listTags()
+
+	case "collections":
+		t.listCollections()
+
+	case "collection":
+		args := []string{}
+		if len(parts) > 1 {
+			args = strings.Fields(parts[1])
+		}
+		t.collection(args)
+
+	case "export":
+		if len(parts) < 2 {
+			fmt.Println("❌ Usage: export <file> [filter]")
+			return
+		}
+		args := strings.Fields(parts[1])
+		t.export(args[0], strings.Join(args[1:], " "))
+
+	case "pin", "unpin":
+		if len(parts) < 2 {
+			fmt.Printf("❌ Usage: %s <id>\n", command)
+			return
+		}
+		if id, err := strconv.Atoi(parts[1]); err == nil {
+			t.setPinned(id, command == "pin")
+		}
+
 	case "clear":
-		t.clearHistory()
+		t.clearHistory(len(parts) > 1 && strings.TrimSpace(parts[1]) == "all")
+
+	case "trash":
+		if len(parts) > 1 && strings.TrimSpace(parts[1]) == "empty" {
+			t.emptyTrash()
+			return
+		}
+		t.listTrash()
+
+	case "restore":
+		if len(parts) < 2 {
+			fmt.Println("❌ Usage: restore <id>")
+			return
+		}
+		if id, err := strconv.Atoi(parts[1]); err == nil {
+			t.restoreEntry(id)
+		}
+
+	case "backup":
+		args := []string{}
+		if len(parts) > 1 {
+			args = strings.Fields(parts[1])
+		}
+		t.backup(args)
+
+	case "prune":
+		t.prune()
+
+	case "gc":
+		t.gc()
 
 	case "help", "h":
 		t.printHelp()
 
-	case "quit", "q", "exit":
-		fmt.Println("👋 Goodbye!")
-		os.Exit(0)
-
 	default:
 		fmt.Printf("❌ Unknown command: %s\n", command)
 	}
@@ -107,55 +285,107 @@ func (t *Terminal) handleCommand(input string) {
 }
 
 func (t *Terminal) listEntries(limit int) {
+	pinned, err := t.db.GetPinned()
+	if err != nil {
+		fmt.Println(errText(fmt.Sprintf("Error: %v", err)))
+		return
+	}
 	entries, err := t.db.GetRecent(limit)
 	if err != nil {	
 		fmt.Println(errText(fmt.Sprintf("Error: %v", err)))
 		return
 	}
 
-	if len(entries) == 0 {
+	if len(entries) == 0 && len(pinned) == 0 {
 		fmt.Println(info("No clipboard history yet!"))
 		return
 	}
 
+	if len(pinned) > 0 {
+		fmt.Println("\n" + colorize(ColorCyan, "━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━"))
+		fmt.Printf("%s Pinned %d entries:\n", colorize(ColorYellow, "📌"), len(pinned))
+		fmt.Println(colorize(ColorCyan, "━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━"))
+		for _, entry := range pinned {
+			t.printListEntry(entry)
+		}
+	}
+
+	recent := entries[:0:0]
+	for _, entry := range entries {
+		if !entry.Pinned {
+			recent = append(recent, entry)
+		}
+	}
+
 	fmt.Println("\n" + colorize(ColorCyan, "━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━"))
-	fmt.Printf("%s Recent %d entries:\n", colorize(ColorYellow, "📝"), len(entries))
+	fmt.Printf("%s Recent %d entries:\n", colorize(ColorYellow, "📝"), len(recent))
 	fmt.Println(colorize(ColorCyan, "━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━"))
 
-	for _, entry := range entries {
-		preview := t.formatPreview(entry.Text, 100, true)
-		timeAgo := t.formatTimeAgo(entry.Timestamp)
-		
-		idStr := colorize(ColorBlue, fmt.Sprintf("[%d]", entry.ID))
-		timeStr := colorize(ColorDim, fmt.Sprintf("⏰ %s", timeAgo))
-		
-		fmt.Printf("%s %s\n    %s\n", idStr, preview, timeStr)
+	for _, entry := range recent {
+		t.printListEntry(entry)
 	}
 	
 	fmt.Println("\n" + info("Tip: Use 'view <id>' to see full formatted content"))
 }
 
+func (t *Terminal) printListEntry(entry storage.ClipboardEntry) {
+	preview := t.formatPreview(entry.Text, 100, true)
+	if entry.Title != "" {
+		preview = bold(entry.Title)
+	}
+	timeAgo := t.formatTimeAgo(entry.LastUsed)
+
+	idStr := colorize(ColorBlue, fmt.Sprintf("[%d]", entry.ID))
+	timeStr := colorize(ColorDim, fmt.Sprintf("⏰ %s", timeAgo))
+	if entry.CopyCount > 1 {
+		timeStr += colorize(ColorDim, fmt.Sprintf("  🔁 %d copies", entry.CopyCount))
+	}
+	timeStr += sizeNote(entry)
+	if entry.Note != "" {
+		timeStr += colorize(ColorDim, "  📝 "+t.formatPreview(entry.Note, 60, true))
+	}
+	if len(entry.Tags) > 0 {
+		timeStr += colorize(ColorPurple, "  #"+strings.Join(entry.Tags, " #"))
+	}
+
+	fmt.Printf("%s %s\n    %s\n", idStr, preview, timeStr)
+}
+
 func (t *Terminal) viewEntry(id int) {
-	entries, err := t.db.GetRecent(1000)
+	entry, err := t.db.GetEntry(id)
+	if err == storage.ErrNotFound {
+		fmt.Printf("❌ Entry #%d not found\n", id)
+		return
+	}
 	if err != nil {
 		fmt.Printf("❌ Error: %v\n", err)
 		return
 	}
 
-	for _, entry := range entries {
-		if entry.ID == id {
-			fmt.Println("\n━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━")
-			fmt.Printf("📄 Entry #%d (Copied %s)\n", entry.ID, t.formatTimeAgo(entry.Timestamp))
-			fmt.Println("━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━")
-			
-			t.displayFormatted(entry.Text)
-			
-			fmt.Println("━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━")
-			return
-		}
+	fmt.Println("\n━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━")
+	fmt.Printf("📄 Entry #%d (Copied %s)\n", entry.ID, t.formatTimeAgo(entry.Timestamp))
+	if entry.Title != "" {
+		fmt.Printf("🏷️  %s\n", bold(entry.Title))
 	}
-	
-	fmt.Printf("❌ Entry #%d not found\n", id)
+	if entry.Note != "" {
+		fmt.Printf("📝 %s\n", colorize(ColorDim, entry.Note))
+	}
+	if len(entry.Tags) > 0 {
+		fmt.Printf("🔖 %s\n", colorize(ColorPurple, "#"+strings.Join(entry.Tags, " #")))
+	}
+	if details := captureDetails(entry); details != "" {
+		fmt.Print(colorize(ColorDim, details))
+	}
+	fmt.Println("━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━")
+
+	text, err := t.db.LoadText(entry)
+	if err != nil {
+		fmt.Println(errText(fmt.Sprintf("Could not load the full text: %v", err)))
+		text = entry.Text
+	}
+	t.displayFormatted(text)
+
+	fmt.Println("━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━")
 }
 
 func (t *Terminal) searchEntries(query string) {
@@ -173,7 +403,7 @@ func (t *Terminal) searchEntries(query string) {
 	fmt.Printf("\n🔍 Found %d results:\n", len(entries))
 	for _, entry := range entries {
 		preview := t.formatPreview(entry.Text, 100, true)
-		fmt.Printf("[%d] %s\n", entry.ID, preview)
+		fmt.Printf("[%d] %s%s\n", entry.ID, preview, sizeNote(entry))
 	}
 }
 
@@ -189,23 +419,574 @@ func (t *Terminal) fuzzySearch(query string) {
 	fmt.Printf("\n🔮 Fuzzy search: %d results\n", len(results))
 	for _, entry := range results {
 		preview := t.formatPreview(entry.Text, 100, true)
-		fmt.Printf("[%d] %s\n", entry.ID, preview)
+		fmt.Printf("[%d] %s%s\n", entry.ID, preview, sizeNote(entry))
+	}
+}
+
+// sizeNote gives the size of large texts, of which entries only hold a
+// preview.
+func sizeNote(entry storage.ClipboardEntry) string {
+	if !entry.Offloaded() {
+		return ""
 	}
+	return colorize(ColorDim, "  📦 "+storage.FormatBytes(int64(entry.Size)))
 }
 
 func (t *Terminal) deleteEntry(id int) {
-	t.db.DeleteEntry(id)
-	fmt.Printf("✅ Deleted #%d\n", id)
+	err := t.db.DeleteEntry(id)
+	if err == storage.ErrNotFound {
+		fmt.Printf("❌ Entry #%d not found\n", id)
+		return
+	}
+	if err != nil {
+		fmt.Printf("❌ Error: %v\n", err)
+		return
+	}
+	fmt.Printf("🗑️  Moved #%d to trash %s\n", id, colorize(ColorDim, fmt.Sprintf("(restore %d to undo)", id)))
 }
 
-func (t *Terminal) clearHistory() {
-	fmt.Print("⚠️  Clear all? (yes/no): ")
-	reader := bufio.NewReader(os.Stdin)
-	input, _ := reader.ReadString('\n')
+func (t *Terminal) listTrash() {
+	entries, err := t.db.GetTrash()
+	if err != nil {
+		fmt.Println(errText(fmt.Sprintf("Error: %v", err)))
+		return
+	}
+	if len(entries) == 0 {
+		fmt.Println(info("Trash is empty"))
+		return
+	}
+
+	fmt.Println("\n" + colorize(ColorCyan, "━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━"))
+	fmt.Printf("%s Trash: %d entries\n", colorize(ColorYellow, "🗑️"), len(entries))
+	fmt.Println(colorize(ColorCyan, "━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━"))
+	for _, entry := range entries {
+		preview := t.formatPreview(entry.Text, 100, true)
+		idStr := colorize(ColorBlue, fmt.Sprintf("[%d]", entry.ID))
+		fmt.Printf("%s %s\n    %s\n", idStr, preview, colorize(ColorDim, "🗑️  deleted "+t.formatTimeAgo(entry.DeletedAt)))
+	}
+	fmt.Println("\n" + info("Tip: Use 'restore <id>' to bring an entry back, 'trash empty' to purge"))
+}
+
+func (t *Terminal) restoreEntry(id int) {
+	err := t.db.Restore(id)
+	if err == storage.ErrNotFound {
+		fmt.Printf("❌ Entry #%d is not in the trash\n", id)
+		return
+	}
+	if err != nil {
+		fmt.Printf("❌ Error: %v\n", err)
+		return
+	}
+	fmt.Printf("♻️  Restored #%d\n", id)
+}
+
+func (t *Terminal) emptyTrash() {
+	n, err := t.db.EmptyTrash()
+	if err != nil {
+		fmt.Println(errText(fmt.Sprintf("Error: %v", err)))
+		return
+	}
+	fmt.Printf("✅ Purged %d entries from the trash\n", n)
+}
+
+func (t *Terminal) clearHistory(force bool) {
+	if force {
+		fmt.Print("⚠️  Clear all, including pinned? (yes/no): ")
+	} else {
+		fmt.Print("⚠️  Clear all except pinned? (yes/no): ")
+	}
+	input, _ := t.input.ReadString('\n')
 	if strings.TrimSpace(strings.ToLower(input)) == "yes" {
-		t.db.Clear()
-		fmt.Println("✅ Cleared!")
+		if err := t.db.Clear(force); err != nil {
+			fmt.Printf("❌ Error: %v\n", err)
+			return
+		}
+		fmt.Println("✅ Cleared! Entries are in the trash until it is emptied")
+	}
+}
+
+func (t *Terminal) setPinned(id int, pinned bool) {
+	var err error
+	if pinned {
+		err = t.db.Pin(id)
+	} else {
+		err = t.db.Unpin(id)
+	}
+	if err == storage.ErrNotFound {
+		fmt.Printf("❌ Entry #%d not found\n", id)
+		return
+	}
+	if err != nil {
+		fmt.Printf("❌ Error: %v\n", err)
+		return
+	}
+	if pinned {
+		fmt.Printf("📌 Pinned #%d\n", id)
+	} else {
+		fmt.Printf("✅ Unpinned #%d\n", id)
+	}
+}
+
+func (t *Terminal) prune() {
+	report, err := t.db.Prune()
+	if err != nil {
+		fmt.Println(errText(fmt.Sprintf("Error: %v", err)))
+	}
+
+	for _, p := range report.Entries {
+		preview := t.formatPreview(p.Entry.Text, 60, true)
+		fmt.Printf("%s %s %s\n", colorize(ColorBlue, fmt.Sprintf("[%d]", p.Entry.ID)), preview, colorize(ColorDim, "("+p.Reason+")"))
+	}
+	for _, path := range report.Orphans {
+		fmt.Printf("%s %s\n", colorize(ColorDim, "orphan"), path)
+	}
+	fmt.Println(info(report.String()))
+}
+
+func (t *Terminal) gc() {
+	report, err := t.db.GC()
+	if err != nil {
+		fmt.Println(errText(fmt.Sprintf("Error: %v", err)))
+		return
+	}
+	for _, path := range report.Removed {
+		fmt.Printf("%s %s\n", colorize(ColorDim, "removed"), path)
+	}
+	for _, id := range report.Missing {
+		fmt.Println(warning(fmt.Sprintf("Entry #%d: image file is missing", id)))
+	}
+	fmt.Println(info(report.String()))
+}
+
+func (t *Terminal) backup(args []string) {
+	if len(args) == 0 {
+		b, err := t.db.Backup(t.backupDir)
+		if err != nil {
+			fmt.Println(errText(fmt.Sprintf("Error: %v", err)))
+			return
+		}
+		fmt.Printf("💾 Backed up to %s\n", b.Path)
+		return
+	}
+
+	switch args[0] {
+	case "list":
+		backups, err := storage.ListBackups(t.backupDir)
+		if err != nil {
+			fmt.Println(errText(fmt.Sprintf("Error: %v", err)))
+			return
+		}
+		if len(backups) == 0 {
+			fmt.Println(info("No backups yet"))
+			return
+		}
+		for _, b := range backups {
+			fmt.Printf("%s %s\n", colorize(ColorBlue, b.Name), colorize(ColorDim, b.Created.Format("2006-01-02 15:04")+"  "+b.String()))
+		}
+
+	case "verify", "restore":
+		if len(args) < 2 {
+			fmt.Printf("❌ Usage: backup %s <name>\n", args[0])
+			return
+		}
+		path := filepath.Join(t.backupDir, args[1])
+		if args[0] == "verify" {
+			if err := t.db.VerifyBackup(path); err != nil {
+				fmt.Println(errText(fmt.Sprintf("%s: %v", args[1], err)))
+				return
+			}
+			fmt.Printf("✅ %s is intact\n", args[1])
+			return
+		}
+
+		fmt.Printf("⚠️  Replace the whole history with %s? (yes/no): ", args[1])
+		input, _ := t.input.ReadString('\n')
+		if strings.TrimSpace(strings.ToLower(input)) != "yes" {
+			return
+		}
+		if err := t.db.RestoreBackup(path); err != nil {
+			fmt.Println(errText(fmt.Sprintf("Error: %v", err)))
+			return
+		}
+		fmt.Printf("♻️  Restored %s; the previous history was backed up first\n", args[1])
+
+	default:
+		fmt.Println("❌ Usage: backup [list | verify <name> | restore <name>]")
+	}
+}
+
+func (t *Terminal) editEntry(id int) {
+	entry, err := t.db.GetEntry(id)
+	if err == storage.ErrNotFound {
+		fmt.Printf("❌ Entry #%d not found\n", id)
+		return
+	}
+	if err != nil {
+		fmt.Printf("❌ Error: %v\n", err)
+		return
+	}
+	if entry.IsImage {
+		fmt.Println(errText(storage.ErrNotEditable.Error()))
+		return
+	}
+	original, err := t.db.LoadText(entry)
+	if err != nil {
+		fmt.Println(errText(fmt.Sprintf("Error: %v", err)))
+		return
+	}
+
+	cmd, path, err := editorCommand(original)
+	if err != nil {
+		fmt.Println(errText(fmt.Sprintf("Error: %v", err)))
+		return
+	}
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	if err := cmd.Run(); err != nil {
+		os.Remove(path)
+		fmt.Println(errText(fmt.Sprintf("Editor failed: %v", err)))
+		return
+	}
+	text, err := readEdited(path, original)
+	if err != nil {
+		fmt.Println(errText(fmt.Sprintf("Error: %v", err)))
+		return
+	}
+	if text == original {
+		fmt.Println(info("No changes"))
+		return
+	}
+
+	entry, err = t.db.UpdateEntry(id, text)
+	if err != nil {
+		fmt.Println(errText(fmt.Sprintf("Error: %v", err)))
+		return
+	}
+	fmt.Printf("✏️  Saved #%d %s\n", id, colorize(ColorDim, fmt.Sprintf("(revert %d %d to undo)", id, len(entry.Revisions))))
+}
+
+func (t *Terminal) listRevisions(id int) {
+	entry, err := t.db.GetEntry(id)
+	if err == storage.ErrNotFound {
+		fmt.Printf("❌ Entry #%d not found\n", id)
+		return
+	}
+	if err != nil {
+		fmt.Printf("❌ Error: %v\n", err)
+		return
+	}
+	if len(entry.Revisions) == 0 {
+		fmt.Println(info(fmt.Sprintf("Entry #%d has not been edited", id)))
+		return
+	}
+
+	fmt.Println("\n" + colorize(ColorCyan, "━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━"))
+	fmt.Printf("%s Entry #%d: %d revisions\n", colorize(ColorYellow, "🕘"), id, len(entry.Revisions))
+	fmt.Println(colorize(ColorCyan, "━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━"))
+	for i, r := range entry.Revisions {
+		preview := t.formatPreview(r.Text, 80, true)
+		note := "⏰ " + r.Saved.Format("2006-01-02 15:04:05")
+		if r.Offloaded() {
+			note += "  📦 " + storage.FormatBytes(int64(r.Size))
+		}
+		fmt.Printf("%s %s\n    %s\n", colorize(ColorBlue, fmt.Sprintf("(%d)", i+1)), preview, colorize(ColorDim, note))
+	}
+	fmt.Printf("%s %s\n    %s\n", colorize(ColorBlue, "(current)"), t.formatPreview(entry.Text, 80, true),
+		colorize(ColorDim, "⏰ "+entry.EditedAt.Format("2006-01-02 15:04:05")))
+	fmt.Println("\n" + info(fmt.Sprintf("Tip: Use 'diff %d <a> [b]' to compare, 'revert %d <n>' to go back", id, id)))
+}
+
+// diff compares two revisions of an entry, or one revision with the
+// current text when the second is left out.
+func (t *Terminal) diff(args []string) {
+	if len(args) < 2 || len(args) > 3 {
+		fmt.Println("❌ Usage: diff <id> <revision> [revision|current]")
+		return
+	}
+	id, err := strconv.Atoi(args[0])
+	if err != nil {
+		fmt.Println("❌ Usage: diff <id> <revision> [revision|current]")
+		return
+	}
+	entry, err := t.db.GetEntry(id)
+	if err == storage.ErrNotFound {
+		fmt.Printf("❌ Entry #%d not found\n", id)
+		return
+	}
+	if err != nil {
+		fmt.Printf("❌ Error: %v\n", err)
+		return
+	}
+
+	// Revisions count from 1; the one after the last is the current text.
+	load := func(arg string) (string, bool) {
+		n := len(entry.Revisions) + 1
+		var err error
+		if arg != "current" {
+			if n, err = strconv.Atoi(arg); err != nil || n < 1 || n > len(entry.Revisions)+1 {
+				fmt.Printf("❌ Entry #%d has no revision %s\n", id, arg)
+				return "", false
+			}
+		}
+		var text string
+		if n > len(entry.Revisions) {
+			text, err = t.db.LoadText(entry)
+		} else {
+			text, err = t.db.LoadRevision(entry.Revisions[n-1])
+		}
+		if err != nil {
+			fmt.Println(errText(fmt.Sprintf("Error: %v", err)))
+			return "", false
+		}
+		return text, true
+	}
+	to := "current"
+	if len(args) == 3 {
+		to = args[2]
+	}
+	a, ok := load(args[1])
+	if !ok {
+		return
+	}
+	b, ok := load(to)
+	if !ok {
+		return
+	}
+
+	fmt.Println(colorize(ColorCyan, fmt.Sprintf("━━━ #%d: %s → %s", id, args[1], to)))
+	for _, l := range diffLines(a, b, 3) {
+		switch l.op {
+		case diffAdded:
+			fmt.Println(colorize(ColorGreen, "+ "+l.text))
+		case diffRemoved:
+			fmt.Println(colorize(ColorRed, "- "+l.text))
+		case diffSkipped:
+			fmt.Println(colorize(ColorDim, "  "+l.text))
+		default:
+			fmt.Println("  " + l.text)
+		}
+	}
+}
+
+func (t *Terminal) revertEntry(id, n int) {
+	entry, err := t.db.RevertEntry(id, n)
+	if err == storage.ErrNotFound {
+		fmt.Printf("❌ Entry #%d not found\n", id)
+		return
+	}
+	if err != nil {
+		fmt.Println(errText(fmt.Sprintf("Error: %v", err)))
+		return
+	}
+	fmt.Printf("⏪ Reverted #%d to revision %d %s\n", id, n, colorize(ColorDim, fmt.Sprintf("(revert %d %d to undo)", id, len(entry.Revisions))))
+}
+
+// annotate sets the title or the note of an entry; an empty text removes
+// it.
+func (t *Terminal) annotate(field string, id int, text string) {
+	var err error
+	if field == "title" {
+		err = t.db.SetTitle(id, text)
+	} else {
+		err = t.db.SetNote(id, text)
+	}
+	if err == storage.ErrNotFound {
+		fmt.Printf("❌ Entry #%d not found\n", id)
+		return
+	}
+	if err != nil {
+		fmt.Println(errText(fmt.Sprintf("Error: %v", err)))
+		return
+	}
+	if text == "" {
+		fmt.Printf("🏷️  Removed the %s of #%d\n", field, id)
+		return
+	}
+	fmt.Printf("🏷️  Saved the %s of #%d\n", field, id)
+}
+
+// tag adds tags to an entry, or with untag removes them. tag rename and
+// tag merge change a tag on every entry.
+func (t *Terminal) tag(command string, args []string) {
+	if command == "tag" && len(args) == 3 && (args[0] == "rename" || args[0] == "merge") {
+		var n int
+		var err error
+		if args[0] == "rename" {
+			n, err = t.db.RenameTag(args[1], args[2])
+		} else {
+			n, err = t.db.MergeTag(args[1], args[2])
+		}
+		if err != nil {
+			fmt.Println(errText(fmt.Sprintf("Error: %v", err)))
+			return
+		}
+		fmt.Printf("🔖 Retagged %d entries as #%s\n", n, storage.NormalizeTag(args[2]))
+		return
+	}
+
+	usage := "❌ Usage: untag <id> <tags>"
+	if command == "tag" {
+		usage = "❌ Usage: tag <id> <tags> | tag rename <old> <new> | tag merge <from> <into>"
+	}
+	if len(args) < 2 {
+		fmt.Println(usage)
+		return
+	}
+	id, err := strconv.Atoi(args[0])
+	if err != nil {
+		fmt.Println(usage)
+		return
+	}
+	if command == "tag" {
+		err = t.db.AddTags(id, args[1:]...)
+	} else {
+		err = t.db.RemoveTags(id, args[1:]...)
+	}
+	if err == storage.ErrNotFound {
+		fmt.Printf("❌ Entry #%d not found\n", id)
+		return
+	}
+	if err != nil {
+		fmt.Println(errText(fmt.Sprintf("Error: %v", err)))
+		return
+	}
+	entry, err := t.db.GetEntry(id)
+	if err != nil {
+		fmt.Println(errText(fmt.Sprintf("Error: %v", err)))
+		return
+	}
+	if len(entry.Tags) == 0 {
+		fmt.Printf("🔖 #%d has no tags\n", id)
+		return
+	}
+	fmt.Printf("🔖 #%d: %s\n", id, colorize(ColorPurple, "#"+strings.Join(entry.Tags, " #")))
+}
+
+func (t *Terminal) listTags() {
+	tags, err := t.db.ListTags()
+	if err != nil {
+		fmt.Println(errText(fmt.Sprintf("Error: %v", err)))
+		return
+	}
+	if len(tags) == 0 {
+		fmt.Println(info("No tags yet; add some with 'tag <id> <tags>'"))
+		return
+	}
+	for _, tag := range tags {
+		fmt.Printf("%s %s\n", colorize(ColorPurple, "#"+tag.Name), colorize(ColorDim, fmt.Sprintf("(%d)", tag.Count)))
+	}
+}
+
+func (t *Terminal) listCollections() {
+	cs, err := t.db.Collections()
+	if err != nil {
+		fmt.Println(errText(fmt.Sprintf("Error: %v", err)))
+		return
+	}
+	if len(cs) == 0 {
+		fmt.Println(info("No collections yet; create one with 'collection new <name>'"))
+		return
+	}
+	for _, c := range cs {
+		fmt.Printf("%s %s %s\n", colorize(ColorBlue, fmt.Sprintf("[%d]", c.ID)), bold(c.Name),
+			colorize(ColorDim, fmt.Sprintf("(%d entries)", len(c.Entries))))
+	}
+}
+
+func (t *Terminal) collection(args []string) {
+	usage := "❌ Usage: collection new <name> | show <id> | rename <id> <name> | delete <id> |\n" +
+		"         add <id> <entry> | remove <id> <entry> | move <id> <entry> <position>"
+	if len(args) < 2 {
+		fmt.Println(usage)
+		return
+	}
+	if args[0] == "new" {
+		c, err := t.db.CreateCollection(strings.Join(args[1:], " "))
+		if err != nil {
+			fmt.Println(errText(fmt.Sprintf("Error: %v", err)))
+			return
+		}
+		fmt.Printf("📚 Created collection %s %s\n", bold(c.Name), colorize(ColorDim, fmt.Sprintf("[%d]", c.ID)))
+		return
+	}
+
+	// Every other command names the collection and then takes numbers,
+	// except rename.
+	var nums []int
+	for i, arg := range args[1:] {
+		if args[0] == "rename" && i > 0 {
+			break
+		}
+		n, err := strconv.Atoi(arg)
+		if err != nil {
+			fmt.Println(usage)
+			return
+		}
+		nums = append(nums, n)
+	}
+	id := nums[0]
+
+	var err error
+	switch {
+	case args[0] == "show" && len(nums) == 1:
+		t.showCollection(id)
+		return
+	case args[0] == "rename" && len(args) > 2:
+		err = t.db.RenameCollection(id, strings.Join(args[2:], " "))
+	case args[0] == "delete" && len(nums) == 1:
+		err = t.db.DeleteCollection(id)
+	case args[0] == "add" && len(nums) == 2:
+		err = t.db.AddToCollection(id, nums[1])
+	case args[0] == "remove" && len(nums) == 2:
+		err = t.db.RemoveFromCollection(id, nums[1])
+	case args[0] == "move" && len(nums) == 3:
+		err = t.db.MoveInCollection(id, nums[1], nums[2]-1)
+	default:
+		fmt.Println(usage)
+		return
+	}
+	if err != nil {
+		fmt.Println(errText(fmt.Sprintf("Error: %v", err)))
+		return
+	}
+	fmt.Println(info("📚 Collection updated"))
+}
+
+func (t *Terminal) showCollection(id int) {
+	entries, err := t.db.CollectionEntries(id)
+	if err != nil {
+		fmt.Println(errText(fmt.Sprintf("Error: %v", err)))
+		return
+	}
+	if len(entries) == 0 {
+		fmt.Println(info("The collection is empty; add entries with 'collection add <id> <entry>'"))
+		return
+	}
+	for i, entry := range entries {
+		fmt.Printf("%s ", colorize(ColorDim, fmt.Sprintf("%2d.", i+1)))
+		t.printListEntry(entry)
+	}
+}
+
+func (t *Terminal) export(path, query string) {
+	filter, err := storage.ParseFilter(query)
+	if err != nil {
+		fmt.Println(errText(fmt.Sprintf("Error: %v", err)))
+		return
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		fmt.Println(errText(fmt.Sprintf("Error: %v", err)))
+		return
+	}
+	err = t.db.Export(f, filter)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		fmt.Println(errText(fmt.Sprintf("Error: %v", err)))
+		return
 	}
+	fmt.Printf("📤 Exported history to %s\n", path)
 }
 
 func (t *Terminal) printHelp() {
@@ -214,13 +995,32 @@ func (t *Terminal) printHelp() {
 	fmt.Println(colorize(ColorCyan, "━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━"))
 	fmt.Printf("  %s - Show last n entries (compact)\n", colorize(ColorGreen, "list [n]"))
 	fmt.Printf("  %s - View full entry with formatting\n", colorize(ColorGreen, "view <id>"))
-	fmt.Printf("  %s - Search clipboard\n", colorize(ColorGreen, "search <text>"))
+	fmt.Printf("  %s - Edit entry text in $EDITOR\n", colorize(ColorGreen, "edit <id>"))
+	fmt.Printf("  %s - List earlier texts of an edited entry\n", colorize(ColorGreen, "revisions <id>"))
+	fmt.Printf("  %s - Compare revisions (default: with current)\n", colorize(ColorGreen, "diff <id> <a> [b]"))
+	fmt.Printf("  %s - Bring back an earlier revision\n", colorize(ColorGreen, "revert <id> <n>"))
+	fmt.Printf("  %s - Set or remove an entry's title\n", colorize(ColorGreen, "title <id> [text]"))
+	fmt.Printf("  %s - Set or remove an entry's note\n", colorize(ColorGreen, "note <id> [text]"))
+	fmt.Printf("  %s - List collections\n", colorize(ColorGreen, "collections"))
+	fmt.Printf("  %s - Create a collection / show its entries\n", colorize(ColorGreen, "collection new <name>, show <id>"))
+	fmt.Printf("  %s - Add, remove or reorder entries\n", colorize(ColorGreen, "collection add|remove <id> <entry>, move <id> <entry> <pos>"))
+	fmt.Printf("  %s - Rename or delete a collection\n", colorize(ColorGreen, "collection rename <id> <name>, delete <id>"))
+	fmt.Printf("  %s - Search clipboard (filters: host: size> lines< is:image ...)\n", colorize(ColorGreen, "search <text>"))
 	fmt.Printf("  %s - Fuzzy search\n", colorize(ColorGreen, "fuzzy <text>"))
-	fmt.Printf("  %s - Add tags to entry\n", colorize(ColorGreen, "tag <id> <tags>"))
+	fmt.Printf("  %s - Add tags to entry / remove them\n", colorize(ColorGreen, "tag <id> <tags>, untag <id> <tags>"))
+	fmt.Printf("  %s - List tags with their counts\n", colorize(ColorGreen, "tags"))
+	fmt.Printf("  %s - Rename a tag / merge it into another\n", colorize(ColorGreen, "tag rename <old> <new>, tag merge <from> <into>"))
+	fmt.Printf("  %s - Pin entry / unpin it\n", colorize(ColorGreen, "pin <id>, unpin <id>"))
 	fmt.Printf("  %s - Show statistics\n", colorize(ColorGreen, "stats"))
-	fmt.Printf("  %s - Export to file\n", colorize(ColorGreen, "export <file>"))
-	fmt.Printf("  %s - Delete entry\n", colorize(ColorRed, "delete <id>"))
-	fmt.Printf("  %s - Clear all\n", colorize(ColorRed, "clear"))
+	fmt.Printf("  %s - Export history as JSON, optionally filtered\n", colorize(ColorGreen, "export <file> [filter]"))
+	fmt.Printf("  %s - Apply retention limits now\n", colorize(ColorGreen, "prune"))
+	fmt.Printf("  %s - Remove unreferenced image files\n", colorize(ColorGreen, "gc"))
+	fmt.Printf("  %s - Take a snapshot now\n", colorize(ColorGreen, "backup"))
+	fmt.Printf("  %s - List, check or restore snapshots\n", colorize(ColorGreen, "backup list|verify|restore <name>"))
+	fmt.Printf("  %s - Move entry to trash\n", colorize(ColorRed, "delete <id>"))
+	fmt.Printf("  %s - Clear all but pinned (all: pinned too)\n", colorize(ColorRed, "clear [all]"))
+	fmt.Printf("  %s - Show deleted entries / purge them\n", colorize(ColorYellow, "trash [empty]"))
+	fmt.Printf("  %s - Bring an entry back from the trash\n", colorize(ColorYellow, "restore <id>"))
 	fmt.Printf("  %s - Show this help\n", colorize(ColorBlue, "help"))
 	fmt.Printf("  %s - Exit program\n", colorize(ColorBlue, "quit"))
 	fmt.Println(colorize(ColorCyan, "━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━"))
@@ -0,0 +1,180 @@
+package ui
+
+import (
+	"bufio"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"clipboard_manager/storage"
+)
+
+func TestTerminalCommands(t *testing.T) {
+	tests := []struct {
+		name string
+		// commands run against a history of "hello" (#1) and "world" (#2),
+		// with $DIR standing for a temporary directory. Questions are
+		// answered with yes.
+		commands []string
+		check    func(t *testing.T, db *storage.Database, dir string)
+	}{
+		{"pin", []string{"pin 1"}, func(t *testing.T, db *storage.Database, dir string) {
+			if e := entry(t, db, 1); !e.Pinned {
+				t.Error("#1 is not pinned")
+			}
+		}},
+		{"unpin", []string{"pin 1", "unpin 1"}, func(t *testing.T, db *storage.Database, dir string) {
+			if e := entry(t, db, 1); e.Pinned {
+				t.Error("#1 is still pinned")
+			}
+		}},
+		{"delete", []string{"delete 1"}, func(t *testing.T, db *storage.Database, dir string) {
+			if trash, _ := db.GetTrash(); len(trash) != 1 || trash[0].ID != 1 {
+				t.Errorf("trash is %v, want #1", trash)
+			}
+		}},
+		{"restore", []string{"delete 1", "restore 1"}, func(t *testing.T, db *storage.Database, dir string) {
+			entry(t, db, 1)
+		}},
+		{"empty the trash", []string{"delete 1", "trash empty"}, func(t *testing.T, db *storage.Database, dir string) {
+			if trash, _ := db.GetTrash(); len(trash) != 0 {
+				t.Errorf("%d entries left in the trash", len(trash))
+			}
+		}},
+		{"clear", []string{"pin 1", "clear"}, func(t *testing.T, db *storage.Database, dir string) {
+			if entries, _ := db.GetRecent(math.MaxInt); len(entries) != 1 || entries[0].ID != 1 {
+				t.Errorf("history is %v, want the pinned entry", entries)
+			}
+		}},
+		{"clear all", []string{"pin 1", "clear all"}, func(t *testing.T, db *storage.Database, dir string) {
+			if entries, _ := db.GetRecent(math.MaxInt); len(entries) != 0 {
+				t.Errorf("%d entries left", len(entries))
+			}
+		}},
+		{"edit", []string{"edit 1"}, func(t *testing.T, db *storage.Database, dir string) {
+			if e := entry(t, db, 1); e.Text != "goodbye" || len(e.Revisions) != 1 {
+				t.Errorf("#1 is %q with %d revisions, want goodbye with 1", e.Text, len(e.Revisions))
+			}
+		}},
+		{"revert", []string{"edit 1", "revert 1 1"}, func(t *testing.T, db *storage.Database, dir string) {
+			if e := entry(t, db, 1); e.Text != "hello" {
+				t.Errorf("#1 is %q, want hello", e.Text)
+			}
+		}},
+		{"title and note", []string{"title 1 greeting", "note 1 said twice"}, func(t *testing.T, db *storage.Database, dir string) {
+			if e := entry(t, db, 1); e.Title != "greeting" || e.Note != "said twice" {
+				t.Errorf("#1 has title %q and note %q", e.Title, e.Note)
+			}
+		}},
+		{"remove the title", []string{"title 1 greeting", "title 1"}, func(t *testing.T, db *storage.Database, dir string) {
+			if e := entry(t, db, 1); e.Title != "" {
+				t.Errorf("#1 still has title %q", e.Title)
+			}
+		}},
+		{"tag", []string{"tag 1 greet Demo"}, func(t *testing.T, db *storage.Database, dir string) {
+			if e := entry(t, db, 1); !reflect.DeepEqual(e.Tags, []string{"greet", "demo"}) {
+				t.Errorf("#1 is tagged %q", e.Tags)
+			}
+		}},
+		{"untag", []string{"tag 1 greet demo", "untag 1 greet"}, func(t *testing.T, db *storage.Database, dir string) {
+			if e := entry(t, db, 1); !reflect.DeepEqual(e.Tags, []string{"demo"}) {
+				t.Errorf("#1 is tagged %q", e.Tags)
+			}
+		}},
+		{"rename a tag", []string{"tag 1 greet", "tag rename greet hi"}, func(t *testing.T, db *storage.Database, dir string) {
+			if e := entry(t, db, 1); !reflect.DeepEqual(e.Tags, []string{"hi"}) {
+				t.Errorf("#1 is tagged %q", e.Tags)
+			}
+		}},
+		{"collection", []string{"collection new Daily words", "collection add 1 2", "collection add 1 1", "collection move 1 1 1"},
+			func(t *testing.T, db *storage.Database, dir string) {
+				cs, _ := db.Collections()
+				if len(cs) != 1 || cs[0].Name != "Daily words" {
+					t.Fatalf("collections are %v", cs)
+				}
+				entries, _ := db.CollectionEntries(cs[0].ID)
+				if len(entries) != 2 || entries[0].ID != 1 || entries[1].ID != 2 {
+					t.Errorf("collection holds %v, want #1 then #2", entries)
+				}
+			}},
+		{"export", []string{"export $DIR/export.json hello"}, func(t *testing.T, db *storage.Database, dir string) {
+			if info, err := os.Stat(filepath.Join(dir, "export.json")); err != nil || info.Size() == 0 {
+				t.Errorf("nothing exported: %v", err)
+			}
+		}},
+		{"backup", []string{"backup"}, func(t *testing.T, db *storage.Database, dir string) {
+			backups, err := storage.ListBackups(filepath.Join(dir, "backups"))
+			if err != nil || len(backups) != 1 {
+				t.Errorf("got %d backups, %v", len(backups), err)
+			}
+		}},
+		{"prune", []string{"prune"}, func(t *testing.T, db *storage.Database, dir string) {
+			if entries, _ := db.GetRecent(math.MaxInt); len(entries) != 2 {
+				t.Errorf("%d entries left, want both", len(entries))
+			}
+		}},
+		{"restore a backup", []string{"backup", "delete 1", "trash empty", "backup restore $BACKUP"},
+			func(t *testing.T, db *storage.Database, dir string) {
+				entry(t, db, 1)
+			}},
+		{"gc", []string{"gc"}, func(t *testing.T, db *storage.Database, dir string) {}},
+	}
+	t.Setenv("VISUAL", "sed -i s/hello/goodbye/")
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			db, err := storage.NewDatabase(filepath.Join(dir, "history.json"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer db.Close()
+			db.AddEntry("hello")
+			db.AddEntry("world")
+
+			term := NewTerminal(db, filepath.Join(dir, "backups"))
+			term.input = bufio.NewReader(strings.NewReader(strings.Repeat("yes\n", len(tt.commands))))
+			quiet(t)
+			for _, command := range tt.commands {
+				command = strings.ReplaceAll(command, "$DIR", dir)
+				if strings.Contains(command, "$BACKUP") {
+					backups, _ := storage.ListBackups(filepath.Join(dir, "backups"))
+					if len(backups) == 0 {
+						t.Fatal("no backup to restore")
+					}
+					command = strings.ReplaceAll(command, "$BACKUP", backups[0].Name)
+				}
+				term.handleCommand(command)
+			}
+			tt.check(t, db, dir)
+		})
+	}
+}
+
+// entry returns the live entry with the given ID.
+func entry(t *testing.T, db *storage.Database, id int) storage.ClipboardEntry {
+	t.Helper()
+	e, err := db.GetEntry(id)
+	if err != nil {
+		t.Fatalf("#%d: %v", id, err)
+	}
+	return e
+}
+
+// quiet sends what the terminal prints to nowhere for the rest of the
+// test.
+func quiet(t *testing.T) {
+	t.Helper()
+	null, err := os.OpenFile(os.DevNull, os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = null
+	t.Cleanup(func() {
+		os.Stdout = stdout
+		null.Close()
+	})
+}